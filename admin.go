@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// RuntimeConfig is the configuration of the server the admin endpoints change while it runs.
+// Requests already being answered finish with the configuration they started with.
+type RuntimeConfig struct {
+	Model          string   `json:"model"`
+	RPS            float64  `json:"rps"`
+	TPM            int      `json:"tpm"`
+	KeyRPM         float64  `json:"key_rpm"`
+	KeyDailyTokens int      `json:"key_daily_tokens"`
+	Templates      []string `json:"templates"`
+}
+
+// configChange is a PATCH of the RuntimeConfig, the fields it leaves out stay as they are.
+type configChange struct {
+	Model          *string  `json:"model"`
+	RPS            *float64 `json:"rps"`
+	TPM            *int     `json:"tpm"`
+	KeyRPM         *float64 `json:"key_rpm"`
+	KeyDailyTokens *int     `json:"key_daily_tokens"`
+}
+
+// validate rejects negative limits, 0 being no limit.
+func (c configChange) validate() error {
+	switch {
+	case c.RPS != nil && *c.RPS < 0:
+		return fmt.Errorf("rps must not be negative")
+	case c.TPM != nil && *c.TPM < 0:
+		return fmt.Errorf("tpm must not be negative")
+	case c.KeyRPM != nil && *c.KeyRPM < 0:
+		return fmt.Errorf("key_rpm must not be negative")
+	case c.KeyDailyTokens != nil && *c.KeyDailyTokens < 0:
+		return fmt.Errorf("key_daily_tokens must not be negative")
+	}
+
+	return nil
+}
+
+func (s *server) runtimeConfig() RuntimeConfig {
+	limits := s.models.rateLimit()
+	flags, _, _ := s.auth.settings()
+
+	templateOverrides.RLock()
+	templates := make([]string, 0, len(templateOverrides.templates))
+	for name := range templateOverrides.templates {
+		templates = append(templates, name)
+	}
+	templateOverrides.RUnlock()
+	slices.Sort(templates)
+
+	return RuntimeConfig{
+		Model:          s.models.defaultModel().modelID,
+		RPS:            limits.RPS,
+		TPM:            limits.TPM,
+		KeyRPM:         flags.KeyRPM,
+		KeyDailyTokens: flags.KeyDailyTokens,
+		Templates:      templates,
+	}
+}
+
+func (s *server) changeConfig(c configChange) error {
+	err := c.validate()
+	if err != nil {
+		return err
+	}
+
+	if c.Model != nil {
+		err := s.models.setDefault(*c.Model)
+		if err != nil {
+			return err
+		}
+	}
+
+	config := s.runtimeConfig()
+	if c.RPS != nil || c.TPM != nil {
+		if c.RPS != nil {
+			config.RPS = *c.RPS
+		}
+		if c.TPM != nil {
+			config.TPM = *c.TPM
+		}
+		s.models.setRateLimit(config.RPS, config.TPM)
+	}
+	if c.KeyRPM != nil || c.KeyDailyTokens != nil {
+		if c.KeyRPM != nil {
+			config.KeyRPM = *c.KeyRPM
+		}
+		if c.KeyDailyTokens != nil {
+			config.KeyDailyTokens = *c.KeyDailyTokens
+		}
+		s.auth.setQuotas(config.KeyRPM, config.KeyDailyTokens)
+	}
+
+	return nil
+}
+
+// reload reads the flags of the server again, from its config file, the environment and command
+// line, and applies the model, the rate limits, the admin key and the authentication they set.
+// The other flags only take effect on a restart.
+func (s *server) reload() error {
+	f, err := loadServeFlags(s.args, flag.ContinueOnError)
+	if err != nil {
+		return err
+	}
+
+	err = s.models.setDefault(f.Model)
+	if err != nil {
+		return err
+	}
+	s.models.setRateLimit(f.RPS, f.TPM)
+	err = s.auth.reload(f.AuthFlags)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.adminKey = f.AdminKey
+	s.mu.Unlock()
+
+	return nil
+}
+
+// reloadOnHangup reloads the configuration of the server whenever the process gets a SIGHUP.
+func (s *server) reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		err := s.reload()
+		if err != nil {
+			log.Println("reloading the configuration:", err)
+			continue
+		}
+		log.Println("reloaded the configuration")
+	}
+}
+
+// handleAdmin serves, to the holder of -admin-key,
+//
+//	GET /admin/config               the RuntimeConfig
+//	PATCH /admin/config             a change of the RuntimeConfig
+//	POST /admin/reload              a reload of the configuration, as a SIGHUP
+//	GET|PUT|DELETE /admin/templates/NAME  the prompt template NAME set at runtime
+func (s *server) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	key := s.adminKey
+	s.mu.Unlock()
+
+	credential := r.Header.Get("X-Api-Key")
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		credential = token
+	}
+	if key == "" || subtle.ConstantTimeCompare([]byte(credential), []byte(key)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, SummarizeResponse{Error: "the admin key is required"})
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/admin/")
+	switch {
+	case path == "config" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.runtimeConfig())
+	case path == "config" && r.Method == http.MethodPatch:
+		var change configChange
+
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&change)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+			return
+		}
+		err = s.changeConfig(change)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+			return
+		}
+		log.Println("admin changed the configuration")
+		writeJSON(w, http.StatusOK, s.runtimeConfig())
+	case path == "reload" && r.Method == http.MethodPost:
+		err := s.reload()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+			return
+		}
+		log.Println("admin reloaded the configuration")
+		writeJSON(w, http.StatusOK, s.runtimeConfig())
+	case strings.HasPrefix(path, "templates/") && path != "templates/":
+		s.handleTemplate(w, r, strings.TrimPrefix(path, "templates/"))
+	default:
+		writeJSON(w, http.StatusNotFound, SummarizeResponse{Error: "no such admin endpoint"})
+	}
+}
+
+func (s *server) handleTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := loadTemplate(name)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, SummarizeResponse{Error: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, tmpl)
+	case http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+			return
+		}
+		tmpl := strings.TrimSpace(string(data))
+		if tmpl == "" {
+			writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: "the template is empty"})
+			return
+		}
+
+		templateOverrides.Lock()
+		templateOverrides.templates[name] = tmpl
+		templateOverrides.Unlock()
+
+		log.Printf("admin set the prompt template %q", name)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		templateOverrides.Lock()
+		_, ok := templateOverrides.templates[name]
+		delete(templateOverrides.templates, name)
+		templateOverrides.Unlock()
+
+		if !ok {
+			writeJSON(w, http.StatusNotFound, SummarizeResponse{Error: "the template " + name + " was not set at runtime"})
+			return
+		}
+		log.Printf("admin removed the prompt template %q", name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, SummarizeResponse{Error: "method not allowed"})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangeConfigErrors(t *testing.T) {
+	s := &server{adminKey: "admin"}
+
+	tests := []struct {
+		change string
+		err    string
+	}{
+		{`{"rps": -1}`, "rps must not be negative"},
+		{`{"tpm": -1000}`, "tpm must not be negative"},
+		{`{"key_rpm": -0.5}`, "key_rpm must not be negative"},
+		{`{"key_daily_tokens": -1}`, "key_daily_tokens must not be negative"},
+		{`{"model": "anthropic.claude-v2", "rps": -1}`, "rps must not be negative"},
+		{`{"rps": "fast"}`, "cannot unmarshal string"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPatch, "/admin/config", strings.NewReader(tt.change))
+		req.Header.Set("Authorization", "Bearer admin")
+		w := httptest.NewRecorder()
+
+		s.handleAdmin(w, req)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.err) {
+			t.Errorf("%s: got %d %s, want 400 with %q", tt.change, w.Code, strings.TrimSpace(w.Body.String()), tt.err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/schema"
+)
+
+type AgentFlags struct {
+	Agent        string
+	AgentAlias   string
+	AgentSession string
+}
+
+func (f *AgentFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Agent, "agent", "", "ID of the Bedrock agent -mode agent sends -question to")
+	fs.StringVar(&f.AgentAlias, "agent-alias", "TSTALIASID", "alias of the -agent, TSTALIASID for its working draft")
+	fs.StringVar(&f.AgentSession, "agent-session", "", "session of the -agent to continue, a new one when empty")
+}
+
+// Agent invokes a Bedrock agent, which answers with the action groups and knowledge bases it is
+// configured with instead of the model alone. The agent keeps the conversation of a session, so
+// every Invoke of an Agent follows up on the previous ones.
+type Agent struct {
+	CallbacksHandler callbacks.Handler
+	ID               string
+	AliasID          string
+	SessionID        string
+	cfg              aws.Config
+}
+
+func newAgent(id, aliasID, sessionID string) *Agent {
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+
+	return &Agent{ID: id, AliasID: aliasID, SessionID: sessionID, cfg: loadAWSConfig()}
+}
+
+func newSessionID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+func (a *Agent) GetCallbackHandler() callbacks.Handler {
+	return a.CallbacksHandler
+}
+
+// Invoke sends input to the agent in its session and returns its answer. The chunks of the answer
+// are passed to stream as they come, and the steps of the agent to the callbacks handler: its
+// rationale as text, its action group calls as agent actions and tool calls, and its knowledge
+// base lookups as retrievals.
+func (a *Agent) Invoke(ctx context.Context, input string, stream func(ctx context.Context, chunk []byte) error) (_ string, err error) {
+	ctx, span := startSpan(ctx, "agent invoke", spanKindClient, "agent.id", a.ID, "agent.alias", a.AliasID, "agent.session", a.SessionID)
+	defer func() { span.End(err) }()
+
+	handler := a.CallbacksHandler
+	if handler != nil {
+		handler.HandleChainStart(ctx, map[string]any{"input": input, "session_id": a.SessionID})
+	}
+
+	out, err := bedrockagentruntime.NewFromConfig(a.cfg).InvokeAgent(ctx, &bedrockagentruntime.InvokeAgentInput{
+		AgentId:      aws.String(a.ID),
+		AgentAliasId: aws.String(a.AliasID),
+		SessionId:    aws.String(a.SessionID),
+		InputText:    aws.String(input),
+		EnableTrace:  aws.Bool(handler != nil),
+	})
+	if err != nil {
+		return "", fmt.Errorf("agent %s: %w", a.ID, err)
+	}
+	events := out.GetStream()
+	defer events.Close()
+
+	var answer strings.Builder
+	var query string
+
+	for event := range events.Events() {
+		switch event := event.(type) {
+		case *types.ResponseStreamMemberChunk:
+			chunk := event.Value.Bytes
+			answer.Write(chunk)
+			if handler != nil {
+				handler.HandleStreamingFunc(ctx, chunk)
+			}
+			if stream != nil {
+				err = stream(ctx, chunk)
+				if err != nil {
+					return "", err
+				}
+			}
+		case *types.ResponseStreamMemberTrace:
+			if handler != nil {
+				query = handleAgentTrace(ctx, handler, event.Value.Trace, query)
+			}
+		}
+	}
+	if err := events.Err(); err != nil {
+		return "", fmt.Errorf("agent %s: %w", a.ID, err)
+	}
+
+	if handler != nil {
+		handler.HandleChainEnd(ctx, map[string]any{"text": answer.String(), "session_id": a.SessionID})
+	}
+
+	return answer.String(), nil
+}
+
+// handleAgentTrace passes a trace event to handler. query is the text of the knowledge base lookup
+// in progress, which its output is reported with, and the one after the event is returned.
+func handleAgentTrace(ctx context.Context, handler callbacks.Handler, trace types.Trace, query string) string {
+	switch trace := trace.(type) {
+	case *types.TraceMemberFailureTrace:
+		handler.HandleText(ctx, "agent failure: "+aws.ToString(trace.Value.FailureReason))
+	case *types.TraceMemberOrchestrationTrace:
+		switch orchestration := trace.Value.(type) {
+		case *types.OrchestrationTraceMemberRationale:
+			handler.HandleText(ctx, aws.ToString(orchestration.Value.Text))
+		case *types.OrchestrationTraceMemberInvocationInput:
+			input := orchestration.Value
+			if call := input.ActionGroupInvocationInput; call != nil {
+				tool := aws.ToString(call.ActionGroupName) + "::" + aws.ToString(call.Function)
+				if aws.ToString(call.Function) == "" {
+					tool = aws.ToString(call.ActionGroupName) + "::" + aws.ToString(call.Verb) + " " + aws.ToString(call.ApiPath)
+				}
+				parameters := make([]map[string]string, len(call.Parameters))
+				for i, param := range call.Parameters {
+					parameters[i] = map[string]string{"name": aws.ToString(param.Name), "value": aws.ToString(param.Value)}
+				}
+				params, _ := json.Marshal(parameters)
+
+				handler.HandleAgentAction(ctx, schema.AgentAction{Tool: tool, ToolInput: string(params)})
+				handler.HandleToolStart(ctx, string(params))
+			}
+			if lookup := input.KnowledgeBaseLookupInput; lookup != nil {
+				query = aws.ToString(lookup.Text)
+				handler.HandleRetrieverStart(ctx, query)
+			}
+		case *types.OrchestrationTraceMemberObservation:
+			observation := orchestration.Value
+			if output := observation.ActionGroupInvocationOutput; output != nil {
+				handler.HandleToolEnd(ctx, aws.ToString(output.Text))
+			}
+			if output := observation.KnowledgeBaseLookupOutput; output != nil {
+				docs := make([]schema.Document, len(output.RetrievedReferences))
+				for i, ref := range output.RetrievedReferences {
+					docs[i] = schema.Document{PageContent: referenceText(ref.Content), Metadata: map[string]any{"location": referenceSource(ref.Location)}}
+				}
+				handler.HandleRetrieverEnd(ctx, query, docs)
+				query = ""
+			}
+		}
+	}
+
+	return query
+}
+
+// runAgent sends -question to the -agent, or with -interactive every line read from stdin, all in
+// the same session.
+func runAgent(ctx context.Context, f Flags) {
+	if f.Agent == "" || (f.Question == "" && !f.Interactive) {
+		log.Fatal("-mode agent needs an -agent and a -question or -interactive")
+	}
+
+	agent := newAgent(f.Agent, f.AgentAlias, f.AgentSession)
+	if f.Verbose {
+		agent.CallbacksHandler = newLogHandler(os.Stderr)
+	}
+
+	if f.Question != "" {
+		_, err := agent.Invoke(ctx, f.Question, printChunk)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println()
+	}
+
+	if f.Interactive {
+		fmt.Println("ask the agent, end with Ctrl-D")
+
+		scanner := bufio.NewScanner(os.Stdin)
+		for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+			question := strings.TrimSpace(scanner.Text())
+			if question == "" {
+				continue
+			}
+
+			_, err := agent.Invoke(ctx, question, printChunk)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println()
+		}
+		fmt.Println()
+		if err := scanner.Err(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "continue with -agent-session %s\n", agent.SessionID)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	format           = "\n\nHuman:%s\n\nAssistant:"
+	anthropicVersion = "bedrock-2023-05-31"
+)
+
+type Request struct {
+	Prompt            string   `json:"prompt"`
+	MaxTokensToSample int      `json:"max_tokens_to_sample"`
+	Temperature       float64  `json:"temperature,omitempty"`
+	TopP              float64  `json:"top_p,omitempty"`
+	TopK              int      `json:"top_k,omitempty"`
+	StopSequences     []string `json:"stop_sequences,omitempty"`
+}
+
+type MessagesRequest struct {
+	AnthropicVersion string         `json:"anthropic_version"`
+	MaxTokens        int            `json:"max_tokens"`
+	System           string         `json:"system,omitempty"`
+	Messages         []Message      `json:"messages"`
+	Temperature      float64        `json:"temperature,omitempty"`
+	TopP             float64        `json:"top_p,omitempty"`
+	TopK             int            `json:"top_k,omitempty"`
+	StopSequences    []string       `json:"stop_sequences,omitempty"`
+	Tools            []MessagesTool `json:"tools,omitempty"`
+	ToolChoice       *ToolChoice    `json:"tool_choice,omitempty"`
+}
+
+type Message struct {
+	Role    string    `json:"role"`
+	Content []Content `json:"content"`
+}
+
+type Content struct {
+	Type   string         `json:"type"`
+	Text   string         `json:"text,omitempty"`
+	Source *ContentSource `json:"source,omitempty"`
+	// ID, Name and Input are those of a tool_use block, a tool the model calls.
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type ContentSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      []byte `json:"data"`
+}
+
+type MessagesResponse struct {
+	Content    []Content `json:"content"`
+	StopReason string    `json:"stop_reason"`
+	Usage      Usage     `json:"usage"`
+}
+
+type MessagesStreamEvent struct {
+	Type  string  `json:"type"`
+	Delta Content `json:"delta"`
+}
+
+// TextCompletionCodec speaks the legacy Human/Assistant prompt format used by claude-v2 and claude-instant.
+type TextCompletionCodec struct{}
+
+func (TextCompletionCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return json.Marshal(Request{
+		Prompt:            system + fmt.Sprintf(format, prompt),
+		MaxTokensToSample: opts.MaxTokens,
+		Temperature:       opts.Temperature,
+		TopK:              opts.TopK,
+		TopP:              opts.TopP,
+		StopSequences:     opts.StopWords,
+	})
+}
+
+func (TextCompletionCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp Response
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return resp, nil
+}
+
+func (c TextCompletionCodec) DecodeChunk(body []byte) (string, error) {
+	resp, err := c.DecodeResponse(body)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Completion, nil
+}
+
+// MessagesCodec speaks the Messages API required by the claude-3 family. It sends the functions of
+// the call options as tools, and returns the tool the model calls as a function call.
+type MessagesCodec struct{}
+
+func (c MessagesCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return c.EncodeImageRequest(system, prompt, nil, opts)
+}
+
+func (MessagesCodec) EncodeImageRequest(system, prompt string, images []Image, opts *llms.CallOptions) ([]byte, error) {
+	content := make([]Content, 0, len(images)+1)
+	for _, image := range images {
+		content = append(content, Content{Type: "image", Source: &ContentSource{Type: "base64", MediaType: image.MediaType, Data: image.Data}})
+	}
+	content = append(content, Content{Type: "text", Text: prompt})
+
+	tools, toolChoice, err := messagesTools(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(MessagesRequest{
+		AnthropicVersion: anthropicVersion,
+		MaxTokens:        opts.MaxTokens,
+		System:           system,
+		Messages: []Message{
+			{Role: "user", Content: content},
+		},
+		Temperature:   opts.Temperature,
+		TopP:          opts.TopP,
+		TopK:          opts.TopK,
+		StopSequences: opts.StopWords,
+		Tools:         tools,
+		ToolChoice:    toolChoice,
+	})
+}
+
+func (MessagesCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp MessagesResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var completion strings.Builder
+	for _, content := range resp.Content {
+		if content.Type == "text" {
+			completion.WriteString(content.Text)
+		}
+	}
+
+	return Response{Completion: completion.String(), Usage: resp.Usage, ToolCall: toolCall(resp.Content), StopReason: resp.StopReason}, nil
+}
+
+func (MessagesCodec) DecodeChunk(body []byte) (string, error) {
+	var event MessagesStreamEvent
+
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return "", err
+	}
+
+	if event.Type != "content_block_delta" {
+		return "", nil
+	}
+
+	return event.Delta.Text, nil
+}
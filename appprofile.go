@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// WithInferenceProfile invokes the Model through the application inference profile of arn, whose
+// cost allocation tags attribute its token spend to a team or project in Cost Explorer. The Model
+// keeps its ID for its payload format, context window and price.
+func WithInferenceProfile(arn string) ModelOption {
+	return func(m *Model) {
+		m.inferenceProfile = arn
+	}
+}
+
+// invokeID is the ID the Model is invoked with.
+func (m *Model) invokeID() string {
+	if m.inferenceProfile != "" {
+		return m.inferenceProfile
+	}
+
+	return m.modelID
+}
+
+// isApplicationProfile reports whether modelID is the ARN of an application inference profile,
+// whose ID does not tell the model it calls.
+func isApplicationProfile(modelID string) bool {
+	return strings.HasPrefix(modelID, "arn:") && strings.Contains(modelID, ":application-inference-profile/")
+}
+
+// lookupProfileModel asks Bedrock which foundation model an application inference profile calls.
+func lookupProfileModel(ctx context.Context, profileARN string) (string, error) {
+	cfg := loadAWSConfig()
+	if region := arnRegion(profileARN); region != "" {
+		cfg.Region = region
+	}
+
+	profile, err := bedrock.NewFromConfig(cfg).GetInferenceProfile(ctx, &bedrock.GetInferenceProfileInput{InferenceProfileIdentifier: aws.String(profileARN)})
+	if err != nil {
+		return "", err
+	}
+	if len(profile.Models) == 0 {
+		return "", fmt.Errorf("%s has no model", profileARN)
+	}
+
+	return baseModelID(aws.ToString(profile.Models[0].ModelArn)), nil
+}
+
+type ProfilesFlags struct {
+	AWSFlags
+	Name        string
+	Model       string
+	Tags        string
+	Description string
+}
+
+func parseProfilesFlags(args []string) ProfilesFlags {
+	var f ProfilesFlags
+
+	fs := flag.NewFlagSet("profiles", flag.ExitOnError)
+	fs.StringVar(&f.Name, "name", "", "name of the application inference profile to create, empty to list those of the region")
+	fs.StringVar(&f.Model, "model", modelID, "Bedrock model ID or cross-region inference profile the created profile calls")
+	fs.StringVar(&f.Tags, "tags", "", "comma separated key=value cost allocation tags of the created profile, e.g. team=search,project=digest")
+	fs.StringVar(&f.Description, "description", "", "description of the created profile")
+	f.AWSFlags.register(fs)
+	_ = fs.Parse(args)
+
+	return f
+}
+
+// profileTags parses the key=value pairs of -tags.
+func profileTags(s string) ([]types.Tag, error) {
+	var tags []types.Tag
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("tag %q is not key=value", pair)
+		}
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return tags, nil
+}
+
+// profileSource returns the ARN of the foundation model or cross-region inference profile of
+// modelID, which an application inference profile copies.
+func profileSource(ctx context.Context, cfg aws.Config, modelID string) (string, error) {
+	if strings.HasPrefix(modelID, "arn:") {
+		return modelID, nil
+	}
+	if baseModelID(modelID) == modelID {
+		return fmt.Sprintf("arn:aws:bedrock:%s::foundation-model/%s", cfg.Region, modelID), nil
+	}
+
+	// Cross-region inference profiles belong to the account calling them.
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("arn:aws:bedrock:%s:%s:inference-profile/%s", cfg.Region, aws.ToString(identity.Account), modelID), nil
+}
+
+// createInferenceProfile creates an application inference profile of the -model with the -tags and
+// returns its ARN.
+func createInferenceProfile(ctx context.Context, cfg aws.Config, f ProfilesFlags) (string, error) {
+	tags, err := profileTags(f.Tags)
+	if err != nil {
+		return "", err
+	}
+	source, err := profileSource(ctx, cfg, f.Model)
+	if err != nil {
+		return "", err
+	}
+
+	in := &bedrock.CreateInferenceProfileInput{
+		InferenceProfileName: aws.String(f.Name),
+		ModelSource:          &types.InferenceProfileModelSourceMemberCopyFrom{Value: source},
+		Tags:                 tags,
+	}
+	if f.Description != "" {
+		in.Description = aws.String(f.Description)
+	}
+
+	out, err := bedrock.NewFromConfig(cfg).CreateInferenceProfile(ctx, in)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(out.InferenceProfileArn), nil
+}
+
+// listInferenceProfiles calls ListInferenceProfiles for the application inference profiles of the region.
+func listInferenceProfiles(ctx context.Context, cfg aws.Config) ([]types.InferenceProfileSummary, error) {
+	var profiles []types.InferenceProfileSummary
+
+	paginator := bedrock.NewListInferenceProfilesPaginator(bedrock.NewFromConfig(cfg), &bedrock.ListInferenceProfilesInput{
+		TypeEquals: types.InferenceProfileTypeApplication,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, page.InferenceProfileSummaries...)
+	}
+
+	return profiles, nil
+}
+
+// runProfiles creates an application inference profile with -name, or lists those of the region,
+// for the profiles subcommand. Its ARN is then given to -inference-profile, or as the -model.
+func runProfiles(f ProfilesFlags) {
+	awsFlags = f.AWSFlags
+	cfg := loadAWSConfig()
+	ctx := context.Background()
+
+	if f.Name != "" {
+		arn, err := createInferenceProfile(ctx, cfg, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(arn)
+		return
+	}
+
+	profiles, err := listInferenceProfiles(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tMODEL\tSTATUS\tARN")
+	for _, p := range profiles {
+		model := ""
+		if len(p.Models) > 0 {
+			model = baseModelID(aws.ToString(p.Models[0].ModelArn))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", aws.ToString(p.InferenceProfileName), model, p.Status, aws.ToString(p.InferenceProfileArn))
+	}
+	err = w.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// arxivIDPattern matches the new (2301.01234v2) and old (hep-th/9901001) arXiv identifiers.
+var arxivIDPattern = regexp.MustCompile(`^(\d{4}\.\d{4,5}|[a-z-]+(\.[A-Z]{2})?/\d{7})(v\d+)?$`)
+
+type arxivFeed struct {
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Summary   string `xml:"summary"`
+		Published string `xml:"published"`
+		Authors   []struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+// arxivID returns the identifier of an arXiv abs, pdf or html link, or of a source such as
+// arxiv:2301.01234.
+func arxivID(source string) (string, bool) {
+	var id string
+	if rest, ok := strings.CutPrefix(source, "arxiv:"); ok {
+		id = rest
+	} else {
+		u, err := url.Parse(source)
+		if err != nil {
+			return "", false
+		}
+		host := strings.TrimPrefix(u.Hostname(), "www.")
+		if host != "arxiv.org" && host != "export.arxiv.org" {
+			return "", false
+		}
+		for _, prefix := range []string{"/abs/", "/pdf/", "/html/"} {
+			if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+				id = strings.TrimSuffix(strings.TrimSuffix(rest, "/"), ".pdf")
+			}
+		}
+	}
+
+	return id, arxivIDPattern.MatchString(id)
+}
+
+// getDocsFromArxiv loads an arXiv paper: its title, authors, categories and abstract from the arXiv
+// API, then its full text, from the HTML version when arXiv has one and the PDF otherwise.
+func getDocsFromArxiv(ctx context.Context, source string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading arXiv paper", source)
+
+	id, _ := arxivID(source)
+
+	data, err := fetchBytes(ctx, "https://export.arxiv.org/api/query?id_list="+url.QueryEscape(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var feed arxivFeed
+
+	err = xml.Unmarshal(data, &feed)
+	if err != nil {
+		return nil, err
+	}
+	// An unknown identifier is answered with an entry holding an error.
+	if len(feed.Entries) == 0 || feed.Entries[0].Title == "Error" {
+		return nil, fmt.Errorf("no arXiv paper %s", id)
+	}
+	entry := feed.Entries[0]
+
+	title := strings.Join(strings.Fields(entry.Title), " ")
+	authors := make([]string, len(entry.Authors))
+	for i, author := range entry.Authors {
+		authors[i] = author.Name
+	}
+	categories := make([]string, len(entry.Categories))
+	for i, category := range entry.Categories {
+		categories[i] = category.Term
+	}
+	link := "https://arxiv.org/abs/" + id
+
+	metadata := func(kind string) map[string]any {
+		return map[string]any{
+			"source":     link,
+			"kind":       kind,
+			"arxiv_id":   id,
+			"title":      title,
+			"authors":    strings.Join(authors, ", "),
+			"categories": strings.Join(categories, ", "),
+			"published":  entry.Published,
+		}
+	}
+
+	docs := []schema.Document{{
+		PageContent: fmt.Sprintf("# %s\n\nAuthors: %s\nPublished: %s\nCategories: %s\n\n## Abstract\n\n%s",
+			title, strings.Join(authors, ", "), entry.Published, strings.Join(categories, ", "), strings.TrimSpace(entry.Summary)),
+		Metadata: metadata("abstract"),
+	}}
+
+	text, err := arxivFullText(ctx, id, l)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range text {
+		doc.Metadata = metadata("paper")
+		docs = append(docs, doc)
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded arXiv paper", title)
+
+	return docs, nil
+}
+
+// arxivFullText loads the HTML version of a paper, or its PDF when it has none.
+func arxivFullText(ctx context.Context, id string, l LoaderFlags) ([]schema.Document, error) {
+	resp, err := fetch(ctx, "https://arxiv.org/html/"+id)
+	if err == nil {
+		defer resp.Body.Close()
+		return loadDocs(ctx, resp.Body, "html", l)
+	}
+
+	resp, err = fetch(ctx, "https://arxiv.org/pdf/"+id)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return loadDocs(ctx, resp.Body, "pdf", l)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type AuditFlags struct {
+	Audit       string
+	AuditRedact string
+	Replay      string
+}
+
+func (f *AuditFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Audit, "audit", "", "JSONL file every prompt and response sent to Bedrock is appended to, or dynamodb:TABLE to put them in a DynamoDB table keyed by a string id")
+	fs.StringVar(&f.AuditRedact, "audit-redact", "email,phone,card", "comma separated personal data removed from the audit log: email, phone, card, ip, or none")
+	fs.StringVar(&f.Replay, "replay", "", "JSONL -audit log whose recorded responses answer the prompts instead of Bedrock, so that chain and parser changes are tested offline and deterministically")
+}
+
+// auditor returns the Auditor the flags describe, or nil without -audit.
+func (f AuditFlags) auditor() (*Auditor, error) {
+	if f.Audit == "" {
+		return nil, nil
+	}
+
+	a := &Auditor{}
+	var err error
+	a.Redactors, err = f.redactors()
+	if err != nil {
+		return nil, err
+	}
+
+	if table, ok := strings.CutPrefix(f.Audit, "dynamodb:"); ok {
+		a.Sink = &DynamoDBAuditSink{client: dynamodb.NewFromConfig(loadAWSConfig()), Table: table}
+		return a, nil
+	}
+
+	sink, err := newFileAuditSink(f.Audit)
+	if err != nil {
+		return nil, err
+	}
+	a.Sink = sink
+
+	return a, nil
+}
+
+// cassette returns the Cassette of -replay, or nil without it.
+func (f AuditFlags) cassette() (*Cassette, error) {
+	if f.Replay == "" {
+		return nil, nil
+	}
+
+	redactors, err := f.redactors()
+	if err != nil {
+		return nil, err
+	}
+
+	return loadCassette(f.Replay, redactors)
+}
+
+// redactors returns the Redactors of -audit-redact, in the order they apply.
+func (f AuditFlags) redactors() ([]Redactor, error) {
+	redact := map[string]bool{}
+	for _, name := range strings.Split(f.AuditRedact, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		if !slices.ContainsFunc(redactors, func(r namedRedactor) bool { return r.name == name }) {
+			return nil, fmt.Errorf("unknown -audit-redact %q", name)
+		}
+		redact[name] = true
+	}
+
+	var enabled []Redactor
+	for _, r := range redactors {
+		if redact[r.name] {
+			enabled = append(enabled, r.redact)
+		}
+	}
+
+	return enabled, nil
+}
+
+// AuditRecord is one invocation of a Bedrock model: what was sent and what came back.
+type AuditRecord struct {
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	ModelID      string    `json:"model_id"`
+	System       string    `json:"system,omitempty"`
+	Prompt       string    `json:"prompt"`
+	Response     string    `json:"response"`
+	StopReason   string    `json:"stop_reason,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	LatencyMS    int64     `json:"latency_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// AuditSink stores audit records without ever changing those already stored.
+type AuditSink interface {
+	Write(ctx context.Context, record AuditRecord) error
+}
+
+// Redactor removes personal data from a text before it is audited.
+type Redactor func(string) string
+
+func patternRedactor(pattern, replacement string) Redactor {
+	re := regexp.MustCompile(pattern)
+	return func(s string) string {
+		return re.ReplaceAllString(s, replacement)
+	}
+}
+
+type namedRedactor struct {
+	name   string
+	redact Redactor
+}
+
+// The patterns of the personal data found in texts, shared with -pii.
+const (
+	emailPattern = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`
+	phonePattern = `(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`
+)
+
+// redactors are the built-in Redactors by their -audit-redact name, in the order they apply so
+// that card numbers and addresses are not taken for phone numbers.
+var redactors = []namedRedactor{
+	{"email", patternRedactor(emailPattern, "[EMAIL]")},
+	{"card", patternRedactor(`\b(?:\d[ -]?){12,18}\d\b`, "[CARD]")},
+	{"ip", patternRedactor(`\b(?:\d{1,3}\.){3}\d{1,3}\b`, "[IP]")},
+	{"phone", patternRedactor(phonePattern, "[PHONE]")},
+}
+
+// Auditor records every Bedrock invocation of a Model, after passing its texts through the Redactors.
+type Auditor struct {
+	Sink      AuditSink
+	Redactors []Redactor
+}
+
+// Close closes the sink of the Auditor, when it has to be, once no more invocations are recorded.
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+	if closer, ok := a.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (a *Auditor) redact(s string) string {
+	for _, redactor := range a.Redactors {
+		s = redactor(s)
+	}
+
+	return s
+}
+
+// record writes r to the sink. A failure is logged rather than failing the invocation it records.
+func (a *Auditor) record(ctx context.Context, r AuditRecord) {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	r.ID = hex.EncodeToString(id[:])
+	r.System = a.redact(r.System)
+	r.Prompt = a.redact(r.Prompt)
+	r.Response = a.redact(r.Response)
+
+	// The record is written even when the invocation was canceled.
+	err := a.Sink.Write(context.WithoutCancel(ctx), r)
+	if err != nil {
+		log.Printf("writing the audit record of %s: %v", r.ModelID, err)
+	}
+}
+
+// FileAuditSink appends the records, one JSON object per line, to a file.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{file: file}, nil
+}
+
+// Close writes the records to the disk and closes the file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.file.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (s *FileAuditSink) Write(_ context.Context, record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// DynamoDBAuditSink puts each record as an item of a table whose partition key is the string "id".
+type DynamoDBAuditSink struct {
+	client *dynamodb.Client
+	Table  string
+}
+
+func (s *DynamoDBAuditSink) Write(ctx context.Context, record AuditRecord) error {
+	str := func(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+	num := func(v int64) types.AttributeValue {
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(v, 10)}
+	}
+
+	item := map[string]types.AttributeValue{
+		"id":            str(record.ID),
+		"time":          str(record.Time.Format(time.RFC3339Nano)),
+		"model_id":      str(record.ModelID),
+		"prompt":        str(record.Prompt),
+		"response":      str(record.Response),
+		"input_tokens":  num(int64(record.InputTokens)),
+		"output_tokens": num(int64(record.OutputTokens)),
+		"latency_ms":    num(record.LatencyMS),
+	}
+	if record.System != "" {
+		item["system"] = str(record.System)
+	}
+	if record.StopReason != "" {
+		item["stop_reason"] = str(record.StopReason)
+	}
+	if record.Error != "" {
+		item["error"] = str(record.Error)
+	}
+
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item:      item,
+		// The log is append-only, an existing record is never replaced.
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	return err
+}
+
+// audit records an invocation of the Model with its Auditor, if it has one.
+func (m *Model) audit(ctx context.Context, start time.Time, latency time.Duration, prompt string, resp Response, err error) {
+	if m.Auditor == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Time:         start.UTC(),
+		ModelID:      m.modelID,
+		System:       m.system,
+		Prompt:       prompt,
+		Response:     resp.Completion,
+		StopReason:   resp.StopReason,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+		LatencyMS:    latency.Milliseconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	m.Auditor.record(ctx, record)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AuthFlags struct {
+	APIKeys        string
+	JWTSecret      string
+	JWKSURL        string
+	JWTIssuer      string
+	JWTAudience    string
+	KeyRPM         float64
+	KeyDailyTokens int
+}
+
+func (f *AuthFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.APIKeys, "api-keys", "", `JSON file of the clients allowed to call the server, [{"name", "key", "rpm", "daily_tokens"}], sending their key as a bearer token or in X-Api-Key`)
+	fs.StringVar(&f.JWTSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "secret of the HS256 JSON Web Tokens clients may authenticate with instead of a key, the client being their sub")
+	fs.StringVar(&f.JWKSURL, "jwks-url", "", "URL of the JSON Web Key Set of the RS256 JSON Web Tokens clients may authenticate with instead of a key")
+	fs.StringVar(&f.JWTIssuer, "jwt-issuer", "", "iss a JSON Web Token must have, any when empty")
+	fs.StringVar(&f.JWTAudience, "jwt-audience", "", "aud a JSON Web Token must have, any when empty")
+	fs.Float64Var(&f.KeyRPM, "key-rpm", 0, "requests per minute of each client, unless its -api-keys entry sets rpm, 0 for no limit")
+	fs.IntVar(&f.KeyDailyTokens, "key-daily-tokens", 0, "Bedrock tokens each client may use per UTC day, unless its -api-keys entry sets daily_tokens, 0 for no limit")
+}
+
+// APIClient is a client of the server and its quotas, 0 for those of the flags.
+type APIClient struct {
+	Name        string  `json:"name"`
+	Key         string  `json:"key"`
+	RPM         float64 `json:"rpm"`
+	DailyTokens int     `json:"daily_tokens"`
+	// jwt is set for the subject of a JSON Web Token, rather than a client of -api-keys.
+	jwt bool
+}
+
+// quotaKey keys the quotas of the client, apart for the clients of -api-keys and the subjects of
+// tokens, which may have the same name.
+func (c APIClient) quotaKey() string {
+	if c.jwt {
+		return "jwt:" + c.Name
+	}
+
+	return "key:" + c.Name
+}
+
+// clientQuota is what a client used of its quotas.
+type clientQuota struct {
+	requests bucket
+	day      string
+	tokens   int
+}
+
+// Authenticator admits the requests of the clients of -api-keys and of valid JSON Web Tokens,
+// within the requests per minute and the daily tokens of each client. It admits every request
+// while its flags configure no authentication.
+type Authenticator struct {
+	mu     sync.Mutex
+	flags  AuthFlags
+	keys   map[[32]byte]APIClient
+	jwks   *jwksCache
+	quotas map[string]*clientQuota
+	// day is the latest UTC day of the quotas, those of the days before it being dropped.
+	day string
+}
+
+func newAuthenticator(f AuthFlags) (*Authenticator, error) {
+	a := &Authenticator{quotas: map[string]*clientQuota{}}
+
+	return a, a.reload(f)
+}
+
+// reload makes f the flags of the Authenticator, reading -api-keys again. The quotas the clients
+// used are kept.
+func (a *Authenticator) reload(f AuthFlags) error {
+	keys := map[[32]byte]APIClient{}
+	if f.APIKeys != "" {
+		data, err := os.ReadFile(f.APIKeys)
+		if err != nil {
+			return err
+		}
+
+		var clients []APIClient
+
+		err = json.Unmarshal(data, &clients)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.APIKeys, err)
+		}
+		for _, client := range clients {
+			if client.Name == "" || client.Key == "" {
+				return fmt.Errorf("%s: every client needs a name and a key", f.APIKeys)
+			}
+			// The keys are looked up by their hash, which takes as long whatever key is sent.
+			keys[sha256.Sum256([]byte(client.Key))] = client
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if f.JWKSURL == "" {
+		a.jwks = nil
+	} else if a.jwks == nil || a.jwks.url != f.JWKSURL {
+		a.jwks = &jwksCache{url: f.JWKSURL}
+	}
+	a.flags = f
+	a.keys = keys
+
+	return nil
+}
+
+// setQuotas changes the quotas of the clients whose -api-keys entry sets none.
+func (a *Authenticator) setQuotas(rpm float64, dailyTokens int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.flags.KeyRPM = rpm
+	a.flags.KeyDailyTokens = dailyTokens
+}
+
+func (a *Authenticator) settings() (AuthFlags, map[[32]byte]APIClient, *jwksCache) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.flags, a.keys, a.jwks
+}
+
+// authenticate returns the client sending credential, a key or a JSON Web Token.
+func (a *Authenticator) authenticate(ctx context.Context, credential string) (APIClient, error) {
+	if credential == "" {
+		return APIClient{}, errors.New("an API key or a bearer token is required")
+	}
+
+	flags, keys, jwks := a.settings()
+	if client, ok := keys[sha256.Sum256([]byte(credential))]; ok {
+		return client, nil
+	}
+	if (flags.JWTSecret == "" && jwks == nil) || strings.Count(credential, ".") != 2 {
+		return APIClient{}, errors.New("invalid API key")
+	}
+
+	subject, err := verifyJWT(ctx, credential, flags, jwks)
+	if err != nil {
+		return APIClient{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	return APIClient{Name: subject, jwt: true}, nil
+}
+
+// admit takes a request of client from its quotas, or returns how long until it is admitted.
+func (a *Authenticator) admit(client APIClient, now time.Time) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rpm := client.RPM
+	if rpm == 0 {
+		rpm = a.flags.KeyRPM
+	}
+	budget := client.DailyTokens
+	if budget == 0 {
+		budget = a.flags.KeyDailyTokens
+	}
+
+	quota := a.quota(client.quotaKey(), now)
+	if budget > 0 && quota.tokens >= budget {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return midnight.Sub(now), fmt.Errorf("the daily budget of %d tokens of %s is spent", budget, client.Name)
+	}
+
+	quota.requests.rate = rpm / 60
+	quota.requests.burst = max(rpm, 1)
+	if wait := quota.requests.take(now, 1); wait > 0 {
+		// The request is turned down, so it gives back what it took.
+		quota.requests.level++
+		return wait, fmt.Errorf("%s is over its %g requests per minute", client.Name, rpm)
+	}
+
+	return 0, nil
+}
+
+// quota returns the quota of the client of key on the day of now, dropping those of the clients
+// last seen on a day before it.
+func (a *Authenticator) quota(key string, now time.Time) *clientQuota {
+	day := now.UTC().Format(time.DateOnly)
+	if day > a.day {
+		for k, quota := range a.quotas {
+			if quota.day < day {
+				delete(a.quotas, k)
+			}
+		}
+		a.day = day
+	}
+
+	quota, ok := a.quotas[key]
+	if !ok {
+		quota = &clientQuota{requests: bucket{level: math.MaxFloat64, last: now}, day: day}
+		a.quotas[key] = quota
+	}
+	if quota.day != day {
+		quota.day = day
+		quota.tokens = 0
+	}
+
+	return quota
+}
+
+// spend adds the tokens a request of client used to those of its day.
+func (a *Authenticator) spend(client APIClient, usage Usage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.quota(client.quotaKey(), time.Now()).tokens += usage.InputTokens + usage.OutputTokens
+}
+
+// middleware answers the requests of unknown clients with 401 and those over their quotas with
+// 429 and a Retry-After, and passes the others on to next.
+func (a *Authenticator) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if flags, _, _ := a.settings(); flags.APIKeys == "" && flags.JWTSecret == "" && flags.JWKSURL == "" {
+			next(w, r)
+			return
+		}
+
+		credential := r.Header.Get("X-Api-Key")
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			credential = token
+		}
+
+		client, err := a.authenticate(r.Context(), credential)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, SummarizeResponse{Error: err.Error()})
+			return
+		}
+
+		wait, err := a.admit(client, time.Now())
+		if err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSON(w, http.StatusTooManyRequests, SummarizeResponse{Error: err.Error()})
+			return
+		}
+
+		ctx, meter := withUsageMeter(r.Context())
+		defer func() { a.spend(client, meter.total()) }()
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// verifyJWT checks the signature, the lifetime, the issuer and the audience of token, and returns
+// its subject.
+func verifyJWT(ctx context.Context, token string, flags AuthFlags, jwks *jwksCache) (string, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	var claims jwtClaims
+
+	err := decodeJWTPart(parts[0], &header)
+	if err != nil {
+		return "", err
+	}
+	err = decodeJWTPart(parts[1], &claims)
+	if err != nil {
+		return "", err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && flags.JWTSecret != "":
+		mac := hmac.New(sha256.New, []byte(flags.JWTSecret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return "", errors.New("bad signature")
+		}
+	case header.Alg == "RS256" && jwks != nil:
+		key, err := jwks.key(ctx, header.Kid)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(signed)
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature)
+		if err != nil {
+			return "", errors.New("bad signature")
+		}
+	default:
+		return "", fmt.Errorf("unexpected algorithm %q", header.Alg)
+	}
+
+	now := float64(time.Now().Unix())
+	switch {
+	case claims.ExpiresAt == nil || now >= *claims.ExpiresAt:
+		return "", errors.New("expired")
+	case claims.NotBefore != nil && now < *claims.NotBefore:
+		return "", errors.New("not valid yet")
+	case flags.JWTIssuer != "" && claims.Issuer != flags.JWTIssuer:
+		return "", fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case flags.JWTAudience != "" && !claims.hasAudience(flags.JWTAudience):
+		return "", errors.New("unexpected audience")
+	case claims.Subject == "":
+		return "", errors.New("no subject")
+	}
+
+	return claims.Subject, nil
+}
+
+// hasAudience tells whether aud, a string or an array of them, has audience.
+func (c jwtClaims) hasAudience(audience string) bool {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return one == audience
+	}
+
+	var many []string
+	return json.Unmarshal(c.Audience, &many) == nil && slices.Contains(many, audience)
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// jwksCache keeps the RSA keys of a JSON Web Key Set, fetched again when a token is signed with a
+// key it does not have, as the keys of an identity provider rotate.
+type jwksCache struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	// An unknown key does not fetch the set more than once a minute.
+	if time.Since(c.fetched) < time.Minute {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	keys, err := fetchJWKS(ctx, c.url)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.fetched = time.Now()
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	return key, nil
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return keys, nil
+}
+
+// usageMeter adds up the tokens of the Model calls of a request.
+type usageMeter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+type usageMeterKey struct{}
+
+func withUsageMeter(ctx context.Context) (context.Context, *usageMeter) {
+	meter := &usageMeter{}
+	return context.WithValue(ctx, usageMeterKey{}, meter), meter
+}
+
+func usageMeterFrom(ctx context.Context) *usageMeter {
+	meter, _ := ctx.Value(usageMeterKey{}).(*usageMeter)
+	return meter
+}
+
+func (m *usageMeter) add(usage Usage) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage.InputTokens += usage.InputTokens
+	m.usage.OutputTokens += usage.OutputTokens
+}
+
+func (m *usageMeter) total() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.usage
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT returns a token of claims whose header says alg, signed with secret by HMAC-SHA256.
+func signJWT(t *testing.T, alg, secret string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	flags := AuthFlags{JWTSecret: "s3cret", JWTIssuer: "https://issuer.example.com", JWTAudience: "summarizer"}
+	now := time.Now().Unix()
+	valid := map[string]any{"sub": "alice", "iss": flags.JWTIssuer, "aud": "summarizer", "exp": now + 60}
+
+	with := func(changes map[string]any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		// err is a part of the error message, empty when the token is valid.
+		err string
+	}{
+		{"valid", signJWT(t, "HS256", "s3cret", valid), ""},
+		{"audience array", signJWT(t, "HS256", "s3cret", with(map[string]any{"aud": []string{"other", "summarizer"}})), ""},
+		{"started", signJWT(t, "HS256", "s3cret", with(map[string]any{"nbf": now - 60})), ""},
+		{"bad signature", signJWT(t, "HS256", "other", valid), "bad signature"},
+		{"unexpected algorithm", signJWT(t, "none", "s3cret", valid), `unexpected algorithm "none"`},
+		{"RS256 without a key set", signJWT(t, "RS256", "s3cret", valid), `unexpected algorithm "RS256"`},
+		{"expired", signJWT(t, "HS256", "s3cret", with(map[string]any{"exp": now - 1})), "expired"},
+		{"no expiry", signJWT(t, "HS256", "s3cret", with(map[string]any{"exp": nil})), "expired"},
+		{"not valid yet", signJWT(t, "HS256", "s3cret", with(map[string]any{"nbf": now + 60})), "not valid yet"},
+		{"other issuer", signJWT(t, "HS256", "s3cret", with(map[string]any{"iss": "https://evil.example.com"})), "unexpected issuer"},
+		{"other audience", signJWT(t, "HS256", "s3cret", with(map[string]any{"aud": []string{"other"}})), "unexpected audience"},
+		{"no subject", signJWT(t, "HS256", "s3cret", with(map[string]any{"sub": nil})), "no subject"},
+		{"malformed", "a.b.c", "illegal base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := verifyJWT(context.Background(), tt.token, flags, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject != "alice" {
+				t.Errorf("got subject %q, want alice", subject)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(keys, []byte(`[{"name": "batch", "key": "k-123", "rpm": 2}]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newAuthenticator(AuthFlags{APIKeys: keys, JWTSecret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signJWT(t, "HS256", "s3cret", map[string]any{"sub": "alice", "exp": time.Now().Unix() + 60})
+
+	tests := []struct {
+		name       string
+		credential string
+		// client is the name of the authenticated client, empty when it is turned down.
+		client string
+	}{
+		{"API key", "k-123", "batch"},
+		{"token", token, "alice"},
+		{"unknown key", "k-456", ""},
+		{"forged token", signJWT(t, "HS256", "guess", map[string]any{"sub": "alice", "exp": time.Now().Unix() + 60}), ""},
+		{"nothing", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := a.authenticate(context.Background(), tt.credential)
+			if tt.client == "" {
+				if err == nil {
+					t.Fatalf("got client %q, want an error", client.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Name != tt.client {
+				t.Errorf("got client %q, want %q", client.Name, tt.client)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorReloadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		err  string
+	}{
+		{"invalid JSON", `{`, "unexpected end of JSON input"},
+		{"no key", `[{"name": "batch"}]`, "every client needs a name and a key"},
+		{"no name", `[{"key": "k-123"}]`, "every client needs a name and a key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			err := os.WriteFile(path, []byte(tt.keys), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = newAuthenticator(AuthFlags{APIKeys: path})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want one with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	a, err := newAuthenticator(AuthFlags{KeyRPM: 1, KeyDailyTokens: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 23, 57, 0, 0, time.UTC)
+
+	steps := []struct {
+		name   string
+		client APIClient
+		at     time.Time
+		spend  int
+		// wait is how long the request is turned down for, 0 when it is admitted.
+		wait time.Duration
+	}{
+		{"first", APIClient{Name: "a"}, now, 0, 0},
+		{"over the flag rpm", APIClient{Name: "a"}, now, 0, time.Minute},
+		{"a minute later", APIClient{Name: "a"}, now.Add(time.Minute), 100, 0},
+		{"budget spent", APIClient{Name: "a"}, now.Add(2 * time.Minute), 0, time.Minute},
+		{"token of the same name", APIClient{Name: "a", jwt: true}, now.Add(2 * time.Minute), 0, 0},
+		{"next day", APIClient{Name: "a"}, now.Add(3 * time.Minute), 0, 0},
+		{"own rpm", APIClient{Name: "b", RPM: 2}, now, 0, 0},
+		{"own burst", APIClient{Name: "b", RPM: 2}, now, 0, 0},
+		{"over its own rpm", APIClient{Name: "b", RPM: 2}, now, 0, 30 * time.Second},
+	}
+
+	for _, step := range steps {
+		wait, err := a.admit(step.client, step.at)
+		if (err != nil) != (step.wait > 0) || wait.Round(time.Millisecond) != step.wait {
+			t.Fatalf("%s: got wait %s and error %v, want wait %s", step.name, wait, err, step.wait)
+		}
+		if step.spend > 0 {
+			a.mu.Lock()
+			a.quota(step.client.quotaKey(), step.at).tokens += step.spend
+			a.mu.Unlock()
+		}
+	}
+
+	// A client seen two days later drops the quotas of the others.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.quota(APIClient{Name: "c"}.quotaKey(), now.Add(48*time.Hour))
+	if len(a.quotas) != 1 {
+		t.Errorf("got %d quotas, want only the one of c", len(a.quotas))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type AWSFlags struct {
+	Region  string
+	Profile string
+	RoleARN string
+	// FailoverRegions are tried, in order, for a model not enabled in Region.
+	FailoverRegions string
+}
+
+var awsFlags AWSFlags
+
+func (f *AWSFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Region, "region", os.Getenv("AWS_REGION"), "AWS region Bedrock is called in")
+	fs.StringVar(&f.Profile, "profile", os.Getenv("AWS_PROFILE"), "shared config profile")
+	fs.StringVar(&f.RoleARN, "role-arn", os.Getenv("BEDROCK_ROLE_ARN"), "IAM role to assume before calling AWS")
+	fs.StringVar(&f.FailoverRegions, "failover-regions", os.Getenv("BEDROCK_FAILOVER_REGIONS"), "comma separated regions to call a model in when it is not enabled in -region nor through its cross-region inference profile")
+}
+
+func loadAWSConfig() aws.Config {
+	var opts []func(*config.LoadOptions) error
+	if awsFlags.Region != "" {
+		opts = append(opts, config.WithRegion(awsFlags.Region))
+	}
+	if awsFlags.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(awsFlags.Profile))
+	}
+	client, err := transportFlags.awsHTTPClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if client != nil {
+		opts = append(opts, config.WithHTTPClient(client))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if awsFlags.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), awsFlags.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "bedrock-langchain"
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg
+}
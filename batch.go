@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/chains"
+)
+
+// batchItemKey gives each batch item its own context so callbacks can tell concurrent runs apart.
+type batchItemKey struct{}
+
+type BatchResult struct {
+	URL     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	Short   string `json:"short,omitempty"`
+	Model   string `json:"model,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readURLs reads one source per line from path, or from stdin when path is "-".
+func readURLs(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var urls []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+
+	return urls, scanner.Err()
+}
+
+func summarizeSource(ctx context.Context, large *Model, source string, f Flags) (string, error) {
+	docs, err := loadDocuments(ctx, source, getDocs, f.LoaderFlags, f.SplitterFlags)
+	if err != nil {
+		return "", err
+	}
+
+	if f.Incremental {
+		docs, err = summarizeChanged(ctx, large, f.CacheFlags.Dir, source, docs, f.MaxTokens, f.Temperature)
+		if err != nil {
+			return "", err
+		}
+	}
+	if f.Hierarchical {
+		docs, err = condense(ctx, large, docs, large.DocumentBudget(f.MaxTokens), f.MaxTokens, f.Temperature)
+		if err != nil {
+			return "", err
+		}
+	}
+	docs = fitDocuments(large, docs, large.DocumentBudget(f.MaxTokens))
+
+	var mismatch *LanguageMismatchError
+
+	summary, err := summarizeIn(ctx, large, docs, f.Prompt, f.Lang, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature), chains.WithTopP(f.TopP), chains.WithTopK(f.TopK))
+	if err != nil && !errors.As(err, &mismatch) {
+		return "", err
+	}
+	langErr := err
+
+	if f.hashtags > 0 {
+		summary, err = fixHashtags(ctx, large, summary, f.hashtags)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return summary, langErr
+}
+
+// summarizeBatch summarizes every source with at most workers concurrent runs, keeping the input order in the results.
+// A source may be a JSON line of its own model and sampling, see parseBatchLine. The sources the
+// Checkpoints of ctx have summarized already are not summarized again.
+func summarizeBatch(ctx context.Context, large *Model, sources []string, workers int, f Flags) []BatchResult {
+	results := make([]BatchResult, len(sources))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				source, overrides, err := parseBatchLine(sources[i])
+				if checkpoint, ok := checkpointsFrom(ctx).get(source); ok && checkpoint.reached("summarized") && checkpoint.Result != nil {
+					results[i] = *checkpoint.Result
+					continue
+				}
+				results[i].URL = source
+
+				itemLarge, itemFlags := large, overrides.apply(f)
+				if err == nil && overrides.Model != "" {
+					itemLarge, err = modelSetFrom(ctx).get(overrides.Model)
+				}
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+
+				itemCtx := context.WithValue(ctx, batchItemKey{}, i)
+				start := time.Now()
+
+				answerCtx, answer := withAnswerRecord(itemCtx)
+				summary, err := summarizeSource(answerCtx, itemLarge, source, itemFlags)
+				results[i].Summary = summary
+				results[i].Model = answer.ModelID()
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+
+				if summary != "" && f.CharLimit > 0 {
+					results[i].Short, err = fitCharLimit(itemCtx, itemLarge, summary, f.CharLimit, f.hashtags)
+					if err != nil {
+						results[i].Error = err.Error()
+					}
+				}
+
+				summarizeSeconds.WithLabelValues(outcome(results[i].Summary != "")).Observe(time.Since(start).Seconds())
+				if results[i].Summary != "" {
+					result := results[i]
+					checkpointsFrom(ctx).mark(itemCtx, source, "summarized", 0, &result)
+				}
+			}
+		}()
+	}
+
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func writeReport(w io.Writer, format string, results []BatchResult) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		err := cw.Write([]string{"url", "title", "summary", "short", "model", "error"})
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			err = cw.Write([]string{result.URL, result.Title, result.Summary, result.Short, result.Model, result.Error})
+			if err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// runBatch summarizes the -urls sources and returns the usage of the models they were summarized with.
+func runBatch(large *Model, f Flags) []UsageReport {
+	sources, err := readURLs(f.URLs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	publishers, err := newPublishers(f.Publish, f.DryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := f.PolicyFlags.policy(large)
+	if err != nil {
+		log.Fatal(err)
+	}
+	publishers = guard(publishers, policy)
+
+	checkpoints, err := newCheckpoints(context.Background(), f.Checkpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	resumed := 0
+	for _, line := range sources {
+		source, _, _ := parseBatchLine(line)
+		if checkpoint, ok := checkpoints.get(source); ok && checkpoint.reached("summarized") {
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		fmt.Fprintln(os.Stderr, "resuming the batch,", resumed, "of", len(sources), "sources are already summarized")
+	}
+	ctx := withCheckpoints(context.Background(), checkpoints)
+	models := newModelSet(large, nil, func(modelID string) (*Model, error) {
+		g := f
+		g.Model, g.BaseModel, g.InferenceProfile, g.Route = modelID, "", "", ""
+		return buildModel(g)
+	})
+	models.AnyModel = true
+	ctx = withModelSet(ctx, models)
+
+	var results []BatchResult
+	if f.BatchInference != "" {
+		results = summarizeBatchInference(ctx, large, sources, f)
+	} else {
+		results = summarizeBatch(ctx, large, sources, f.Workers, f)
+	}
+	// A dry run publishes nothing, so a later run still has to.
+	if f.DryRun {
+		ctx = context.Background()
+	}
+	publishResults(ctx, publishers, results)
+
+	writeBatchReport(results, f.Report)
+
+	return models.usageReports()
+}
+
+// writeBatchReport writes results to path, as CSV when it ends in .csv, or as JSON to stdout when path is empty.
+func writeBatchReport(results []BatchResult, path string) {
+	var w io.Writer = os.Stdout
+	format := "json"
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+
+	err := writeReport(w, format, results)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const (
+	// batchInferencePollInterval is how often the status of a batch inference job is checked.
+	batchInferencePollInterval = time.Minute
+	// batchInferenceMinRecords is the smallest job Bedrock accepts, by default.
+	batchInferenceMinRecords = 100
+)
+
+// promptRecorder is a language model that records the prompt and options it is sent instead of
+// answering, so that a chain's prompt can be sent in a batch inference job.
+type promptRecorder struct {
+	llms.LanguageModel
+
+	prompt string
+	opts   llms.CallOptions
+}
+
+func (r *promptRecorder) GeneratePrompt(_ context.Context, prompts []schema.PromptValue, options ...llms.CallOption) (llms.LLMResult, error) {
+	if len(prompts) != 1 {
+		return llms.LLMResult{}, fmt.Errorf("expected a single prompt, got %d", len(prompts))
+	}
+
+	r.prompt = prompts[0].String()
+	for _, option := range options {
+		option(&r.opts)
+	}
+
+	return llms.LLMResult{Generations: [][]*llms.Generation{{{Text: ""}}}}, nil
+}
+
+// batchRecord is a line of the input of a batch inference job: the InvokeModel body of a source.
+type batchRecord struct {
+	RecordID   string          `json:"recordId"`
+	ModelInput json.RawMessage `json:"modelInput"`
+}
+
+// batchPrompt returns the InvokeModel body summarizing source, and the language of the summary.
+func batchPrompt(ctx context.Context, large *Model, source string, f Flags) ([]byte, string, error) {
+	docs, err := loadDocuments(ctx, source, getDocs, f.LoaderFlags, f.SplitterFlags)
+	if err != nil {
+		return nil, "", err
+	}
+	docs = fitDocuments(large, docs, large.DocumentBudget(f.MaxTokens))
+
+	lang := resolveLanguage(f.Lang, docs)
+	question := f.Prompt
+	if lang != "" {
+		question += languageInstruction(lang)
+	}
+
+	recorder := &promptRecorder{LanguageModel: large}
+
+	_, err = summarize(ctx, recorder, docs, question, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature), chains.WithTopP(f.TopP), chains.WithTopK(f.TopK))
+	if err != nil {
+		return nil, "", err
+	}
+
+	payload, err := large.encodeRequest(ctx, recorder.prompt, &recorder.opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, lang, nil
+}
+
+// runBatchInferenceJob submits the records to a Bedrock batch inference job of the -model, through
+// the -batch-inference S3 prefix, and returns the output lines of the records once it is done.
+func runBatchInferenceJob(ctx context.Context, large *Model, records []batchRecord, f Flags) (map[string]json.RawMessage, error) {
+	if f.BatchRole == "" {
+		return nil, errors.New("batch inference needs the ARN of the service role Bedrock reads and writes -batch-inference with in -batch-role")
+	}
+	if len(records) < batchInferenceMinRecords {
+		fmt.Fprintf(os.Stderr, "only %d records, Bedrock may reject batch inference jobs of fewer than %d\n", len(records), batchInferenceMinRecords)
+	}
+
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for _, record := range records {
+		err := enc.Encode(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := loadAWSConfig()
+	prefix := strings.TrimSuffix(f.BatchInference, "/")
+
+	inputURI, remove, err := uploadS3(ctx, cfg, prefix+"/input", input.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	name := fmt.Sprintf("langchain1-%d", time.Now().Unix())
+	outputURI := prefix + "/output/"
+	client := bedrock.NewFromConfig(cfg)
+
+	created, err := client.CreateModelInvocationJob(ctx, &bedrock.CreateModelInvocationJobInput{
+		JobName: aws.String(name),
+		RoleArn: aws.String(f.BatchRole),
+		ModelId: aws.String(large.invokeID()),
+		InputDataConfig: &types.ModelInvocationJobInputDataConfigMemberS3InputDataConfig{Value: types.ModelInvocationJobS3InputDataConfig{
+			S3Uri:         aws.String(inputURI),
+			S3InputFormat: types.S3InputFormatJsonl,
+		}},
+		OutputDataConfig: &types.ModelInvocationJobOutputDataConfigMemberS3OutputDataConfig{Value: types.ModelInvocationJobS3OutputDataConfig{
+			S3Uri: aws.String(outputURI),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobArn := aws.ToString(created.JobArn)
+
+	fmt.Fprintln(os.Stderr, "waiting for batch inference job", jobArn)
+
+	var status types.ModelInvocationJobStatus
+	for {
+		job, err := client.GetModelInvocationJob(ctx, &bedrock.GetModelInvocationJobInput{JobIdentifier: aws.String(jobArn)})
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != status {
+			status = job.Status
+			fmt.Fprintln(os.Stderr, "batch inference job", name, "is", status)
+		}
+
+		switch job.Status {
+		case types.ModelInvocationJobStatusCompleted, types.ModelInvocationJobStatusPartiallyCompleted:
+			return batchInferenceOutput(ctx, cfg, jobArn, outputURI, path.Base(inputURI))
+		case types.ModelInvocationJobStatusFailed, types.ModelInvocationJobStatusStopped, types.ModelInvocationJobStatusExpired:
+			return nil, fmt.Errorf("batch inference job %s is %s: %s", name, job.Status, aws.ToString(job.Message))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(batchInferencePollInterval):
+		}
+	}
+}
+
+// getS3Object returns the content of the object at uri.
+func getS3Object(ctx context.Context, cfg aws.Config, uri string) ([]byte, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	return io.ReadAll(object.Body)
+}
+
+// batchInferenceOutput reads the output of a finished job, written under the job ID to the output
+// prefix: the records of the input file, and the manifest of their token counts.
+func batchInferenceOutput(ctx context.Context, cfg aws.Config, jobArn, outputURI, inputFile string) (map[string]json.RawMessage, error) {
+	dir := strings.TrimSuffix(outputURI, "/") + "/" + path.Base(jobArn) + "/"
+
+	data, err := getS3Object(ctx, cfg, dir+"manifest.json.out")
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		TotalRecordCount   int `json:"totalRecordCount"`
+		SuccessRecordCount int `json:"successRecordCount"`
+		ErrorRecordCount   int `json:"errorRecordCount"`
+		InputTokenCount    int `json:"inputTokenCount"`
+		OutputTokenCount   int `json:"outputTokenCount"`
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("manifest of the batch inference job: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "batch inference job summarized %d of %d records, %d failed\n", manifest.SuccessRecordCount, manifest.TotalRecordCount, manifest.ErrorRecordCount)
+
+	data, err = getS3Object(ctx, cfg, dir+inputFile+".out")
+	if err != nil {
+		return nil, err
+	}
+
+	lines := map[string]json.RawMessage{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var line struct {
+			RecordID string `json:"recordId"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) == nil {
+			lines[line.RecordID] = append(json.RawMessage(nil), scanner.Bytes()...)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// summarizeBatchInference summarizes the sources like summarizeBatch, but sends all their prompts
+// in a single Bedrock batch inference job, at a lower price than calling the model for each. The
+// sources are only loaded concurrently; every document has to fit in the context window, as
+// -hierarchical and -incremental need calls of their own.
+func summarizeBatchInference(ctx context.Context, large *Model, sources []string, f Flags) []BatchResult {
+	results := make([]BatchResult, len(sources))
+	payloads := make([][]byte, len(sources))
+	langs := make([]string, len(sources))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(f.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				source, overrides, err := parseBatchLine(sources[i])
+				if checkpoint, ok := checkpointsFrom(ctx).get(source); ok && checkpoint.reached("summarized") && checkpoint.Result != nil {
+					results[i] = *checkpoint.Result
+					continue
+				}
+				results[i].URL = source
+
+				// A job runs a single model, the sampling can differ by record.
+				if err == nil && overrides.Model != "" && overrides.Model != large.modelID {
+					err = fmt.Errorf("a batch inference job runs -model %s, not %s", large.modelID, overrides.Model)
+				}
+				if err == nil {
+					payloads[i], langs[i], err = batchPrompt(ctx, large, source, overrides.apply(f))
+				}
+				if err != nil {
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var records []batchRecord
+	for i, payload := range payloads {
+		if payload != nil {
+			records = append(records, batchRecord{RecordID: fmt.Sprintf("%011d", i), ModelInput: payload})
+		}
+	}
+	if len(records) == 0 {
+		return results
+	}
+
+	lines, err := runBatchInferenceJob(ctx, large, records, f)
+	if err != nil {
+		for i, payload := range payloads {
+			if payload != nil {
+				results[i].Error = err.Error()
+			}
+		}
+		return results
+	}
+
+	for i, payload := range payloads {
+		if payload == nil {
+			continue
+		}
+
+		var line struct {
+			ModelOutput json.RawMessage `json:"modelOutput"`
+			Error       *struct {
+				ErrorCode    int    `json:"errorCode"`
+				ErrorMessage string `json:"errorMessage"`
+			} `json:"error"`
+		}
+
+		data, ok := lines[fmt.Sprintf("%011d", i)]
+		if !ok {
+			results[i].Error = "no output in the batch inference job"
+			continue
+		}
+		err = json.Unmarshal(data, &line)
+		if err == nil && line.Error != nil {
+			err = fmt.Errorf("batch inference: %d %s", line.Error.ErrorCode, line.Error.ErrorMessage)
+		}
+		var resp Response
+		if err == nil {
+			resp, err = large.codec.DecodeResponse(line.ModelOutput)
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if resp.Usage == (Usage{}) {
+			resp.Usage = Usage{InputTokens: large.GetNumTokens(string(payload)), OutputTokens: large.GetNumTokens(resp.Completion)}
+		}
+		large.usage.add(resp.Usage)
+
+		results[i].Summary = strings.TrimSpace(resp.Completion)
+		results[i].Model = large.modelID
+		if langs[i] != "" {
+			err = checkLanguage(results[i].Summary, langs[i])
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+
+		// The summary is rarely off, so fixing it is left to a regular call.
+		if f.hashtags > 0 {
+			results[i].Summary, err = fixHashtags(ctx, large, results[i].Summary, f.hashtags)
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+		if f.CharLimit > 0 {
+			results[i].Short, err = fitCharLimit(ctx, large, results[i].Summary, f.CharLimit, f.hashtags)
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+
+		result := results[i]
+		checkpointsFrom(ctx).mark(ctx, result.URL, "summarized", 0, &result)
+	}
+
+	return results
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache stores Bedrock responses keyed by model and payload.
+type Cache interface {
+	Get(key string) (Response, bool)
+	Set(key string, resp Response)
+}
+
+type CacheFlags struct {
+	NoCache bool
+	Dir     string
+	TTL     time.Duration
+	Size    int
+}
+
+func (f *CacheFlags) register(fs *flag.FlagSet) {
+	dir, err := os.UserCacheDir()
+	if err == nil {
+		dir = filepath.Join(dir, "bedrock-langchain")
+	}
+
+	fs.BoolVar(&f.NoCache, "no-cache", false, "always call Bedrock instead of reusing cached responses")
+	fs.StringVar(&f.Dir, "cache-dir", dir, "directory responses are cached in, empty to only cache in memory")
+	fs.DurationVar(&f.TTL, "cache-ttl", 24*time.Hour, "how long cached responses are reused")
+	fs.IntVar(&f.Size, "cache-size", 256, "number of responses cached in memory")
+}
+
+func (f CacheFlags) cache() Cache {
+	if f.NoCache {
+		return nil
+	}
+
+	caches := tieredCache{newLRUCache(f.Size, f.TTL)}
+	if f.Dir != "" {
+		caches = append(caches, &DiskCache{Dir: f.Dir, TTL: f.TTL})
+	}
+
+	return caches
+}
+
+// cacheKey is the key of the response of modelID to payload. The invoke options sent as headers
+// instead of in the payload, such as the guardrail, are part of it too.
+func cacheKey(modelID string, payload []byte, headers ...string) string {
+	h := sha256.New()
+	h.Write([]byte(modelID))
+	h.Write([]byte{0})
+	for _, header := range headers {
+		h.Write([]byte(header))
+		h.Write([]byte{0})
+	}
+	h.Write(payload)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cacheEntry struct {
+	Key      string    `json:"key"`
+	Response Response  `json:"response"`
+	Expires  time.Time `json:"expires"`
+}
+
+// LRUCache keeps the most recently used responses in memory.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newLRUCache(capacity int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(key string) (Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return Response{}, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.Expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return Response{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.Response, true
+}
+
+func (c *LRUCache) Set(key string, resp Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &cacheEntry{Key: key, Response: resp, Expires: time.Now().Add(c.ttl)}
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{Key: key, Response: resp, Expires: time.Now().Add(c.ttl)})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+}
+
+// DiskCache keeps responses as JSON files so they survive between runs.
+type DiskCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (Response, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Response{}, false
+	}
+
+	var entry cacheEntry
+
+	err = json.Unmarshal(data, &entry)
+	if err != nil || time.Now().After(entry.Expires) {
+		_ = os.Remove(c.path(key))
+		return Response{}, false
+	}
+
+	return entry.Response, true
+}
+
+func (c *DiskCache) Set(key string, resp Response) {
+	data, err := json.Marshal(cacheEntry{Key: key, Response: resp, Expires: time.Now().Add(c.TTL)})
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(c.Dir, 0o700)
+	if err != nil {
+		return
+	}
+
+	tmp := c.path(key) + ".tmp"
+	if os.WriteFile(tmp, data, 0o600) == nil {
+		_ = os.Rename(tmp, c.path(key))
+	}
+}
+
+// tieredCache looks caches up in order and fills the faster ones on a hit in a slower one.
+type tieredCache []Cache
+
+func (t tieredCache) Get(key string) (Response, bool) {
+	for i, c := range t {
+		resp, ok := c.Get(key)
+		if !ok {
+			continue
+		}
+		for _, faster := range t[:i] {
+			faster.Set(key, resp)
+		}
+		return resp, true
+	}
+
+	return Response{}, false
+}
+
+func (t tieredCache) Set(key string, resp Response) {
+	for _, c := range t {
+		c.Set(key, resp)
+	}
+}
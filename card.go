@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	cardModelID = "amazon.titan-image-generator-v1"
+	// titanImagePromptLimit is the longest text Titan Image Generator accepts.
+	titanImagePromptLimit = 512
+)
+
+const cardPromptFormat = `Describe, in one sentence of at most 60 words, an illustration that would go well with this social media post. Describe only what is visible, without any text, letters or logos in the image.
+
+%s`
+
+type TitanImageRequest struct {
+	TaskType              string                     `json:"taskType"`
+	TextToImageParams     TitanTextToImageParams     `json:"textToImageParams"`
+	ImageGenerationConfig TitanImageGenerationConfig `json:"imageGenerationConfig"`
+}
+
+type TitanTextToImageParams struct {
+	Text string `json:"text"`
+}
+
+type TitanImageGenerationConfig struct {
+	NumberOfImages int     `json:"numberOfImages"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	CfgScale       float64 `json:"cfgScale"`
+}
+
+type TitanImageResponse struct {
+	Images []string `json:"images"`
+	Error  string   `json:"error"`
+}
+
+type StabilityRequest struct {
+	TextPrompts []StabilityTextPrompt `json:"text_prompts"`
+	CfgScale    float64               `json:"cfg_scale"`
+	Steps       int                   `json:"steps"`
+	Width       int                   `json:"width"`
+	Height      int                   `json:"height"`
+}
+
+type StabilityTextPrompt struct {
+	Text string `json:"text"`
+}
+
+type StabilityResponse struct {
+	Artifacts []struct {
+		Base64       string `json:"base64"`
+		FinishReason string `json:"finishReason"`
+	} `json:"artifacts"`
+}
+
+// ImageGenerator draws PNG images with a Titan Image Generator or Stability Diffusion model.
+type ImageGenerator struct {
+	bedrock BedrockInvoker
+	modelID string
+}
+
+func newImageGenerator(modelID string, invoker BedrockInvoker) *ImageGenerator {
+	if invoker == nil {
+		invoker = newBedrockClient()
+	}
+
+	return &ImageGenerator{bedrock: invoker, modelID: modelID}
+}
+
+// Generate returns a landscape PNG, sized for a Twitter card, of prompt.
+func (g *ImageGenerator) Generate(ctx context.Context, prompt string) ([]byte, error) {
+	var payload any
+
+	switch {
+	case strings.HasPrefix(g.modelID, "amazon.titan-image"):
+		if len(prompt) > titanImagePromptLimit {
+			prompt = prompt[:titanImagePromptLimit]
+		}
+		payload = TitanImageRequest{
+			TaskType:              "TEXT_IMAGE",
+			TextToImageParams:     TitanTextToImageParams{Text: prompt},
+			ImageGenerationConfig: TitanImageGenerationConfig{NumberOfImages: 1, Width: 1152, Height: 640, CfgScale: 8},
+		}
+	case strings.HasPrefix(g.modelID, "stability."):
+		payload = StabilityRequest{
+			TextPrompts: []StabilityTextPrompt{{Text: prompt}},
+			CfgScale:    7,
+			Steps:       30,
+			Width:       1344,
+			Height:      768,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image model %q", g.modelID)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := g.bedrock.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		Body:        body,
+		ModelId:     aws.String(g.modelID),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var image string
+
+	if strings.HasPrefix(g.modelID, "amazon.titan-image") {
+		var resp TitanImageResponse
+
+		err = json.Unmarshal(out.Body, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		if len(resp.Images) > 0 {
+			image = resp.Images[0]
+		}
+	} else {
+		var resp StabilityResponse
+
+		err = json.Unmarshal(out.Body, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Artifacts) > 0 {
+			if resp.Artifacts[0].FinishReason != "SUCCESS" {
+				return nil, fmt.Errorf("image generation stopped: %s", resp.Artifacts[0].FinishReason)
+			}
+			image = resp.Artifacts[0].Base64
+		}
+	}
+
+	if image == "" {
+		return nil, errors.New("no image returned")
+	}
+
+	return base64.StdEncoding.DecodeString(image)
+}
+
+// writeCard asks llm for an illustration of summary, draws it with the image model and writes the PNG to path.
+func writeCard(ctx context.Context, llm llms.LLM, images *ImageGenerator, summary, path string) error {
+	description, err := llm.Call(ctx, fmt.Sprintf(cardPromptFormat, summary), llms.WithMaxTokens(200), llms.WithTemperature(0.5))
+	if err != nil {
+		return err
+	}
+
+	png, err := images.Generate(ctx, strings.TrimSpace(description))
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, png, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "wrote social card to", path)
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/memory"
+	"github.com/tmc/langchaingo/prompts"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const chatTemplate = `Use the following document to answer the questions. If you don't know the answer, just say that you don't know, don't try to make up an answer.
+
+{{.context}}
+
+Previous conversation:
+{{.history}}
+
+Question: {{.question}}
+Helpful Answer:`
+
+func newChatMemory(large *Model, kind string, maxTokens int) (schema.Memory, error) {
+	options := []memory.ConversationBufferOption{
+		memory.WithInputKey("question"),
+		memory.WithOutputKey("text"),
+	}
+
+	switch kind {
+	case "buffer":
+		return memory.NewConversationBuffer(options...), nil
+	case "token":
+		return memory.NewConversationTokenBuffer(large, maxTokens, options...), nil
+	}
+
+	return nil, fmt.Errorf("unknown memory %q", kind)
+}
+
+func newChatChain(large *Model, mem schema.Memory) *chains.LLMChain {
+	chain := chains.NewLLMChain(large, prompts.NewPromptTemplate(chatTemplate, []string{"context", "history", "question"}))
+	chain.Memory = mem
+
+	return chain
+}
+
+// chatDocument is the context of the chat template, the contents of docs one after the other.
+func chatDocument(docs []schema.Document) string {
+	contents := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		contents = append(contents, doc.PageContent)
+	}
+
+	return strings.Join(contents, "\n\n")
+}
+
+// chat answers questions read from r, one per line, about docs until r is exhausted.
+func chat(ctx context.Context, large *Model, docs []schema.Document, r io.Reader, f Flags) error {
+	mem, err := newChatMemory(large, f.Memory, f.MemoryTokens)
+	if err != nil {
+		return err
+	}
+
+	chain := newChatChain(large, mem)
+	document := chatDocument(docs)
+
+	fmt.Println("ask questions about the document, end with Ctrl-D")
+
+	scanner := bufio.NewScanner(r)
+	for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+		question := strings.TrimSpace(scanner.Text())
+		if question == "" {
+			continue
+		}
+
+		_, err = chains.Call(ctx, chain, map[string]any{
+			"context":  document,
+			"question": question,
+		}, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature), chains.WithStreamingFunc(printChunk))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println()
+	}
+	fmt.Println()
+
+	return scanner.Err()
+}
+
+func runChat(large *Model, docs []schema.Document, f Flags) {
+	err := chat(context.Background(), large, docs, os.Stdin, f)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// checkpointStages are the stages a source of a batch goes through, in order.
+var checkpointStages = []string{"loaded", "chunked", "summarized", "published"}
+
+// Checkpoint is the progress of a source of a batch: the last stage it reached and, once
+// summarized, its result.
+type Checkpoint struct {
+	Source string       `json:"source"`
+	Stage  string       `json:"stage"`
+	Chunks int          `json:"chunks,omitempty"`
+	Result *BatchResult `json:"result,omitempty"`
+	Time   time.Time    `json:"time"`
+}
+
+// reached tells whether the checkpoint is at stage or past it.
+func (c Checkpoint) reached(stage string) bool {
+	return slices.Index(checkpointStages, c.Stage) >= slices.Index(checkpointStages, stage)
+}
+
+// CheckpointStore keeps the checkpoints of a batch across runs.
+type CheckpointStore interface {
+	Load(ctx context.Context) ([]Checkpoint, error)
+	Save(ctx context.Context, checkpoint Checkpoint) error
+}
+
+// Checkpoints are the latest checkpoints of the sources of a batch, saved to their store as the
+// sources make progress so that an interrupted batch resumes where it left off.
+type Checkpoints struct {
+	mu     sync.Mutex
+	store  CheckpointStore
+	latest map[string]Checkpoint
+}
+
+// newCheckpoints opens the checkpoints of -checkpoint: a JSONL file, or dynamodb:TABLE for a
+// DynamoDB table keyed by the string "id". It returns nil without -checkpoint.
+func newCheckpoints(ctx context.Context, path string) (*Checkpoints, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var store CheckpointStore = &FileCheckpointStore{Path: path}
+	if table, ok := strings.CutPrefix(path, "dynamodb:"); ok {
+		store = &DynamoDBCheckpointStore{client: dynamodb.NewFromConfig(loadAWSConfig()), Table: table}
+	}
+
+	checkpoints, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading the checkpoints of %s: %w", path, err)
+	}
+
+	c := &Checkpoints{store: store, latest: map[string]Checkpoint{}}
+	for _, checkpoint := range checkpoints {
+		if latest, ok := c.latest[checkpoint.Source]; !ok || !checkpoint.Time.Before(latest.Time) {
+			c.latest[checkpoint.Source] = checkpoint
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Checkpoints) get(source string) (Checkpoint, bool) {
+	if c == nil {
+		return Checkpoint{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checkpoint, ok := c.latest[source]
+	return checkpoint, ok
+}
+
+// mark records that source reached stage. The result of a summarized source is kept along, for
+// the later stages too. A failure is logged rather than failing the batch.
+func (c *Checkpoints) mark(ctx context.Context, source, stage string, chunks int, result *BatchResult) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	checkpoint := c.latest[source]
+	checkpoint.Source = source
+	checkpoint.Stage = stage
+	checkpoint.Time = time.Now().UTC()
+	if chunks > 0 {
+		checkpoint.Chunks = chunks
+	}
+	if result != nil {
+		checkpoint.Result = result
+	}
+	c.latest[source] = checkpoint
+	c.mu.Unlock()
+
+	err := c.store.Save(context.WithoutCancel(ctx), checkpoint)
+	if err != nil {
+		log.Printf("saving the checkpoint of %s: %v", source, err)
+	}
+}
+
+// checkpointsKey carries the Checkpoints of a batch to the steps of its sources.
+type checkpointsKey struct{}
+
+func withCheckpoints(ctx context.Context, c *Checkpoints) context.Context {
+	return context.WithValue(ctx, checkpointsKey{}, c)
+}
+
+func checkpointsFrom(ctx context.Context) *Checkpoints {
+	c, _ := ctx.Value(checkpointsKey{}).(*Checkpoints)
+	return c
+}
+
+// FileCheckpointStore appends the checkpoints, one JSON object per line, to a file. The latest
+// line of a source wins when it is loaded.
+type FileCheckpointStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileCheckpointStore) Load(context.Context) ([]Checkpoint, error) {
+	file, err := os.Open(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoints []Checkpoint
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var checkpoint Checkpoint
+		// The last line is cut short when a run was killed while writing it.
+		if json.Unmarshal(scanner.Bytes(), &checkpoint) == nil {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+
+	return checkpoints, scanner.Err()
+}
+
+func (s *FileCheckpointStore) Save(_ context.Context, checkpoint Checkpoint) error {
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// DynamoDBCheckpointStore puts the latest checkpoint of each source as an item of a table whose
+// partition key is the string "id", the source.
+type DynamoDBCheckpointStore struct {
+	client *dynamodb.Client
+	Table  string
+}
+
+func (s *DynamoDBCheckpointStore) Load(ctx context.Context) ([]Checkpoint, error) {
+	var checkpoints []Checkpoint
+
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{TableName: aws.String(s.Table)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			data, ok := item["checkpoint"].(*types.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			var checkpoint Checkpoint
+			if json.Unmarshal([]byte(data.Value), &checkpoint) == nil {
+				checkpoints = append(checkpoints, checkpoint)
+			}
+		}
+	}
+
+	return checkpoints, nil
+}
+
+func (s *DynamoDBCheckpointStore) Save(ctx context.Context, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	str := func(v string) types.AttributeValue { return &types.AttributeValueMemberS{Value: v} }
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Table),
+		Item: map[string]types.AttributeValue{
+			"id":         str(checkpoint.Source),
+			"stage":      str(checkpoint.Stage),
+			"time":       str(checkpoint.Time.Format(time.RFC3339Nano)),
+			"checkpoint": str(string(data)),
+		},
+	})
+	return err
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type CircuitFlags struct {
+	CircuitFailures int
+	CircuitCooldown time.Duration
+}
+
+func (f *CircuitFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.CircuitFailures, "circuit-failures", 5, "consecutive Bedrock failures or timeouts of a model after which its calls fail fast, or go to the fallback models, 0 to never stop calling it")
+	fs.DurationVar(&f.CircuitCooldown, "circuit-cooldown", 30*time.Second, "how long calls to a model fail fast before a probe call checks it has recovered")
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+// CircuitBreaker stops the calls to a model failing over and over, so that a batch does not keep
+// hammering a degraded endpoint. It opens after a number of consecutive failures, failing the calls
+// fast with ErrCircuitOpen. After the cooldown it lets a single probe call through, whose success
+// closes it again and whose failure opens it for another cooldown.
+type CircuitBreaker struct {
+	modelID  string
+	failures int
+	cooldown time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failed   int
+	openedAt time.Time
+	probing  bool
+}
+
+// WithCircuitBreaker opens the circuit of the Model after failures consecutive failures, for
+// cooldown, 0 failures for none. Each Model, fallbacks included, has its own circuit, so the
+// fallbacks answer while it is open.
+func WithCircuitBreaker(failures int, cooldown time.Duration) ModelOption {
+	return func(m *Model) {
+		if failures > 0 {
+			m.breaker = &CircuitBreaker{modelID: m.modelID, failures: failures, cooldown: cooldown}
+		}
+	}
+}
+
+// allow tells whether a call may go to the model now, and whether it is the probe of a half-open
+// circuit. The outcome of an allowed call is then given to done.
+func (b *CircuitBreaker) allow(now time.Time) (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		retry := b.openedAt.Add(b.cooldown)
+		if now.Before(retry) {
+			return false, fmt.Errorf("%s: %w after %d consecutive failures, retrying in %s", b.modelID, ErrCircuitOpen, b.failed, retry.Sub(now).Round(time.Second))
+		}
+		b.transition(circuitHalfOpen)
+		fallthrough
+	case circuitHalfOpen:
+		if b.probing {
+			return false, fmt.Errorf("%s: %w, waiting for a probe call to tell whether it recovered", b.modelID, ErrCircuitOpen)
+		}
+		b.probing = true
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// done records the outcome of a call allow let through.
+func (b *CircuitBreaker) done(now time.Time, probe bool, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	} else if b.state != circuitClosed {
+		// The call started before the circuit opened, the probe tells whether it closes again.
+		return
+	}
+
+	switch {
+	case err == nil:
+		b.failed = 0
+		if probe {
+			b.transition(circuitClosed)
+		}
+	case degraded(err):
+		b.failed++
+		if probe || b.failed >= b.failures {
+			b.openedAt = now
+			b.transition(circuitOpen)
+		}
+	}
+}
+
+// release gives back the probe of a call allow let through that did not call the model after all.
+func (b *CircuitBreaker) release(probe bool) {
+	if b == nil || !probe {
+		return
+	}
+
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *CircuitBreaker) transition(state circuitState) {
+	if b.state == state {
+		return
+	}
+
+	if state == circuitOpen {
+		log.Printf("circuit of %s open after %d consecutive failures", b.modelID, b.failed)
+	} else {
+		log.Printf("circuit of %s %s", b.modelID, state)
+	}
+	circuitMetric.WithLabelValues(b.modelID, state.String()).Inc()
+	b.state = state
+}
+
+// degraded reports whether err tells that the model or the way to it is failing, rather than that
+// the request was wrong or its caller gave up.
+func degraded(err error) bool {
+	var bedrockErr *BedrockError
+	var netErr net.Error
+	var sendErr *smithyhttp.RequestSendError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrThrottled):
+		return true
+	case errors.As(err, &bedrockErr):
+		switch bedrockErr.Code {
+		case "InternalServerException", "ServiceUnavailableException", "ModelTimeoutException", "ModelNotReadyException", "ModelErrorException":
+			return true
+		}
+		return false
+	}
+
+	return errors.As(err, &netErr) || errors.As(err, &sendErr)
+}
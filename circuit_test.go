@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failure := &BedrockError{ModelID: "m", Code: "ServiceUnavailableException"}
+	invalid := &BedrockError{ModelID: "m", Code: "ValidationException"}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Each step asks the breaker for a call at its time, then gives it the outcome of the call when
+	// it is allowed.
+	type step struct {
+		at      time.Duration
+		outcome error
+		// open tells whether the call fails fast, and probe whether it is the probe of the circuit.
+		open  bool
+		probe bool
+		state circuitState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after consecutive failures",
+			steps: []step{
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 1 * time.Second, outcome: failure, state: circuitClosed},
+				{at: 2 * time.Second, outcome: failure, state: circuitOpen},
+				{at: 3 * time.Second, open: true, state: circuitOpen},
+			},
+		},
+		{
+			name: "a success resets the count",
+			steps: []step{
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 1 * time.Second, outcome: failure, state: circuitClosed},
+				{at: 2 * time.Second, state: circuitClosed},
+				{at: 3 * time.Second, outcome: failure, state: circuitClosed},
+				{at: 4 * time.Second, outcome: failure, state: circuitClosed},
+			},
+		},
+		{
+			name: "errors of the request do not count",
+			steps: []step{
+				{at: 0, outcome: invalid, state: circuitClosed},
+				{at: 1 * time.Second, outcome: context.Canceled, state: circuitClosed},
+				{at: 2 * time.Second, outcome: invalid, state: circuitClosed},
+				{at: 3 * time.Second, outcome: invalid, state: circuitClosed},
+			},
+		},
+		{
+			name: "timeouts and throttling count",
+			steps: []step{
+				{at: 0, outcome: context.DeadlineExceeded, state: circuitClosed},
+				{at: 1 * time.Second, outcome: fmt.Errorf("m: %w", ErrThrottled), state: circuitClosed},
+				{at: 2 * time.Second, outcome: failure, state: circuitOpen},
+			},
+		},
+		{
+			name: "a successful probe closes it",
+			steps: []step{
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 0, outcome: failure, state: circuitOpen},
+				{at: 29 * time.Second, open: true, state: circuitOpen},
+				{at: 30 * time.Second, probe: true, state: circuitClosed},
+				{at: 31 * time.Second, outcome: failure, state: circuitClosed},
+			},
+		},
+		{
+			name: "a failed probe opens it again",
+			steps: []step{
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 0, outcome: failure, state: circuitClosed},
+				{at: 0, outcome: failure, state: circuitOpen},
+				{at: 30 * time.Second, outcome: failure, probe: true, state: circuitOpen},
+				{at: 59 * time.Second, open: true, state: circuitOpen},
+				{at: 60 * time.Second, probe: true, state: circuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &CircuitBreaker{modelID: "m", failures: 3, cooldown: 30 * time.Second}
+
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				probe, err := b.allow(now)
+				if s.open {
+					if !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: got %v, want %v", i, err, ErrCircuitOpen)
+					}
+				} else {
+					if err != nil {
+						t.Fatalf("step %d: %v", i, err)
+					}
+					b.done(now, probe, s.outcome)
+				}
+				if probe != s.probe {
+					t.Errorf("step %d: got probe %t, want %t", i, probe, s.probe)
+				}
+				if b.state != s.state {
+					t.Errorf("step %d: got %s, want %s", i, b.state, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := &CircuitBreaker{modelID: "m", failures: 1, cooldown: time.Minute}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	probe, _ := b.allow(now)
+	b.done(now, probe, &BedrockError{ModelID: "m", Code: "ModelTimeoutException"})
+
+	now = now.Add(time.Minute)
+	probe, err := b.allow(now)
+	if err != nil || !probe {
+		t.Fatalf("got probe %t and %v, want the probe", probe, err)
+	}
+
+	_, err = b.allow(now)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v while probing, want %v", err, ErrCircuitOpen)
+	}
+
+	// A probe that did not call the model lets the next call probe.
+	b.release(probe)
+	probe, err = b.allow(now)
+	if err != nil || !probe {
+		t.Fatalf("got probe %t and %v after the release, want the probe", probe, err)
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	fake := &FakeInvoker{Err: &BedrockError{ModelID: "amazon.titan-text-express-v1", Code: "InternalServerException"}}
+	m, err := buildLargeLanguageModel("amazon.titan-text-express-v1", WithInvoker(fake), WithCircuitBreaker(2, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = m.Call(context.Background(), "Summarize the text.")
+	}
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want %v", err, ErrCircuitOpen)
+	}
+	if len(fake.Requests) != 2 {
+		t.Errorf("Bedrock was called %d times, want 2", len(fake.Requests))
+	}
+}
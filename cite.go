@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// excerptLength is the number of characters of a cited chunk shown with the answer.
+const excerptLength = 160
+
+// citeInstruction asks the model to cite the chunks numbered by numberDocs.
+const citeInstruction = "\n\nThe context is made of numbered sources. After each statement, cite the sources it comes from as [1], [2] and so on."
+
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// Citation is a source chunk an answer refers to by its number.
+type Citation struct {
+	Number  int    `json:"number"`
+	Source  string `json:"source,omitempty"`
+	Heading string `json:"heading,omitempty"`
+	// Start and End are the character offsets of the chunk in its document.
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Excerpt string `json:"excerpt"`
+}
+
+// numberDocs prefixes each document with the number the model cites it by.
+func numberDocs(docs []schema.Document) []schema.Document {
+	numbered := make([]schema.Document, len(docs))
+	for i, doc := range docs {
+		numbered[i] = schema.Document{PageContent: fmt.Sprintf("[%d] %s", i+1, doc.PageContent), Metadata: doc.Metadata}
+	}
+
+	return numbered
+}
+
+// citations returns the documents text cites, in the order they are first cited.
+func citations(text string, docs []schema.Document, source string) []Citation {
+	cited := []Citation{}
+	seen := map[int]bool{}
+
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if n < 1 || n > len(docs) || seen[n] {
+			continue
+		}
+		seen[n] = true
+
+		doc := docs[n-1]
+		c := Citation{Number: n, Source: source, Excerpt: excerpt(doc.PageContent)}
+		if s, ok := doc.Metadata["source"].(string); ok {
+			c.Source = s
+		}
+		c.Heading, _ = doc.Metadata["heading"].(string)
+		c.Start, _ = doc.Metadata["start"].(int)
+		c.End, _ = doc.Metadata["end"].(int)
+		cited = append(cited, c)
+	}
+
+	return cited
+}
+
+func excerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > excerptLength {
+		return string(runes[:excerptLength-1]) + "…"
+	}
+
+	return text
+}
+
+// printCitations lists the cited chunks under the answer.
+func printCitations(cited []Citation) {
+	_ = writeCitations(os.Stdout, cited)
+}
+
+func writeCitations(w io.Writer, cited []Citation) error {
+	if len(cited) == 0 {
+		return nil
+	}
+
+	_, err := fmt.Fprintln(w, "\nSources:")
+	if err != nil {
+		return err
+	}
+	for _, c := range cited {
+		where := c.Source
+		if c.Heading != "" {
+			where += ", " + c.Heading
+		}
+		if c.End > 0 {
+			where += fmt.Sprintf(" (characters %d-%d)", c.Start, c.End)
+		}
+		_, err = fmt.Fprintf(w, "[%d] %s: %s\n", c.Number, where, c.Excerpt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
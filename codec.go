@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Codec translates between langchaingo call options and a provider specific Bedrock payload.
+type Codec interface {
+	EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error)
+	DecodeResponse(body []byte) (Response, error)
+	DecodeChunk(body []byte) (string, error)
+}
+
+// withSystem puts the system prompt ahead of the prompt, for the models without a dedicated field or turn for it.
+func withSystem(system, prompt string) string {
+	if system == "" {
+		return prompt
+	}
+
+	return system + "\n\n" + prompt
+}
+
+func codecForModel(modelID string) (Codec, error) {
+	switch modelID := baseModelID(modelID); {
+	case strings.HasPrefix(modelID, "anthropic.claude-3"):
+		return MessagesCodec{}, nil
+	case strings.HasPrefix(modelID, "anthropic."):
+		return TextCompletionCodec{}, nil
+	case strings.HasPrefix(modelID, "amazon.nova"):
+		return NovaCodec{}, nil
+	case strings.HasPrefix(modelID, "amazon.titan-text"):
+		return TitanCodec{}, nil
+	case strings.HasPrefix(modelID, "meta.llama3"):
+		return LlamaCodec{}, nil
+	case strings.HasPrefix(modelID, "cohere.command"):
+		return CohereCodec{}, nil
+	case strings.HasPrefix(modelID, "mistral."):
+		return MistralCodec{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported model %q", modelID)
+}
+
+// contextWindows holds the context size, in tokens, of the supported model families.
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"anthropic.claude-3", 200000},
+	{"anthropic.claude-v2:1", 200000},
+	{"anthropic.", 100000},
+	{"amazon.nova-micro", 128000},
+	{"amazon.nova", 300000},
+	{"amazon.titan-text-premier", 32000},
+	{"amazon.titan-text-express", 8000},
+	{"amazon.titan-text-lite", 4000},
+	{"meta.llama3", 8000},
+	{"cohere.command-r", 128000},
+	{"cohere.command", 4000},
+	{"mistral.", 32000},
+}
+
+func contextWindow(modelID string) int {
+	for _, window := range contextWindows {
+		if strings.HasPrefix(baseModelID(modelID), window.prefix) {
+			return window.tokens
+		}
+	}
+
+	return llms.GetModelContextSize(modelID)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata with the actual output")
+
+// golden compares got to testdata/name, or writes it there with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+var codecCases = []struct {
+	name    string
+	modelID string
+	options []ModelOption
+	// body is the response of InvokeModel, and chunks are the parts of the streamed one.
+	body   string
+	chunks []string
+	want   Response
+}{
+	{
+		name:    "messages",
+		modelID: "anthropic.claude-3-haiku-20240307-v1:0",
+		body:    `{"content":[{"type":"text","text":"A summary."}],"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":3}}`,
+		chunks: []string{
+			`{"type":"message_start"}`,
+			`{"type":"content_block_delta","delta":{"type":"text_delta","text":"A "}}`,
+			`{"type":"content_block_delta","delta":{"type":"text_delta","text":"summary."}}`,
+		},
+		want: Response{Completion: "A summary.", StopReason: "end_turn", Usage: Usage{InputTokens: 12, OutputTokens: 3}},
+	},
+	{
+		name:    "text-completion",
+		modelID: "anthropic.claude-v2:1",
+		body:    `{"completion":"A summary.","stop_reason":"stop_sequence"}`,
+		chunks:  []string{`{"completion":"A "}`, `{"completion":"summary."}`},
+		want:    Response{Completion: "A summary.", StopReason: "stop_sequence"},
+	},
+	{
+		name:    "nova",
+		modelID: "amazon.nova-lite-v1:0",
+		body:    `{"output":{"message":{"role":"assistant","content":[{"text":"A summary."}]}},"stopReason":"end_turn","usage":{"inputTokens":12,"outputTokens":3}}`,
+		chunks:  []string{`{"contentBlockDelta":{"delta":{"text":"A "}}}`, `{"contentBlockDelta":{"delta":{"text":"summary."}}}`, `{"messageStop":{"stopReason":"end_turn"}}`},
+		want:    Response{Completion: "A summary.", StopReason: "end_turn", Usage: Usage{InputTokens: 12, OutputTokens: 3}},
+	},
+	{
+		name:    "titan",
+		modelID: "amazon.titan-text-express-v1",
+		body:    `{"results":[{"outputText":"A summary.","completionReason":"FINISH"}]}`,
+		chunks:  []string{`{"outputText":"A "}`, `{"outputText":"summary."}`},
+		want:    Response{Completion: "A summary.", StopReason: "FINISH"},
+	},
+	{
+		name:    "llama",
+		modelID: "meta.llama3-8b-instruct-v1:0",
+		body:    `{"generation":"A summary.","stop_reason":"stop"}`,
+		chunks:  []string{`{"generation":"A "}`, `{"generation":"summary."}`},
+		want:    Response{Completion: "A summary.", StopReason: "stop"},
+	},
+	{
+		name:    "cohere",
+		modelID: "cohere.command-text-v14",
+		body:    `{"generations":[{"text":"A summary.","finish_reason":"COMPLETE"}]}`,
+		chunks:  []string{`{"text":"A ","is_finished":false}`, `{"text":"summary.","is_finished":false}`, `{"is_finished":true}`},
+		want:    Response{Completion: "A summary.", StopReason: "COMPLETE"},
+	},
+	{
+		name:    "mistral",
+		modelID: "mistral.mistral-7b-instruct-v0:2",
+		body:    `{"outputs":[{"text":"A summary.","stop_reason":"stop"}]}`,
+		chunks:  []string{`{"outputs":[{"text":"A "}]}`, `{"outputs":[{"text":"summary."}]}`},
+		want:    Response{Completion: "A summary.", StopReason: "stop"},
+	},
+	{
+		name:    "converse",
+		modelID: "amazon.titan-text-express-v1",
+		options: []ModelOption{WithConverse(), WithGuardrail("gr-1", "2"), WithSampling(Sampling{MinP: 0.05})},
+		body:    `{"output":{"message":{"role":"assistant","content":[{"text":"A summary."}]}},"stopReason":"end_turn","usage":{"inputTokens":12,"outputTokens":3}}`,
+		chunks:  []string{`{"contentBlockDelta":{"delta":{"text":"A "}}}`, `{"contentBlockDelta":{"delta":{"text":"summary."}}}`, `{"metadata":{"usage":{"inputTokens":12,"outputTokens":3}}}`},
+		want:    Response{Completion: "A summary.", StopReason: "end_turn", Usage: Usage{InputTokens: 12, OutputTokens: 3}},
+	},
+}
+
+var codecCallOptions = []llms.CallOption{
+	llms.WithMaxTokens(256),
+	llms.WithTemperature(0.2),
+	llms.WithTopP(0.9),
+	llms.WithStopWords([]string{"\n\nHuman:"}),
+}
+
+func TestCodecRequests(t *testing.T) {
+	for _, tc := range codecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &FakeInvoker{Body: []byte(tc.body)}
+			m, err := buildLargeLanguageModel(tc.modelID, append([]ModelOption{WithInvoker(fake), WithSystemPrompt("Answer in English.")}, tc.options...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = m.Call(context.Background(), "Summarize the text.", codecCallOptions...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := fake.LastRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.ModelID != tc.modelID {
+				t.Errorf("invoked %s, want %s", req.ModelID, tc.modelID)
+			}
+
+			var body bytes.Buffer
+			err = json.Indent(&body, req.Body, "", "  ")
+			if err != nil {
+				t.Fatalf("%v: %s", err, req.Body)
+			}
+			body.WriteByte('\n')
+			golden(t, filepath.Join("requests", tc.name+".json"), body.Bytes())
+		})
+	}
+}
+
+func TestCodecResponses(t *testing.T) {
+	for _, tc := range codecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := buildLargeLanguageModel(tc.modelID, append([]ModelOption{WithInvoker(&FakeInvoker{})}, tc.options...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := m.codec.DecodeResponse([]byte(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Completion != tc.want.Completion || resp.StopReason != tc.want.StopReason || resp.Usage != tc.want.Usage {
+				t.Errorf("got %+v, want %+v", resp, tc.want)
+			}
+		})
+	}
+}
+
+func TestCodecChunks(t *testing.T) {
+	for _, tc := range codecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &FakeInvoker{}
+			for _, chunk := range tc.chunks {
+				fake.Chunks = append(fake.Chunks, []byte(chunk))
+			}
+			m, err := buildLargeLanguageModel(tc.modelID, append([]ModelOption{WithInvoker(fake)}, tc.options...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var streamed strings.Builder
+			stream := llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+				streamed.Write(chunk)
+				return nil
+			})
+
+			completion, err := m.Call(context.Background(), "Summarize the text.", stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if completion != tc.want.Completion || streamed.String() != tc.want.Completion {
+				t.Errorf("got %q streamed as %q, want %q", completion, streamed.String(), tc.want.Completion)
+			}
+		})
+	}
+}
+
+func TestCodecForModel(t *testing.T) {
+	tests := []struct {
+		modelID string
+		want    Codec
+	}{
+		{"anthropic.claude-3-5-sonnet-20240620-v1:0", MessagesCodec{}},
+		{"us.anthropic.claude-3-haiku-20240307-v1:0", MessagesCodec{}},
+		{"anthropic.claude-instant-v1", TextCompletionCodec{}},
+		{"amazon.nova-pro-v1:0", NovaCodec{}},
+		{"amazon.titan-text-lite-v1", TitanCodec{}},
+		{"meta.llama3-70b-instruct-v1:0", LlamaCodec{}},
+		{"cohere.command-light-text-v14", CohereCodec{}},
+		{"mistral.mixtral-8x7b-instruct-v0:1", MistralCodec{}},
+		{"ai21.j2-ultra-v1", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := codecForModel(tt.modelID)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: got %T, want an error", tt.modelID, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.modelID, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %T, want %T", tt.modelID, got, tt.want)
+		}
+	}
+}
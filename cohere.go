@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+type CohereRequest struct {
+	Prompt           string   `json:"prompt"`
+	MaxTokens        int      `json:"max_tokens,omitempty"`
+	Temperature      float64  `json:"temperature,omitempty"`
+	P                float64  `json:"p,omitempty"`
+	K                int      `json:"k,omitempty"`
+	StopSequences    []string `json:"stop_sequences,omitempty"`
+	Stream           bool     `json:"stream,omitempty"`
+	Seed             int      `json:"seed,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+}
+
+type CohereGeneration struct {
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+}
+
+type CohereResponse struct {
+	Generations []CohereGeneration `json:"generations"`
+}
+
+type CohereStreamChunk struct {
+	Text       string `json:"text"`
+	IsFinished bool   `json:"is_finished"`
+}
+
+// CohereCodec speaks the Cohere Command text generation payload.
+type CohereCodec struct{}
+
+func (CohereCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return json.Marshal(CohereRequest{
+		Prompt:           withSystem(system, prompt),
+		MaxTokens:        opts.MaxTokens,
+		Temperature:      opts.Temperature,
+		P:                opts.TopP,
+		K:                opts.TopK,
+		StopSequences:    opts.StopWords,
+		Stream:           opts.StreamingFunc != nil,
+		Seed:             opts.Seed,
+		FrequencyPenalty: opts.FrequencyPenalty,
+		PresencePenalty:  opts.PresencePenalty,
+	})
+}
+
+func (CohereCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp CohereResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(resp.Generations) == 0 {
+		return Response{}, nil
+	}
+
+	if resp.Generations[0].FinishReason == "ERROR_TOXIC" {
+		return Response{}, ErrContentFiltered
+	}
+
+	return Response{Completion: resp.Generations[0].Text, StopReason: resp.Generations[0].FinishReason}, nil
+}
+
+func (CohereCodec) DecodeChunk(body []byte) (string, error) {
+	var chunk CohereStreamChunk
+
+	err := json.Unmarshal(body, &chunk)
+	if err != nil {
+		return "", err
+	}
+
+	return chunk.Text, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// CompareResult is the summary a model made in a -compare run, with what it took.
+type CompareResult struct {
+	Model   string      `json:"model"`
+	Summary string      `json:"summary,omitempty"`
+	Latency float64     `json:"latency_seconds"`
+	Usage   UsageReport `json:"usage"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// compareModels summarizes docs with every model concurrently, each with its own Model so its
+// usage and cost are its own.
+func compareModels(ctx context.Context, models []string, docs []schema.Document, f Flags) []CompareResult {
+	results := make([]CompareResult, len(models))
+
+	var wg sync.WaitGroup
+	for i, id := range models {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+
+			mf := f
+			mf.Model, mf.Fallback, mf.BaseModel, mf.InferenceProfile, mf.Route = id, "", "", "", ""
+			large := newModel(mf)
+
+			var mismatch *LanguageMismatchError
+
+			start := time.Now()
+			fitted := fitDocuments(large, docs, large.DocumentBudget(f.MaxTokens))
+			summary, err := summarizeIn(ctx, large, fitted, f.Prompt, f.Lang, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature))
+			results[i] = CompareResult{Model: id, Summary: strings.TrimSpace(summary), Latency: time.Since(start).Seconds(), Usage: large.Usage()}
+			if err != nil && !errors.As(err, &mismatch) {
+				results[i].Error = err.Error()
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces when it can.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				runes := []rune(word)
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// printComparison prints the results in columns side by side, within a terminal of width characters.
+func printComparison(w io.Writer, results []CompareResult, width int) {
+	const gap = " | "
+	column := max((width-len(gap)*(len(results)-1))/len(results), 20)
+
+	columns := make([][]string, len(results))
+	rows := 0
+	for i, result := range results {
+		header := []string{
+			result.Model,
+			fmt.Sprintf("%.1fs, %d+%d tokens, $%.4f", result.Latency, result.Usage.InputTokens, result.Usage.OutputTokens, result.Usage.Cost),
+			strings.Repeat("-", column),
+		}
+		text := result.Summary
+		if result.Error != "" {
+			text = "error: " + result.Error
+		}
+
+		for _, line := range header[:2] {
+			columns[i] = append(columns[i], wrapText(line, column)...)
+		}
+		columns[i] = append(columns[i], header[2])
+		columns[i] = append(columns[i], wrapText(text, column)...)
+		rows = max(rows, len(columns[i]))
+	}
+
+	for row := 0; row < rows; row++ {
+		cells := make([]string, len(columns))
+		for i, lines := range columns {
+			cell := ""
+			if row < len(lines) {
+				cell = lines[row]
+			}
+			// The last column is not padded, so lines don't end with spaces.
+			if i < len(columns)-1 {
+				cell += strings.Repeat(" ", column-utf8.RuneCountInString(cell))
+			}
+			cells[i] = cell
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, gap), " "))
+	}
+}
+
+// terminalWidth is the COLUMNS of the shell, or 160.
+func terminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+
+	return 160
+}
+
+// runCompare summarizes the documents with every -compare model, printing the summaries side by
+// side or, with -json, as a list of CompareResult.
+func runCompare(ctx context.Context, docs []schema.Document, f Flags) {
+	models := modelList(f.Compare)
+	if f.Mode != "summarize" || f.Interactive {
+		log.Fatal("-compare only compares summaries, it can't be combined with another -mode or -interactive")
+	}
+	if len(models) < 2 {
+		log.Fatal("-compare needs at least two models")
+	}
+
+	results := compareModels(ctx, models, docs, f)
+
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(results)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	printComparison(os.Stdout, results, terminalWidth())
+}
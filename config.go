@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configValue is a value of the config file, the items of an array as several values.
+type configValue struct {
+	section string
+	key     string
+	values  []string
+}
+
+// configPath returns the config file given with -config on the command line or in BEDROCK_CONFIG.
+func configPath(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return os.Getenv("BEDROCK_CONFIG")
+}
+
+// applyConfig sets the flags of fs from the config file, then from BEDROCK_<FLAG_NAME> environment
+// variables, before the command line is parsed, so the command line overrides the environment which
+// overrides the file.
+//
+// The file is TOML. Top level keys are flag names. A key in a [section] is the flag named
+// section-key, such as chunk-size in [chunk], or a name=value pair of the flag named after the
+// section, such as the template variables of [var]. The [env] section sets environment variables
+// that are not already set, such as the webhooks of the publishers.
+func applyConfig(fs *flag.FlagSet, args []string) error {
+	fs.String("config", "", "TOML file of flag values, overridden by BEDROCK_<FLAG> environment variables and the command line")
+
+	if path := configPath(args); path != "" {
+		values, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range values {
+			err = setConfigValue(fs, v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := "BEDROCK_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok && err == nil {
+			if e := fs.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("%s: %w", env, e)
+			}
+		}
+	})
+
+	return err
+}
+
+func setConfigValue(fs *flag.FlagSet, v configValue) error {
+	if v.section == "env" {
+		if _, ok := os.LookupEnv(v.key); !ok {
+			return os.Setenv(v.key, strings.Join(v.values, ","))
+		}
+		return nil
+	}
+
+	name := v.key
+	var prefix string
+	if v.section != "" {
+		name = v.section + "-" + v.key
+		if fs.Lookup(name) == nil {
+			name, prefix = v.section, v.key+"="
+		}
+	}
+	fl := fs.Lookup(name)
+	if fl == nil {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+
+	// The flag package's own flags keep only their last value, so an array is a comma separated list
+	// for them, and one value per item for repeatable flags such as -var and -image.
+	values := v.values
+	if _, builtin := fl.Value.(flag.Getter); builtin && len(values) > 1 {
+		values = []string{strings.Join(values, ",")}
+	}
+
+	for _, value := range values {
+		err := fs.Set(name, prefix+value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// readConfig reads the sections, and the keys with string, number, boolean or array values, of
+// the TOML file, in the order of the file.
+func readConfig(path string) ([]configValue, error) {
+	var doc map[string]any
+
+	md, err := toml.DecodeFile(path, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []configValue
+	for _, key := range md.Keys() {
+		var v configValue
+		var raw any
+		switch len(key) {
+		case 1:
+			raw = doc[key[0]]
+			if _, table := raw.(map[string]any); table {
+				continue
+			}
+			v.key = key[0]
+		case 2:
+			v.section, v.key = key[0], key[1]
+			raw = doc[key[0]].(map[string]any)[key[1]]
+			if _, table := raw.(map[string]any); table {
+				return nil, fmt.Errorf("%s: %s: tables are only one level deep", path, key)
+			}
+		default:
+			return nil, fmt.Errorf("%s: %s: tables are only one level deep", path, key)
+		}
+
+		items, ok := raw.([]any)
+		if !ok {
+			items = []any{raw}
+		}
+		for _, item := range items {
+			value, err := configString(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			v.values = append(v.values, value)
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// configString writes a value of the config file the way the flags read it.
+func configString(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", value)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want []configValue
+		// err is a part of the error message, empty when the file is valid.
+		err string
+	}{
+		{
+			name: "top level keys",
+			toml: "model = \"anthropic.claude-v2\"\nmax-tokens = 512\ntemperature = 0.5\nstream = true\n",
+			want: []configValue{
+				{key: "model", values: []string{"anthropic.claude-v2"}},
+				{key: "max-tokens", values: []string{"512"}},
+				{key: "temperature", values: []string{"0.5"}},
+				{key: "stream", values: []string{"true"}},
+			},
+		},
+		{
+			name: "sections in file order",
+			toml: "[chunk]\nsize = 1000\n\n[var]\naudience = \"engineers\"\n\n[env]\nSLACK_WEBHOOK = \"https://hooks.example.com/x\"\n",
+			want: []configValue{
+				{section: "chunk", key: "size", values: []string{"1000"}},
+				{section: "var", key: "audience", values: []string{"engineers"}},
+				{section: "env", key: "SLACK_WEBHOOK", values: []string{"https://hooks.example.com/x"}},
+			},
+		},
+		{
+			name: "arrays",
+			toml: "fallback-models = [\"a\", \"b\"]\n\n[stop]\nwords = [\"\\n\\nHuman:\"]\n",
+			want: []configValue{
+				{key: "fallback-models", values: []string{"a", "b"}},
+				{section: "stop", key: "words", values: []string{"\n\nHuman:"}},
+			},
+		},
+		{
+			name: "nested table",
+			toml: "[a.b]\nc = 1\n",
+			err:  "tables are only one level deep",
+		},
+		{
+			name: "unsupported value",
+			toml: "since = 2024-01-01T00:00:00Z\n",
+			err:  "since: unsupported value",
+		},
+		{
+			name: "syntax error",
+			toml: "model = \n",
+			err:  "toml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			err := os.WriteFile(path, []byte(tt.toml), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values, err := readConfig(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("got %+v, want %+v", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Setenv("BEDROCK_CONFIG", "env.toml")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-config", "a.toml"}, "a.toml"},
+		{[]string{"--config=b.toml", "-model", "x"}, "b.toml"},
+		{[]string{"-model", "x"}, "env.toml"},
+		{[]string{"config", "c.toml"}, "env.toml"},
+	}
+
+	for _, tt := range tests {
+		if got := configPath(tt.args); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte("model = \"file\"\nmax-tokens = 100\n\n[chunk]\nsize = 500\n\n[var]\naudience = \"engineers\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BEDROCK_MAX_TOKENS", "200")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	model := fs.String("model", "", "")
+	maxTokens := fs.Int("max-tokens", 0, "")
+	chunkSize := fs.Int("chunk-size", 0, "")
+	vars := map[string]string{}
+	fs.Func("var", "", func(s string) error {
+		name, value, _ := strings.Cut(s, "=")
+		vars[name] = value
+		return nil
+	})
+
+	args := []string{"-config", path, "-model", "flag"}
+	err = applyConfig(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *model != "flag" || *maxTokens != 200 || *chunkSize != 500 || vars["audience"] != "engineers" {
+		t.Errorf("got model %q, max-tokens %d, chunk-size %d, vars %v", *model, *maxTokens, *chunkSize, vars)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tmc/langchaingo/schema"
+)
+
+var (
+	// confluencePagePattern matches the paths of the site to a Confluence page, capturing the page ID.
+	confluencePagePattern = regexp.MustCompile(`^/spaces/[^/]+/pages/(\d+)`)
+	// confluenceSpacePattern matches the paths of the site to a Confluence space, capturing the space key.
+	confluenceSpacePattern = regexp.MustCompile(`^/spaces/([^/?#]+)/?(overview)?/?([?#].*)?$`)
+	// confluenceViewPattern matches the Data Center paths to a page by ID.
+	confluenceViewPattern = regexp.MustCompile(`^/pages/viewpage\.action\?pageId=(\d+)`)
+)
+
+type confluencePage struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Space struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	} `json:"space"`
+	Version struct {
+		When string `json:"when"`
+	} `json:"version"`
+	Body struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+	Links struct {
+		WebUI string `json:"webui"`
+	} `json:"_links"`
+}
+
+// confluenceSite returns the link of the Confluence site in CONFLUENCE_URL, the only one its
+// credentials are sent to.
+func confluenceSite() (*url.URL, error) {
+	site := os.Getenv("CONFLUENCE_URL")
+	if site == "" {
+		return nil, fmt.Errorf("CONFLUENCE_URL is not set")
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(site, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("CONFLUENCE_URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("CONFLUENCE_URL %s is not an https link", site)
+	}
+
+	return u, nil
+}
+
+// confluenceSource returns the base URL of the Confluence site of source and the page ID or space key
+// it names. Sources are page and space links of the CONFLUENCE_URL site, or confluence:page:ID and
+// confluence:space:KEY on it.
+func confluenceSource(source string) (base, page, space string, ok bool) {
+	site, err := confluenceSite()
+	if err != nil {
+		return "", "", "", false
+	}
+	base = site.String()
+
+	if rest, found := strings.CutPrefix(source, "confluence:"); found {
+		kind, id, _ := strings.Cut(rest, ":")
+		switch kind {
+		case "page":
+			return base, id, "", id != ""
+		case "space":
+			return base, "", id, id != ""
+		}
+		return "", "", "", false
+	}
+
+	// Only the links of the site itself, since other sites may have such paths too.
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme != site.Scheme || !strings.EqualFold(u.Host, site.Host) {
+		return "", "", "", false
+	}
+	path, found := strings.CutPrefix(u.EscapedPath(), site.EscapedPath())
+	if !found || path != "" && !strings.HasPrefix(path, "/") {
+		return "", "", "", false
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		path += "#" + u.EscapedFragment()
+	}
+
+	if m := confluencePagePattern.FindStringSubmatch(path); m != nil {
+		return base, m[1], "", true
+	}
+	if m := confluenceViewPattern.FindStringSubmatch(path); m != nil {
+		return base, m[1], "", true
+	}
+	if m := confluenceSpacePattern.FindStringSubmatch(path); m != nil {
+		return base, "", m[1], true
+	}
+
+	return "", "", "", false
+}
+
+// confluenceGet decodes the response of the Confluence REST API of base to path into v. Confluence
+// Cloud is authenticated with CONFLUENCE_USER and its API token CONFLUENCE_TOKEN, Data Center with
+// the personal access token CONFLUENCE_TOKEN alone, both only on the CONFLUENCE_URL site.
+func confluenceGet(ctx context.Context, base, path string, v any) error {
+	site, err := confluenceSite()
+	if err != nil {
+		return err
+	}
+	if base != site.String() {
+		return fmt.Errorf("%s is not the Confluence site of CONFLUENCE_URL", base)
+	}
+
+	f := fetchFlags
+	switch user, token := os.Getenv("CONFLUENCE_USER"), os.Getenv("CONFLUENCE_TOKEN"); {
+	case user != "" && token != "":
+		f.BasicAuth, f.AuthHosts = user+":"+token, ""
+		f.FetchAuthFlags = f.scopeAuth(base)
+	case token != "":
+		f.BearerToken, f.AuthHosts = token, ""
+		f.FetchAuthFlags = f.scopeAuth(base)
+	}
+
+	data, err := f.fetchBytes(ctx, base+"/rest/api"+path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// getDocsFromConfluence loads a Confluence page, or the first -wiki-pages pages of a space, through
+// the REST API, one document per page.
+func getDocsFromConfluence(ctx context.Context, source string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading Confluence", source)
+
+	_, err := confluenceSite()
+	if err != nil {
+		return nil, err
+	}
+	base, pageID, spaceKey, ok := confluenceSource(source)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a page or space of the Confluence site of CONFLUENCE_URL", source)
+	}
+
+	const expand = "expand=body.storage,space,version"
+
+	var pages []confluencePage
+	if pageID != "" {
+		var page confluencePage
+
+		err := confluenceGet(ctx, base, "/content/"+pageID+"?"+expand, &page)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	} else {
+		for start := 0; l.WikiPages == 0 || len(pages) < l.WikiPages; {
+			limit := 25
+			if l.WikiPages > 0 {
+				limit = min(limit, l.WikiPages-len(pages))
+			}
+
+			var result struct {
+				Results []confluencePage `json:"results"`
+				Size    int              `json:"size"`
+			}
+
+			err := confluenceGet(ctx, base, fmt.Sprintf("/content?type=page&spaceKey=%s&start=%d&limit=%d&%s", url.QueryEscape(spaceKey), start, limit, expand), &result)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, result.Results...)
+			start += result.Size
+			if result.Size < limit {
+				break
+			}
+		}
+	}
+
+	docs := make([]schema.Document, 0, len(pages))
+	for _, page := range pages {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page.Body.Storage.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, schema.Document{
+			PageContent: "# " + page.Title + "\n\n" + collapseWhitespace(doc.Selection),
+			Metadata: map[string]any{
+				"source":  base + page.Links.WebUI,
+				"title":   page.Title,
+				"space":   page.Space.Name,
+				"updated": page.Version.When,
+			},
+		})
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded", len(docs), "Confluence pages")
+
+	return docs, nil
+}
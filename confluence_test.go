@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfluenceSource(t *testing.T) {
+	tests := []struct {
+		site   string
+		source string
+		// page and space are the ones named by source, both empty when it isn't of the site.
+		page, space string
+	}{
+		{"https://example.atlassian.net/wiki", "https://example.atlassian.net/wiki/spaces/ENG/pages/123/Title", "123", ""},
+		{"https://example.atlassian.net/wiki/", "https://example.atlassian.net/wiki/spaces/ENG/overview", "", "ENG"},
+		{"https://example.atlassian.net/wiki", "confluence:page:456", "456", ""},
+		{"https://wiki.example.com", "https://wiki.example.com/pages/viewpage.action?pageId=789", "789", ""},
+		{"https://wiki.example.com", "confluence:space:OPS", "", "OPS"},
+		// Other Atlassian Cloud sites, other hosts sharing the prefix and plain http don't get the credentials.
+		{"https://example.atlassian.net/wiki", "https://evil.atlassian.net/wiki/spaces/ENG/pages/123", "", ""},
+		{"https://wiki.example.com", "https://wiki.example.com.evil.com/spaces/ENG/pages/123", "", ""},
+		{"https://wiki.example.com", "http://wiki.example.com/spaces/ENG/pages/123", "", ""},
+		{"https://example.atlassian.net/wiki", "https://example.atlassian.net/wikis/spaces/ENG/pages/123", "", ""},
+		{"http://wiki.example.com", "http://wiki.example.com/spaces/ENG/pages/123", "", ""},
+		{"http://wiki.example.com", "confluence:page:456", "", ""},
+		{"", "https://example.atlassian.net/wiki/spaces/ENG/pages/123", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CONFLUENCE_URL", tt.site)
+
+		base, page, space, ok := confluenceSource(tt.source)
+		if tt.page == "" && tt.space == "" {
+			if ok {
+				t.Errorf("%s on %s: got %s page %q space %q, want none", tt.source, tt.site, base, page, space)
+			}
+			continue
+		}
+		if !ok || page != tt.page || space != tt.space {
+			t.Errorf("%s on %s: got page %q space %q, want page %q space %q", tt.source, tt.site, page, space, tt.page, tt.space)
+		}
+		if want := strings.TrimSuffix(tt.site, "/"); base != want {
+			t.Errorf("%s on %s: got base %s, want %s", tt.source, tt.site, base, want)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/tmc/langchaingo/llms"
+)
+
+type ConverseRequest struct {
+	Messages        []ConverseMessage        `json:"messages"`
+	System          []ConverseContent        `json:"system,omitempty"`
+	InferenceConfig ConverseInferenceConfig  `json:"inferenceConfig"`
+	GuardrailConfig *ConverseGuardrailConfig `json:"guardrailConfig,omitempty"`
+	// AdditionalModelRequestFields are passed on to the model as fields of its own payload.
+	AdditionalModelRequestFields map[string]any `json:"additionalModelRequestFields,omitempty"`
+}
+
+type ConverseMessage struct {
+	Role    string            `json:"role"`
+	Content []ConverseContent `json:"content"`
+}
+
+type ConverseContent struct {
+	Text  string         `json:"text,omitempty"`
+	Image *ConverseImage `json:"image,omitempty"`
+}
+
+type ConverseImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes []byte `json:"bytes"`
+	} `json:"source"`
+}
+
+type ConverseInferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   float64  `json:"temperature,omitempty"`
+	TopP          float64  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ConverseGuardrailConfig struct {
+	GuardrailIdentifier string `json:"guardrailIdentifier"`
+	GuardrailVersion    string `json:"guardrailVersion"`
+	Trace               string `json:"trace"`
+}
+
+type ConverseUsage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+type ConverseMetrics struct {
+	LatencyMs int `json:"latencyMs"`
+}
+
+type ConverseResponse struct {
+	Output struct {
+		Message ConverseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string          `json:"stopReason"`
+	Usage      ConverseUsage   `json:"usage"`
+	Metrics    ConverseMetrics `json:"metrics"`
+	Trace      map[string]any  `json:"trace"`
+}
+
+// converseStreamEvent is a ConverseStream event keyed by its event type, the way converseClient hands it to the Model.
+type converseStreamEvent struct {
+	ContentBlockDelta *struct {
+		Delta ConverseContent `json:"delta"`
+	} `json:"contentBlockDelta"`
+	MessageStop *struct {
+		StopReason string `json:"stopReason"`
+	} `json:"messageStop"`
+	Metadata *struct {
+		Usage ConverseUsage `json:"usage"`
+	} `json:"metadata"`
+}
+
+// ConverseCodec speaks the Converse API, which has the same request and response shape for every text model.
+type ConverseCodec struct {
+	guardrail Guardrail
+	minP      float64
+}
+
+func (c ConverseCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return c.EncodeImageRequest(system, prompt, nil, opts)
+}
+
+func (c ConverseCodec) EncodeImageRequest(system, prompt string, images []Image, opts *llms.CallOptions) ([]byte, error) {
+	req := ConverseRequest{
+		Messages: []ConverseMessage{
+			{Role: "user", Content: converseContent(prompt, images)},
+		},
+		InferenceConfig: ConverseInferenceConfig{
+			MaxTokens:     opts.MaxTokens,
+			Temperature:   opts.Temperature,
+			TopP:          opts.TopP,
+			StopSequences: opts.StopWords,
+		},
+	}
+	if system != "" {
+		req.System = []ConverseContent{{Text: system}}
+	}
+	req.AdditionalModelRequestFields = c.samplingFields(opts)
+	if c.guardrail.ID != "" {
+		req.GuardrailConfig = &ConverseGuardrailConfig{
+			GuardrailIdentifier: c.guardrail.ID,
+			GuardrailVersion:    c.guardrail.Version,
+			Trace:               "enabled",
+		}
+	}
+
+	return json.Marshal(req)
+}
+
+// samplingFields are the sampling controls the inference configuration has no field for, under
+// the names most model payloads give them.
+func (c ConverseCodec) samplingFields(opts *llms.CallOptions) map[string]any {
+	fields := map[string]any{}
+	if opts.TopK != 0 {
+		fields["top_k"] = opts.TopK
+	}
+	if opts.Seed != 0 {
+		fields["seed"] = opts.Seed
+	}
+	if opts.RepetitionPenalty != 0 {
+		fields["repetition_penalty"] = opts.RepetitionPenalty
+	}
+	if opts.FrequencyPenalty != 0 {
+		fields["frequency_penalty"] = opts.FrequencyPenalty
+	}
+	if opts.PresencePenalty != 0 {
+		fields["presence_penalty"] = opts.PresencePenalty
+	}
+	if c.minP != 0 {
+		fields["min_p"] = c.minP
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return fields
+}
+
+// converseContent puts the images ahead of the prompt, as the Converse and Nova payloads expect.
+func converseContent(prompt string, images []Image) []ConverseContent {
+	content := make([]ConverseContent, 0, len(images)+1)
+	for _, image := range images {
+		block := ConverseContent{Image: &ConverseImage{Format: image.format()}}
+		block.Image.Source.Bytes = image.Data
+		content = append(content, block)
+	}
+
+	return append(content, ConverseContent{Text: prompt})
+}
+
+func (ConverseCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp ConverseResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	var completion strings.Builder
+	for _, content := range resp.Output.Message.Content {
+		completion.WriteString(content.Text)
+	}
+
+	r := Response{
+		Completion: completion.String(),
+		Usage:      Usage{InputTokens: resp.Usage.InputTokens, OutputTokens: resp.Usage.OutputTokens},
+		StopReason: resp.StopReason,
+		Metadata:   ResponseMetadata{ModelLatency: time.Duration(resp.Metrics.LatencyMs) * time.Millisecond},
+	}
+	if resp.StopReason == "guardrail_intervened" {
+		r.Guardrail = guardrailResult{Action: "INTERVENED", Trace: resp.Trace}
+	}
+
+	return r, nil
+}
+
+func (ConverseCodec) DecodeChunk(body []byte) (string, error) {
+	var event converseStreamEvent
+
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return "", err
+	}
+
+	if event.ContentBlockDelta == nil {
+		return "", nil
+	}
+
+	return event.ContentBlockDelta.Delta.Text, nil
+}
+
+// WithConverse makes the Model call the Converse and ConverseStream APIs instead of InvokeModel,
+// so any text model Bedrock supports can be used without a model specific Codec.
+func WithConverse() ModelOption {
+	return func(m *Model) {
+		m.converse = true
+	}
+}
+
+// converseClient implements BedrockInvoker on top of the Converse APIs. The payloads are produced
+// by ConverseCodec, and the responses handed back in the same JSON shape.
+type converseClient struct {
+	client *bedrockruntime.Client
+}
+
+func newConverseClient() BedrockInvoker {
+	return newRegionFailover(func(cfg aws.Config) BedrockInvoker {
+		return converseClient{client: bedrockruntime.NewFromConfig(cfg)}
+	})
+}
+
+// converseInput decodes a ConverseCodec payload into the input of Converse.
+func converseInput(modelID *string, payload []byte) (*bedrockruntime.ConverseInput, error) {
+	var req ConverseRequest
+
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &bedrockruntime.ConverseInput{ModelId: modelID}
+	for _, msg := range req.Messages {
+		message := types.Message{Role: types.ConversationRole(msg.Role)}
+		for _, content := range msg.Content {
+			if content.Image != nil {
+				message.Content = append(message.Content, &types.ContentBlockMemberImage{Value: types.ImageBlock{
+					Format: types.ImageFormat(content.Image.Format),
+					Source: &types.ImageSourceMemberBytes{Value: content.Image.Source.Bytes},
+				}})
+			}
+			if content.Text != "" {
+				message.Content = append(message.Content, &types.ContentBlockMemberText{Value: content.Text})
+			}
+		}
+		in.Messages = append(in.Messages, message)
+	}
+	for _, content := range req.System {
+		in.System = append(in.System, &types.SystemContentBlockMemberText{Value: content.Text})
+	}
+
+	config := req.InferenceConfig
+	in.InferenceConfig = &types.InferenceConfiguration{StopSequences: config.StopSequences}
+	if config.MaxTokens != 0 {
+		in.InferenceConfig.MaxTokens = aws.Int32(int32(config.MaxTokens))
+	}
+	if config.Temperature != 0 {
+		in.InferenceConfig.Temperature = aws.Float32(float32(config.Temperature))
+	}
+	if config.TopP != 0 {
+		in.InferenceConfig.TopP = aws.Float32(float32(config.TopP))
+	}
+
+	if req.GuardrailConfig != nil {
+		in.GuardrailConfig = &types.GuardrailConfiguration{
+			GuardrailIdentifier: aws.String(req.GuardrailConfig.GuardrailIdentifier),
+			GuardrailVersion:    aws.String(req.GuardrailConfig.GuardrailVersion),
+			Trace:               types.GuardrailTrace(req.GuardrailConfig.Trace),
+		}
+	}
+	if req.AdditionalModelRequestFields != nil {
+		in.AdditionalModelRequestFields = document.NewLazyDocument(req.AdditionalModelRequestFields)
+	}
+
+	return in, nil
+}
+
+func converseUsage(usage *types.TokenUsage) ConverseUsage {
+	if usage == nil {
+		return ConverseUsage{}
+	}
+
+	return ConverseUsage{InputTokens: int(aws.ToInt32(usage.InputTokens)), OutputTokens: int(aws.ToInt32(usage.OutputTokens))}
+}
+
+// converseTrace turns the guardrail trace of a response into the JSON object the Model reports.
+func converseTrace(trace any) map[string]any {
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return nil
+	}
+
+	var m map[string]any
+	_ = json.Unmarshal(data, &m)
+
+	return m
+}
+
+func (c converseClient) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	in, err := converseInput(params.ModelId, params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.client.Converse(ctx, in, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ConverseResponse
+	resp.Output.Message.Role = "assistant"
+	if msg, ok := out.Output.(*types.ConverseOutputMemberMessage); ok {
+		resp.Output.Message.Role = string(msg.Value.Role)
+		for _, content := range msg.Value.Content {
+			if text, ok := content.(*types.ContentBlockMemberText); ok {
+				resp.Output.Message.Content = append(resp.Output.Message.Content, ConverseContent{Text: text.Value})
+			}
+		}
+	}
+	resp.StopReason = string(out.StopReason)
+	resp.Usage = converseUsage(out.Usage)
+	if out.Metrics != nil {
+		resp.Metrics.LatencyMs = int(aws.ToInt64(out.Metrics.LatencyMs))
+	}
+	if out.Trace != nil {
+		resp.Trace = converseTrace(out.Trace)
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bedrockruntime.InvokeModelOutput{Body: body, ContentType: aws.String("application/json"), ResultMetadata: out.ResultMetadata}, nil
+}
+
+func (c converseClient) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (ResponseEventStream, error) {
+	in, err := converseInput(params.ModelId, params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	streamIn := &bedrockruntime.ConverseStreamInput{
+		ModelId:                      in.ModelId,
+		Messages:                     in.Messages,
+		System:                       in.System,
+		InferenceConfig:              in.InferenceConfig,
+		AdditionalModelRequestFields: in.AdditionalModelRequestFields,
+	}
+	if g := in.GuardrailConfig; g != nil {
+		streamIn.GuardrailConfig = &types.GuardrailStreamConfiguration{
+			GuardrailIdentifier: g.GuardrailIdentifier,
+			GuardrailVersion:    g.GuardrailVersion,
+			Trace:               g.Trace,
+		}
+	}
+
+	out, err := c.client.ConverseStream(ctx, streamIn, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &converseStream{
+		stream: out.GetStream(),
+		events: make(chan types.ResponseStream),
+		done:   make(chan struct{}),
+	}
+	go s.read()
+
+	return s, nil
+}
+
+// converseStream turns the events of ConverseStream into chunks whose bytes are a converseStreamEvent.
+type converseStream struct {
+	stream *bedrockruntime.ConverseStreamEventStream
+	events chan types.ResponseStream
+	done   chan struct{}
+	err    error
+}
+
+func (s *converseStream) read() {
+	defer close(s.events)
+
+	for event := range s.stream.Events() {
+		var chunk any
+		switch event := event.(type) {
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			text, ok := event.Value.Delta.(*types.ContentBlockDeltaMemberText)
+			if !ok {
+				continue
+			}
+			chunk = map[string]any{"contentBlockDelta": map[string]any{"delta": ConverseContent{Text: text.Value}}}
+		case *types.ConverseStreamOutputMemberMessageStop:
+			chunk = map[string]any{"messageStop": map[string]any{"stopReason": event.Value.StopReason}}
+		case *types.ConverseStreamOutputMemberMetadata:
+			var metrics ConverseMetrics
+			if event.Value.Metrics != nil {
+				metrics.LatencyMs = int(aws.ToInt64(event.Value.Metrics.LatencyMs))
+			}
+			metadata := map[string]any{"usage": converseUsage(event.Value.Usage), "metrics": metrics}
+			if event.Value.Trace != nil {
+				metadata["trace"] = converseTrace(event.Value.Trace)
+			}
+			chunk = map[string]any{"metadata": metadata}
+		default:
+			continue
+		}
+
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		select {
+		case s.events <- &types.ResponseStreamMemberChunk{Value: types.PayloadPart{Bytes: data}}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *converseStream) Events() <-chan types.ResponseStream {
+	return s.events
+}
+
+func (s *converseStream) Close() error {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	return s.stream.Close()
+}
+
+func (s *converseStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.stream.Err()
+}
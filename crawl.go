@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/prompts"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// crawlerAgent is the User-Agent of the crawler, and the name it looks for in robots.txt.
+const crawlerAgent = "bedrock-langchain"
+
+const crawlMapTemplate = `Summarize the main points of this page of a website in a few sentences.
+
+{{.context}}
+
+SUMMARY:`
+
+const crawlReduceTemplate = `These are summaries of the pages of a website:
+
+{{.context}}
+
+Using them, write an overview of the whole website. {{.question}}`
+
+type CrawlFlags struct {
+	Crawl string
+	Depth int
+	Pages int
+	Delay time.Duration
+}
+
+func (f *CrawlFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Crawl, "crawl", "", "sitemap.xml or root link of a website whose pages are summarized into an overview of the site")
+	fs.IntVar(&f.Depth, "crawl-depth", 2, "number of links followed from the -crawl root link")
+	fs.IntVar(&f.Pages, "crawl-pages", 50, "maximum number of pages crawled")
+	fs.DurationVar(&f.Delay, "crawl-delay", time.Second, "minimum time between two requests to the site, raised by the Crawl-delay of robots.txt")
+}
+
+// Crawler fetches the pages of a website, following its sitemap or its links, within the rules of its robots.txt.
+type Crawler struct {
+	Loader  LoaderFlags
+	Depth   int
+	Pages   int
+	Delay   time.Duration
+	Workers int
+
+	robots robotsRules
+	tick   <-chan time.Time
+	mu     sync.Mutex
+	seen   map[string]bool
+}
+
+// Crawl loads the pages of the site at start, a sitemap or any page of the site, as one document each.
+func (c *Crawler) Crawl(ctx context.Context, start string) ([]schema.Document, error) {
+	root, err := url.Parse(start)
+	if err != nil {
+		return nil, err
+	}
+
+	c.robots = getRobots(root)
+	c.seen = map[string]bool{}
+	if delay := max(c.Delay, c.robots.delay); delay > 0 {
+		ticker := time.NewTicker(delay)
+		defer ticker.Stop()
+		c.tick = ticker.C
+	}
+
+	var links []string
+	depth := c.Depth
+	if strings.HasSuffix(root.Path, ".xml") {
+		links, err = c.sitemapLinks(ctx, root, start)
+		if err != nil {
+			return nil, err
+		}
+		depth = 0
+	} else {
+		links = []string{start}
+	}
+
+	var docs []schema.Document
+	for level := 0; level <= depth && len(links) > 0 && len(docs) < c.Pages; level++ {
+		var next []string
+		links = c.allowed(links, c.Pages-len(docs))
+
+		loaded, found := c.fetchAll(ctx, links)
+		docs = append(docs, loaded...)
+		for _, link := range found {
+			if sameSite(root, link) {
+				next = append(next, link)
+			}
+		}
+		links = next
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no pages crawled from %s", start)
+	}
+
+	fmt.Fprintf(os.Stderr, "crawled %d pages of %s\n", len(docs), root.Host)
+
+	return docs, nil
+}
+
+// allowed keeps at most limit links that were not crawled yet and that robots.txt allows.
+func (c *Crawler) allowed(links []string, limit int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var kept []string
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || c.seen[link] || !c.robots.allows(u.EscapedPath()) {
+			continue
+		}
+		c.seen[link] = true
+		kept = append(kept, link)
+
+		if len(kept) == limit {
+			break
+		}
+	}
+
+	return kept
+}
+
+// fetchAll loads links with the crawler's workers, returning the documents and the links they contain.
+func (c *Crawler) fetchAll(ctx context.Context, links []string) ([]schema.Document, []string) {
+	docs := make([][]schema.Document, len(links))
+	found := make([][]string, len(links))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(c.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var err error
+				docs[i], found[i], err = c.fetch(ctx, links[i])
+				if err != nil {
+					log.Println("crawl:", err)
+				}
+			}
+		}()
+	}
+
+	for i := range links {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var allDocs []schema.Document
+	var allLinks []string
+	for i := range links {
+		allDocs = append(allDocs, docs[i]...)
+		allLinks = append(allLinks, found[i]...)
+	}
+
+	return allDocs, allLinks
+}
+
+func (c *Crawler) get(ctx context.Context, link string) (*http.Response, error) {
+	if c.tick != nil {
+		select {
+		case <-c.tick:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return fetch(ctx, link)
+}
+
+// fetch loads a page as one document and returns the links it contains.
+func (c *Crawler) fetch(ctx context.Context, link string) ([]schema.Document, []string, error) {
+	resp, err := c.get(ctx, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	format := c.Loader.Format
+	if format == "auto" {
+		format = formatFromContentType(resp.Header.Get("Content-Type"))
+	}
+
+	loaded, err := loadDocs(ctx, bytes.NewReader(body), format, c.Loader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", link, err)
+	}
+
+	var text []string
+	for _, doc := range loaded {
+		text = append(text, doc.PageContent)
+	}
+	docs := []schema.Document{{
+		PageContent: "URL: " + link + "\n\n" + strings.Join(text, "\n\n"),
+		Metadata:    map[string]any{"source": link},
+	}}
+
+	if format != "html" {
+		return docs, nil, nil
+	}
+
+	return docs, pageLinks(resp.Request.URL, body), nil
+}
+
+// pageLinks returns the absolute http and https links of an HTML page, without fragments.
+func pageLinks(base *url.URL, body []byte) []string {
+	page, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	page.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		u, err := base.Parse(a.AttrOr("href", ""))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment = ""
+		links = append(links, u.String())
+	})
+
+	return links
+}
+
+func sameSite(root *url.URL, link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && strings.EqualFold(u.Host, root.Host)
+}
+
+type sitemap struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapLinks returns the pages of a sitemap of the site of root, following the sitemaps of a sitemap
+// index, up to the page limit. Like the links of the pages, those of other sites are left out.
+func (c *Crawler) sitemapLinks(ctx context.Context, root *url.URL, link string) ([]string, error) {
+	resp, err := c.get(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var s sitemap
+
+	err = xml.NewDecoder(resp.Body).Decode(&s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", link, err)
+	}
+
+	var links []string
+	for _, u := range s.URLs {
+		if loc := strings.TrimSpace(u.Loc); sameSite(root, loc) {
+			links = append(links, loc)
+		}
+	}
+	for _, child := range s.Sitemaps {
+		if len(links) >= c.Pages {
+			break
+		}
+		loc := strings.TrimSpace(child.Loc)
+		if !sameSite(root, loc) {
+			continue
+		}
+
+		childLinks, err := c.sitemapLinks(ctx, root, loc)
+		if err != nil {
+			log.Println("crawl:", err)
+			continue
+		}
+		links = append(links, childLinks...)
+	}
+
+	return links, nil
+}
+
+// robotsRules are the Allow and Disallow path prefixes robots.txt sets for the crawler.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+	delay    time.Duration
+}
+
+// getRobots reads the robots.txt of the site of root, allowing everything when there is none.
+func getRobots(root *url.URL) robotsRules {
+	resp, err := fetch(context.Background(), root.Scheme+"://"+root.Host+"/robots.txt")
+	if err != nil {
+		return robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	return parseRobots(resp.Body)
+}
+
+// parseRobots keeps the rules of the group naming the crawler, or else of the * group.
+func parseRobots(r io.Reader) robotsRules {
+	groups := map[string]*robotsRules{}
+	var current []*robotsRules
+	var inRules bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share the rules that follow them.
+			if inRules {
+				current = nil
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			if groups[agent] == nil {
+				groups[agent] = &robotsRules{}
+			}
+			current = append(current, groups[agent])
+		case "allow", "disallow", "crawl-delay":
+			inRules = true
+			for _, g := range current {
+				switch {
+				case key == "allow" && value != "":
+					g.allow = append(g.allow, strings.TrimSuffix(value, "*"))
+				case key == "disallow" && value != "":
+					g.disallow = append(g.disallow, strings.TrimSuffix(value, "*"))
+				case key == "crawl-delay":
+					if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+						g.delay = time.Duration(seconds * float64(time.Second))
+					}
+				}
+			}
+		}
+	}
+
+	if g, ok := groups[crawlerAgent]; ok {
+		return *g
+	}
+	if g, ok := groups["*"]; ok {
+		return *g
+	}
+
+	return robotsRules{}
+}
+
+// allows reports whether path may be crawled: the longest matching rule wins, and Allow wins a tie.
+func (r robotsRules) allows(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	longest := func(prefixes []string) int {
+		n := -1
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) && len(prefix) > n {
+				n = len(prefix)
+			}
+		}
+		return n
+	}
+
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// summarizeSite summarizes each page, then answers question from the page summaries.
+func summarizeSite(ctx context.Context, large *Model, pages []schema.Document, question string, options ...chains.ChainCallOption) (string, error) {
+	mapChain := chains.NewLLMChain(large, prompts.NewPromptTemplate(crawlMapTemplate, []string{"context"}))
+	reduceChain := chains.NewStuffDocuments(chains.NewLLMChain(large, prompts.NewPromptTemplate(crawlReduceTemplate, []string{"context", "question"})))
+
+	chain := chains.NewMapReduceDocuments(mapChain, reduceChain)
+	chain.MaxNumberOfConcurrent = max(large.Concurrency, 1)
+
+	answer, err := chains.Call(ctx, chain, map[string]any{
+		"input_documents": pages,
+		"question":        question,
+	}, options...)
+	if err != nil {
+		return "", err
+	}
+
+	return answer["text"].(string), nil
+}
+
+// runCrawl crawls the -crawl site and prints and publishes the overview of it.
+func runCrawl(ctx context.Context, large *Model, publishers []Publisher, f Flags) {
+	crawler := &Crawler{Loader: f.LoaderFlags, Depth: f.Depth, Pages: f.Pages, Delay: f.Delay, Workers: f.Workers}
+
+	pages, err := crawler.Crawl(ctx, f.Crawl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Each page is summarized on its own, so it only has to fit the model, not share it with the others.
+	for i := range pages {
+		if fitted := fitDocuments(large, pages[i:i+1], large.DocumentBudget(f.MaxTokens)); len(fitted) == 1 {
+			pages[i] = fitted[0]
+		}
+	}
+
+	overview, err := summarizeSite(ctx, large, pages, f.Prompt, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.hashtags > 0 {
+		overview, err = fixHashtags(ctx, large, overview, f.hashtags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println(overview)
+
+	err = publish(ctx, publishers, Post{Title: "Overview of " + f.Crawl, Link: f.Crawl, Text: overview})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
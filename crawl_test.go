@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSitemapLinks(t *testing.T) {
+	var fetchedOther bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetchedOther = true
+		fmt.Fprintf(w, `<urlset><url><loc>%s/leaked</loc></url></urlset>`, "http://"+r.Host)
+	}))
+	defer other.Close()
+
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml</loc></sitemap><sitemap><loc>%s/sitemap.xml</loc></sitemap></sitemapindex>`, site.URL, other.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset><url><loc> %s/a </loc></url><url><loc>%s/b</loc></url><url><loc>/relative</loc></url></urlset>`, site.URL, other.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	root, err := url.Parse(site.URL + "/sitemap.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Crawler{Pages: 10}
+
+	links, err := c.sitemapLinks(context.Background(), root, root.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(links, " "), site.URL+"/a"; got != want {
+		t.Errorf("got links %s, want %s", got, want)
+	}
+	if fetchedOther {
+		t.Error("fetched the sitemap of another site")
+	}
+}
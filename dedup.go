@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// dedupDocs drops the chunks whose embedding is at least threshold similar to that of an earlier
+// chunk, such as the navigation and footers repeated on every scraped page. Identical chunks are
+// dropped without being embedded.
+func dedupDocs(ctx context.Context, embedder embeddings.Embedder, docs []schema.Document, threshold float64) ([]schema.Document, error) {
+	seen := map[string]bool{}
+	var unique []schema.Document
+	for _, doc := range docs {
+		if seen[doc.PageContent] {
+			continue
+		}
+		seen[doc.PageContent] = true
+		unique = append(unique, doc)
+	}
+	if len(unique) < 2 {
+		return unique, nil
+	}
+
+	texts := make([]string, len(unique))
+	for i, doc := range unique {
+		texts[i] = doc.PageContent
+	}
+	vectors, err := embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("deduplicating chunks: %w", err)
+	}
+
+	var kept []schema.Document
+	var keptVectors [][]float32
+	for i, doc := range unique {
+		duplicate := false
+		for _, vector := range keptVectors {
+			if cosineSimilarity(vectors[i], vector) >= threshold {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		kept = append(kept, doc)
+		keptVectors = append(keptVectors, vectors[i])
+	}
+
+	if dropped := len(docs) - len(kept); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d duplicate chunks of %d\n", dropped, len(docs))
+	}
+
+	return kept, nil
+}
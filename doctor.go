@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/tmc/langchaingo/llms"
+)
+
+type DoctorFlags struct {
+	AWSFlags
+	TransportFlags
+	Model     string
+	BaseModel string
+	Converse  bool
+	URL       string
+	NoInvoke  bool
+	Timeout   time.Duration
+}
+
+func parseDoctorFlags(args []string) DoctorFlags {
+	var f DoctorFlags
+
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.StringVar(&f.Model, "model", modelID, "Bedrock model ID, cross-region inference profile, or provisioned throughput, custom model, application inference profile or prompt router ARN")
+	fs.StringVar(&f.BaseModel, "base-model", "", "foundation model ID behind a provisioned throughput or custom model -model ARN, looked up when not given")
+	fs.BoolVar(&f.Converse, "converse", false, "call the model through the Converse API instead of InvokeModel")
+	fs.StringVar(&f.URL, "url", defaultURL, "link the pipeline will load, checked for network access, empty to skip")
+	fs.BoolVar(&f.NoInvoke, "no-invoke", false, "only look the model up instead of invoking it for one token")
+	fs.DurationVar(&f.Timeout, "timeout", 30*time.Second, "timeout of each check")
+	f.AWSFlags.register(fs)
+	f.TransportFlags.register(fs)
+	_ = fs.Parse(args)
+
+	return f
+}
+
+// doctorCheck is one step of the doctor command. run returns what it found, or an error with
+// what to do about it.
+type doctorCheck struct {
+	name string
+	// aws checks need the region and credentials to work.
+	aws bool
+	run func(ctx context.Context) (string, error)
+}
+
+// runDoctor checks, before a long run, that the AWS configuration, the model and the link all work,
+// and exits with status 1 when one doesn't.
+func runDoctor(f DoctorFlags) {
+	awsFlags = f.AWSFlags
+	transportFlags = f.TransportFlags
+	cfg := loadAWSConfig()
+
+	baseModel := f.BaseModel
+	// The model is only invoked once it is known to exist and to have a payload format.
+	modelFound := false
+
+	checks := []doctorCheck{
+		{"region", true, func(context.Context) (string, error) {
+			if cfg.Region == "" {
+				return "", errors.New("no region configured, set -region, AWS_REGION or the region of the profile")
+			}
+			return cfg.Region, nil
+		}},
+		{"credentials", true, func(ctx context.Context) (string, error) {
+			identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+			if err != nil {
+				return "", fmt.Errorf("%w, check -profile, -role-arn or the AWS_* environment variables", err)
+			}
+			return aws.ToString(identity.Arn), nil
+		}},
+		{"model", true, func(ctx context.Context) (string, error) {
+			if baseModel == "" && baseModelUnknown(f.Model) {
+				base, err := lookupBaseModel(ctx, f.Model)
+				if err != nil {
+					return "", fmt.Errorf("%w, name the foundation model with -base-model", err)
+				}
+				baseModel = base
+			}
+			if baseModel == "" {
+				baseModel = baseModelID(f.Model)
+			}
+
+			_, err := codecForModel(baseModel)
+			if err != nil && !f.Converse {
+				return "", fmt.Errorf("%w, call it with -converse or pick a model listed by the models command", err)
+			}
+
+			out, err := bedrock.NewFromConfig(cfg).GetFoundationModel(ctx, &bedrock.GetFoundationModelInput{ModelIdentifier: aws.String(baseModel)})
+			if err != nil {
+				return "", doctorHint(baseModel, err)
+			}
+			modelFound = true
+			model := out.ModelDetails
+			if model.ModelLifecycle != nil && model.ModelLifecycle.Status != types.FoundationModelLifecycleStatusActive {
+				return fmt.Sprintf("%s is %s and will be retired", aws.ToString(model.ModelId), model.ModelLifecycle.Status), nil
+			}
+			return aws.ToString(model.ModelName) + " by " + aws.ToString(model.ProviderName), nil
+		}},
+		{"invocation", true, func(ctx context.Context) (string, error) {
+			if f.NoInvoke || !modelFound {
+				return "skipped", nil
+			}
+
+			options := []ModelOption{WithBaseModel(baseModel)}
+			if f.Converse {
+				options = append(options, WithConverse())
+			}
+			large := newLargeLanguageModel(f.Model, options...)
+
+			start := time.Now()
+			_, err := large.Call(ctx, "Reply with OK.", llms.WithMaxTokens(1))
+			if err != nil {
+				return "", doctorHint(f.Model, err)
+			}
+			return fmt.Sprintf("%s answered in %s", f.Model, time.Since(start).Round(time.Millisecond)), nil
+		}},
+		{"network", false, func(ctx context.Context) (string, error) {
+			if f.URL == "" {
+				return "skipped", nil
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+			if err != nil {
+				return "", err
+			}
+			client, err := fetchFlags.client()
+			if err != nil {
+				return "", err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", fmt.Errorf("%w, check the proxy settings (-proxy or HTTPS_PROXY), the -ca-bundle and the outbound rules of the network", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusBadRequest {
+				return "", fmt.Errorf("%s answered %s", f.URL, resp.Status)
+			}
+			return fmt.Sprintf("%s answered %s", f.URL, resp.Status), nil
+		}},
+	}
+
+	failed, awsFailed := false, false
+	for _, check := range checks {
+		if check.aws && awsFailed {
+			fmt.Printf("skip %s\n", check.name)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.Timeout)
+		result, err := check.run(ctx)
+		cancel()
+
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL %-11s %v\n", check.name, err)
+			// Without a region or credentials, the other AWS checks only repeat the failure.
+			awsFailed = check.name == "region" || check.name == "credentials"
+			continue
+		}
+		fmt.Printf("ok   %-11s %s\n", check.name, result)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// doctorHint adds to a failed Bedrock call what to do about it.
+func doctorHint(modelID string, err error) error {
+	err = bedrockError(modelID, err)
+
+	switch {
+	case errors.Is(err, ErrAccessDenied):
+		return fmt.Errorf("%w, request access to the model on the Model access page of the Bedrock console, and allow bedrock:InvokeModel in the IAM policy", err)
+	case errors.Is(err, ErrModelNotFound):
+		return fmt.Errorf("%w, check the model ID and region, the models command lists those available", err)
+	case errors.Is(err, ErrThrottled):
+		return fmt.Errorf("%w, the account is at its quota, try later or ask for a quota increase", err)
+	}
+
+	return err
+}
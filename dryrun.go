@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// WithDryRun makes the Model write the payload of each call to w, with its estimated tokens and
+// cost, instead of invoking Bedrock. The calls answer with an empty completion.
+func WithDryRun(w io.Writer) ModelOption {
+	return func(m *Model) {
+		m.dryRun = w
+	}
+}
+
+// printPayload writes the payload of a call the Model makes in a dry run, and counts the tokens
+// it would use in its usage, the output at its maximum.
+func (m *Model) printPayload(prompt string, payload []byte, opts *llms.CallOptions) (*llms.Generation, error) {
+	usage := Usage{InputTokens: m.GetNumTokens(prompt), OutputTokens: opts.MaxTokens}
+	m.usage.add(usage)
+
+	cost := "unknown cost"
+	if price, ok := priceFor(m.baseModel); ok {
+		cost = fmt.Sprintf("at most $%.4f", float64(usage.InputTokens)/1000*price.Input+float64(usage.OutputTokens)/1000*price.Output)
+	}
+
+	var indented bytes.Buffer
+	if json.Indent(&indented, payload, "", "  ") != nil {
+		indented.Reset()
+		indented.Write(payload)
+	}
+
+	fmt.Fprintf(m.dryRun, "--- %s: about %d input tokens, up to %d output tokens, %s\n%s\n",
+		m.invokeID(), usage.InputTokens, usage.OutputTokens, cost, indented.String())
+
+	return Response{Usage: usage}.generation(), nil
+}
+
+// printSelection writes which chunks of docs were fitted in the context window, in a dry run.
+func printSelection(w io.Writer, llm llms.LanguageModel, docs, fitted []schema.Document) {
+	fmt.Fprintf(w, "--- %d of %d chunks selected\n", len(fitted), len(docs))
+	for i, doc := range docs {
+		status := "dropped"
+		switch {
+		case i < len(fitted) && fitted[i].PageContent == doc.PageContent:
+			status = "selected"
+		case i < len(fitted):
+			status = "truncated"
+		}
+
+		preview := []rune(strings.Join(strings.Fields(doc.PageContent), " "))
+		if len(preview) > 60 {
+			preview = append(preview[:60], '…')
+		}
+		fmt.Fprintf(w, "%4d  %-9s  %6d tokens  %v  %s\n", i+1, status, llm.GetNumTokens(doc.PageContent), doc.Metadata["source"], string(preview))
+	}
+}
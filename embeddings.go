@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+const (
+	embeddingModelID = "amazon.titan-embed-text-v2:0"
+	cohereBatchSize  = 96
+)
+
+type TitanEmbeddingRequest struct {
+	InputText string `json:"inputText"`
+	Normalize bool   `json:"normalize"`
+}
+
+type TitanEmbeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+type CohereEmbeddingRequest struct {
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+}
+
+type CohereEmbeddingResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+type Embeddings struct {
+	bedrock BedrockInvoker
+	modelID string
+}
+
+var _ embeddings.Embedder = &Embeddings{}
+
+func newEmbeddings(modelID string) *Embeddings {
+	if !strings.HasPrefix(modelID, "amazon.titan-embed") && !strings.HasPrefix(modelID, "cohere.embed") {
+		log.Fatal(fmt.Errorf("unsupported embedding model %q", modelID))
+	}
+
+	return &Embeddings{
+		bedrock: newBedrockClient(),
+		modelID: modelID,
+	}
+}
+
+func (e *Embeddings) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if strings.HasPrefix(e.modelID, "cohere.") {
+		return e.embedCohere(ctx, texts, "search_document")
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector, err := e.embedTitan(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+func (e *Embeddings) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if strings.HasPrefix(e.modelID, "cohere.") {
+		vectors, err := e.embedCohere(ctx, []string{text}, "search_query")
+		if err != nil {
+			return nil, err
+		}
+		return vectors[0], nil
+	}
+
+	return e.embedTitan(ctx, text)
+}
+
+func (e *Embeddings) embedTitan(ctx context.Context, text string) ([]float32, error) {
+	payload, err := json.Marshal(TitanEmbeddingRequest{InputText: text, Normalize: true})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := e.invoke(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp TitanEmbeddingResponse
+
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Embedding, nil
+}
+
+func (e *Embeddings) embedCohere(ctx context.Context, texts []string, inputType string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += cohereBatchSize {
+		end := min(start+cohereBatchSize, len(texts))
+
+		payload, err := json.Marshal(CohereEmbeddingRequest{Texts: texts[start:end], InputType: inputType})
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := e.invoke(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp CohereEmbeddingResponse
+
+		err = json.Unmarshal(body, &resp)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(resp.Embeddings))
+		}
+
+		vectors = append(vectors, resp.Embeddings...)
+	}
+
+	return vectors, nil
+}
+
+func (e *Embeddings) invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	out, err := e.bedrock.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		Body:        payload,
+		ModelId:     aws.String(e.modelID),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
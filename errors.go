@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// The kinds of Bedrock failures callers react to, matched with errors.Is on the errors of the Model.
+var (
+	ErrThrottled       = errors.New("throttled by Bedrock")
+	ErrModelNotFound   = errors.New("model not found")
+	ErrAccessDenied    = errors.New("access denied")
+	ErrContextTooLong  = errors.New("context too long")
+	ErrContentFiltered = errors.New("content filtered")
+	// ErrCircuitOpen fails the calls to a model that keeps failing, without calling it.
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+// BedrockError is a failed Bedrock call. It matches its Kind, when it has one, and the error
+// returned by the SDK.
+type BedrockError struct {
+	ModelID string
+	// Code is the error code of the Bedrock API, such as ThrottlingException.
+	Code string
+	Kind error
+	Err  error
+}
+
+func (e *BedrockError) Error() string {
+	return fmt.Sprintf("%s: %v", e.ModelID, e.Err)
+}
+
+func (e *BedrockError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+
+	return []error{e.Kind, e.Err}
+}
+
+// bedrockError wraps an error of a Bedrock call in a BedrockError of the kind its API error code
+// and message tell, leaving other errors, such as a cancelled context, as they are.
+func bedrockError(modelID string, err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	return &BedrockError{ModelID: modelID, Code: apiErr.ErrorCode(), Kind: errorKind(apiErr), Err: err}
+}
+
+func errorKind(err smithy.APIError) error {
+	msg := strings.ToLower(err.ErrorMessage())
+
+	switch err.ErrorCode() {
+	case "ThrottlingException", "TooManyRequestsException", "ServiceQuotaExceededException":
+		return ErrThrottled
+	case "ResourceNotFoundException":
+		return ErrModelNotFound
+	case "AccessDeniedException":
+		return ErrAccessDenied
+	case "ValidationException":
+		// Bedrock reports these as validation errors, told apart only by their message.
+		switch {
+		case strings.Contains(msg, "too long"), strings.Contains(msg, "too many tokens"), strings.Contains(msg, "context length"), strings.Contains(msg, "context window"):
+			return ErrContextTooLong
+		case strings.Contains(msg, "model identifier is invalid"), strings.Contains(msg, "isn't supported"), strings.Contains(msg, "not supported"):
+			return ErrModelNotFound
+		case strings.Contains(msg, "content filter"), strings.Contains(msg, "blocked"):
+			return ErrContentFiltered
+		}
+	}
+
+	return nil
+}
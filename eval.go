@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const judgeModelID = "anthropic.claude-3-sonnet-20240229-v1:0"
+
+type EvalFlags struct {
+	AWSFlags
+	LoaderFlags
+	FetchFlags
+	TransportFlags
+	SplitterFlags
+	Dataset     string
+	Models      string
+	Templates   string
+	Variables   Variables
+	Judge       string
+	MaxTokens   int
+	Temperature float64
+	Workers     int
+	Report      string
+	Prices      string
+}
+
+func parseEvalFlags(args []string) EvalFlags {
+	var f EvalFlags
+
+	f.Variables = Variables{}
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	fs.StringVar(&f.Dataset, "dataset", "", "JSON Lines file of the cases, each a url, an optional reference summary and an optional max_words")
+	fs.StringVar(&f.Models, "models", modelID, "comma separated Bedrock models compared")
+	fs.StringVar(&f.Templates, "templates", defaultTemplate, "comma separated prompt templates compared, built-in names or files")
+	fs.Var(f.Variables, "var", "template variable as name=value, may be repeated")
+	fs.StringVar(&f.Judge, "judge-model", judgeModelID, "Bedrock model scoring the faithfulness and coverage of the summaries, empty to only compare them to the references")
+	fs.IntVar(&f.MaxTokens, "max-tokens", 500, "maximum number of tokens of a summary")
+	fs.Float64Var(&f.Temperature, "temperature", 0.1, "sampling temperature of the summaries")
+	fs.IntVar(&f.Workers, "workers", 4, "number of summaries made and scored concurrently")
+	fs.StringVar(&f.Report, "report", "", "file every scored summary is written to, as CSV when it ends in .csv and JSON otherwise")
+	fs.StringVar(&f.Prices, "prices", "", "JSON file of per-model prices, in USD per 1000 tokens, overriding the built-in table")
+	f.AWSFlags.register(fs)
+	f.LoaderFlags.register(fs)
+	f.FetchFlags.register(fs)
+	f.TransportFlags.register(fs)
+	f.SplitterFlags.register(fs)
+	_ = fs.Parse(args)
+
+	return f
+}
+
+// EvalCase is a link to summarize, with the summary expected of it when there is one.
+type EvalCase struct {
+	URL       string `json:"url"`
+	Reference string `json:"reference,omitempty"`
+	// MaxWords is the length the summary must keep to, the word_limit of the template by default.
+	MaxWords int `json:"max_words,omitempty"`
+}
+
+func readEvalCases(path string) ([]EvalCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cases []EvalCase
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var c EvalCase
+
+		err = json.Unmarshal([]byte(text), &c)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if c.URL == "" {
+			return nil, fmt.Errorf("%s:%d: no url", path, line)
+		}
+		cases = append(cases, c)
+	}
+
+	return cases, scanner.Err()
+}
+
+// EvalResult is the score of the summary a model made of a case with a template. Faithfulness and
+// Coverage are the 1 to 5 grades of the judge, and Overlap the unigram F1 of the summary and the
+// reference, each 0 when not scored.
+type EvalResult struct {
+	URL          string  `json:"url"`
+	Model        string  `json:"model"`
+	Template     string  `json:"template"`
+	Summary      string  `json:"summary,omitempty"`
+	Words        int     `json:"words"`
+	MaxWords     int     `json:"max_words"`
+	LengthOK     bool    `json:"length_ok"`
+	Faithfulness int     `json:"faithfulness,omitempty"`
+	Coverage     int     `json:"coverage,omitempty"`
+	Overlap      float64 `json:"overlap,omitempty"`
+	Explanation  string  `json:"explanation,omitempty"`
+	Latency      float64 `json:"latency_seconds"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// EvalSummary aggregates the results of a model and template, to choose between them on cost
+// and quality.
+type EvalSummary struct {
+	Model        string  `json:"model"`
+	Template     string  `json:"template"`
+	Runs         int     `json:"runs"`
+	Errors       int     `json:"errors"`
+	Faithfulness float64 `json:"faithfulness"`
+	Coverage     float64 `json:"coverage"`
+	Overlap      float64 `json:"overlap"`
+	LengthOK     float64 `json:"length_ok"`
+	Latency      float64 `json:"latency_seconds"`
+	Cost         float64 `json:"cost"`
+}
+
+const judgeTemplate = `You grade the summary of a document. Answer with a JSON object with these fields:
+- "faithfulness": 1 to 5, 5 when every statement of the summary is supported by the document, 1 when most are not.
+- "coverage": 1 to 5, 5 when the summary conveys every key point of the %s, 1 when it misses most of them.
+- "explanation": one sentence on the main flaw of the summary, empty if none.
+
+Document:
+%s
+%s
+Summary:
+%s`
+
+var judgeSchema = &JSONSchema{
+	Type: "object",
+	Properties: map[string]*JSONSchema{
+		"faithfulness": {Type: "integer", Enum: []any{1.0, 2.0, 3.0, 4.0, 5.0}},
+		"coverage":     {Type: "integer", Enum: []any{1.0, 2.0, 3.0, 4.0, 5.0}},
+		"explanation":  {Type: "string"},
+	},
+	Required: []string{"faithfulness", "coverage"},
+}
+
+// judge grades summary against the document, and its coverage against the reference summary
+// when there is one.
+func judge(ctx context.Context, llm *Model, docs []schema.Document, reference, summary string, result *EvalResult) error {
+	var document strings.Builder
+	for _, doc := range fitDocuments(llm, docs, llm.DocumentBudget(500)-llm.GetNumTokens(reference+summary)) {
+		document.WriteString(doc.PageContent)
+		document.WriteString("\n\n")
+	}
+
+	of, expected := "document", ""
+	if reference != "" {
+		of, expected = "reference summary", "\nReference summary:\n"+reference+"\n"
+	}
+
+	options := []llms.CallOption{llms.WithMaxTokens(500), llms.WithTemperature(0)}
+
+	answer, err := llm.Call(ctx, fmt.Sprintf(judgeTemplate, of, document.String(), expected, summary), options...)
+	if err != nil {
+		return err
+	}
+
+	v, err := JSONParser{Schema: judgeSchema}.parseWithRepair(ctx, llm, answer, options...)
+	if err != nil {
+		return err
+	}
+
+	grades := v.(map[string]any)
+	result.Faithfulness = int(grades["faithfulness"].(float64))
+	result.Coverage = int(grades["coverage"].(float64))
+	result.Explanation, _ = grades["explanation"].(string)
+
+	return nil
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// unigramF1 is the F1 score of the words summary shares with reference, close to ROUGE-1.
+func unigramF1(summary, reference string) float64 {
+	counts := map[string]int{}
+	for _, word := range words(reference) {
+		counts[word]++
+	}
+
+	summaryWords := words(summary)
+	common := 0
+	for _, word := range summaryWords {
+		if counts[word] > 0 {
+			counts[word]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+
+	precision := float64(common) / float64(len(summaryWords))
+	recall := float64(common) / float64(len(words(reference)))
+
+	return 2 * precision * recall / (precision + recall)
+}
+
+type evalJob struct {
+	c        EvalCase
+	docs     []schema.Document
+	model    *Model
+	template string
+	prompt   string
+}
+
+// evaluate summarizes every case with every model and template, and scores the summaries.
+func evaluate(ctx context.Context, cases []EvalCase, models []string, templates []string, judgeLLM *Model, f EvalFlags) ([]EvalResult, []EvalSummary, error) {
+	docs := make([][]schema.Document, len(cases))
+	for i, c := range cases {
+		var err error
+		docs[i], err = loadDocuments(ctx, c.URL, getDocs, f.LoaderFlags, f.SplitterFlags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", c.URL, err)
+		}
+	}
+
+	// Each model and template has its own Model, so the tokens it uses give its cost.
+	var jobs []evalJob
+	var summaries []EvalSummary
+	var summarizers []*Model
+	for _, id := range models {
+		for _, template := range templates {
+			tmpl, err := readTemplate(template)
+			if err != nil {
+				return nil, nil, err
+			}
+			prompt, err := fillTemplate(template, tmpl, f.Variables)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			large := newLargeLanguageModel(id)
+			summarizers = append(summarizers, large)
+			summaries = append(summaries, EvalSummary{Model: id, Template: template})
+			for i, c := range cases {
+				jobs = append(jobs, evalJob{c: c, docs: docs[i], model: large, template: template, prompt: prompt})
+			}
+		}
+	}
+
+	maxWords, _ := strconv.Atoi(f.Variables["word_limit"])
+	if maxWords == 0 {
+		maxWords, _ = strconv.Atoi(defaultVariables["word_limit"])
+	}
+
+	results := make([]EvalResult, len(jobs))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(f.Workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				job := jobs[i]
+				result := &results[i]
+				*result = EvalResult{URL: job.c.URL, Model: job.model.modelID, Template: job.template, MaxWords: maxWords}
+				if job.c.MaxWords > 0 {
+					result.MaxWords = job.c.MaxWords
+				}
+
+				start := time.Now()
+				fitted := fitDocuments(job.model, job.docs, job.model.DocumentBudget(f.MaxTokens))
+				summary, err := summarize(ctx, job.model, fitted, job.prompt, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature))
+				result.Latency = time.Since(start).Seconds()
+				if err != nil {
+					result.Error = err.Error()
+					continue
+				}
+
+				result.Summary = strings.TrimSpace(summary)
+				result.Words = len(strings.Fields(result.Summary))
+				result.LengthOK = result.Words <= result.MaxWords
+				if job.c.Reference != "" {
+					result.Overlap = unigramF1(result.Summary, job.c.Reference)
+				}
+
+				if judgeLLM != nil {
+					err = judge(ctx, judgeLLM, job.docs, job.c.Reference, result.Summary, result)
+					if err != nil {
+						result.Error = "judge: " + err.Error()
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i := range summaries {
+		summaries[i] = summarizeEval(summaries[i], results[i*len(cases):(i+1)*len(cases)], summarizers[i])
+	}
+
+	return results, summaries, nil
+}
+
+// summarizeEval averages the results of a model and template over the cases they were scored on.
+func summarizeEval(s EvalSummary, results []EvalResult, large *Model) EvalSummary {
+	var judged, compared int
+	for _, result := range results {
+		s.Runs++
+		s.Latency += result.Latency
+		if result.Error != "" {
+			s.Errors++
+		}
+		if result.LengthOK {
+			s.LengthOK++
+		}
+		if result.Faithfulness > 0 {
+			judged++
+			s.Faithfulness += float64(result.Faithfulness)
+			s.Coverage += float64(result.Coverage)
+		}
+		if result.Overlap > 0 {
+			compared++
+			s.Overlap += result.Overlap
+		}
+	}
+
+	if s.Runs > 0 {
+		s.LengthOK /= float64(s.Runs)
+		s.Latency /= float64(s.Runs)
+	}
+	if judged > 0 {
+		s.Faithfulness /= float64(judged)
+		s.Coverage /= float64(judged)
+	}
+	if compared > 0 {
+		s.Overlap /= float64(compared)
+	}
+	s.Cost = large.Usage().Cost
+
+	return s
+}
+
+func printEvalSummaries(w io.Writer, summaries []EvalSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tTEMPLATE\tRUNS\tERRORS\tFAITHFULNESS\tCOVERAGE\tOVERLAP\tLENGTH OK\tLATENCY\tCOST")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.0f%%\t%.1fs\t$%.4f\n",
+			s.Model, s.Template, s.Runs, s.Errors, s.Faithfulness, s.Coverage, s.Overlap, s.LengthOK*100, s.Latency, s.Cost)
+	}
+
+	return tw.Flush()
+}
+
+func writeEvalReport(path string, results []EvalResult, summaries []EvalSummary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{"summary": summaries, "results": results})
+	}
+
+	cw := csv.NewWriter(file)
+	err = cw.Write([]string{"url", "model", "template", "summary", "words", "max_words", "length_ok", "faithfulness", "coverage", "overlap", "explanation", "latency_seconds", "error"})
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		err = cw.Write([]string{r.URL, r.Model, r.Template, r.Summary, strconv.Itoa(r.Words), strconv.Itoa(r.MaxWords), strconv.FormatBool(r.LengthOK),
+			strconv.Itoa(r.Faithfulness), strconv.Itoa(r.Coverage), strconv.FormatFloat(r.Overlap, 'f', 3, 64), r.Explanation, strconv.FormatFloat(r.Latency, 'f', 2, 64), r.Error})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// runEval compares the summaries the -models make with the -templates of the -dataset links.
+func runEval(f EvalFlags) {
+	awsFlags = f.AWSFlags
+	fetchFlags = f.FetchFlags
+	transportFlags = f.TransportFlags
+
+	if f.Dataset == "" {
+		log.Fatal("eval needs a -dataset")
+	}
+	if f.Prices != "" {
+		err := loadPrices(f.Prices)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	cases, err := readEvalCases(f.Dataset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cases) == 0 {
+		log.Fatal("the -dataset has no case")
+	}
+
+	var judgeLLM *Model
+	if f.Judge != "" {
+		judgeLLM = newLargeLanguageModel(f.Judge)
+	}
+
+	results, summaries, err := evaluate(context.Background(), cases, modelList(f.Models), modelList(f.Templates), judgeLLM, f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = printEvalSummaries(os.Stdout, summaries)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.Report != "" {
+		err = writeEvalReport(f.Report, results, summaries)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if judgeLLM != nil {
+		printUsage(os.Stderr, judgeLLM.Usage())
+	}
+}
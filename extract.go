@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const extractPrompt = "Extract the following from the document, only what it states, without inventing anything. Leave a list empty when the document has nothing for it."
+
+// extractFields are the schemas of what -mode extract can pull from the documents.
+var extractFields = map[string]*JSONSchema{
+	"entities": {
+		Type:        "array",
+		Description: "people, organizations, places, products and other named entities the document mentions, each once",
+		Items: &JSONSchema{
+			Type: "object",
+			Properties: map[string]*JSONSchema{
+				"name": {Type: "string"},
+				"type": {Type: "string", Enum: []any{"person", "organization", "location", "product", "event", "other"}},
+			},
+			Required: []string{"name", "type"},
+		},
+	},
+	"key_points": {
+		Type:        "array",
+		Description: "the main points of the document, one short sentence each",
+		Items:       &JSONSchema{Type: "string"},
+	},
+	"dates": {
+		Type:        "array",
+		Description: "the dates the document mentions with what happens on them",
+		Items: &JSONSchema{
+			Type: "object",
+			Properties: map[string]*JSONSchema{
+				"date":  {Type: "string", Description: "as YYYY-MM-DD when the document gives the day, or as written"},
+				"event": {Type: "string"},
+			},
+			Required: []string{"date", "event"},
+		},
+	},
+	"action_items": {
+		Type:        "array",
+		Description: "tasks the document asks someone to do",
+		Items: &JSONSchema{
+			Type: "object",
+			Properties: map[string]*JSONSchema{
+				"task":  {Type: "string"},
+				"owner": {Type: "string", Description: "who is to do it, empty when the document doesn't say"},
+				"due":   {Type: "string", Description: "when it is due, empty when the document doesn't say"},
+			},
+			Required: []string{"task", "owner", "due"},
+		},
+	},
+}
+
+func extractFieldNames() []string {
+	names := make([]string, 0, len(extractFields))
+	for name := range extractFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// extractSchema is the schema of an object with the fields named in the comma separated list.
+func extractSchema(fields string) (*JSONSchema, error) {
+	s := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		field, ok := extractFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown -extract field %q, expected %s", name, strings.Join(extractFieldNames(), ", "))
+		}
+		s.Properties[name] = field
+		s.Required = append(s.Required, name)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// FakeInvoker is a BedrockInvoker that records the payloads it is sent and answers with canned bodies.
+type FakeInvoker struct {
+	// Body is returned by InvokeModel.
+	Body []byte
+	// Chunks are the payload parts returned, in order, by InvokeModelWithResponseStream.
+	Chunks [][]byte
+	// Err, when set, is returned by both calls.
+	Err error
+
+	mu       sync.Mutex
+	Requests []FakeRequest
+}
+
+type FakeRequest struct {
+	ModelID string
+	Body    []byte
+}
+
+var _ BedrockInvoker = &FakeInvoker{}
+
+func (f *FakeInvoker) record(modelID *string, body []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Requests = append(f.Requests, FakeRequest{ModelID: aws.ToString(modelID), Body: body})
+}
+
+func (f *FakeInvoker) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	f.record(params.ModelId, params.Body)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	return &bedrockruntime.InvokeModelOutput{Body: f.Body, ContentType: aws.String("application/json")}, nil
+}
+
+func (f *FakeInvoker) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (ResponseEventStream, error) {
+	f.record(params.ModelId, params.Body)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	events := make(chan types.ResponseStream, len(f.Chunks))
+	for _, chunk := range f.Chunks {
+		events <- &types.ResponseStreamMemberChunk{Value: types.PayloadPart{Bytes: chunk}}
+	}
+	close(events)
+
+	return &fakeStream{events: events}, nil
+}
+
+// LastRequest returns the payload of the most recent call.
+func (f *FakeInvoker) LastRequest() (FakeRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.Requests) == 0 {
+		return FakeRequest{}, errors.New("no requests recorded")
+	}
+
+	return f.Requests[len(f.Requests)-1], nil
+}
+
+type fakeStream struct {
+	events chan types.ResponseStream
+}
+
+func (s *fakeStream) Events() <-chan types.ResponseStream { return s.events }
+func (s *fakeStream) Close() error                        { return nil }
+func (s *fakeStream) Err() error                          { return nil }
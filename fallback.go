@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// WithFallbacks makes the Model retry a prompt on the fallback models, in order, when it is
+// throttled, not available to the account or region, or filters the content. The fallbacks are
+// created with the other options of the Model.
+func WithFallbacks(modelIDs ...string) ModelOption {
+	return func(m *Model) {
+		m.fallbackIDs = modelIDs
+	}
+}
+
+// modelList splits a comma separated list of model IDs.
+func modelList(list string) []string {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// shouldFallback reports whether another model may answer where the failing one did not.
+func shouldFallback(err error) bool {
+	return errors.Is(err, ErrThrottled) || errors.Is(err, ErrModelNotFound) ||
+		errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrContentFiltered) ||
+		errors.Is(err, ErrCircuitOpen)
+}
+
+// generate answers prompt with the Model, or the model it routes the prompt to, or with the first
+// of its fallbacks that succeeds.
+// The answering model is kept in the model_id generation info and in the answerRecord of ctx.
+func (m *Model) generate(ctx context.Context, prompt string, opts *llms.CallOptions) (*llms.Generation, error) {
+	// The fallbacks share the settings the caller gave the Model after creating it.
+	m.fallbackOnce.Do(func() {
+		for _, fallback := range append([]*Model{m.router}, m.fallbacks...) {
+			if fallback == nil {
+				continue
+			}
+			fallback.Timeout = m.Timeout
+			fallback.Cache = m.Cache
+			fallback.Auditor = m.Auditor
+		}
+	})
+
+	// A streamed answer cannot be taken back, so a model failing midway is not replaced.
+	var streamed bool
+	if streamingFunc := opts.StreamingFunc; streamingFunc != nil {
+		o := *opts
+		o.StreamingFunc = func(ctx context.Context, chunk []byte) error {
+			streamed = true
+			return streamingFunc(ctx, chunk)
+		}
+		opts = &o
+	}
+
+	answering := m.route(prompt)
+	fallbacks := m.fallbacks
+	if answering != m {
+		if debug {
+			log.Printf("routing the prompt to %s", answering.modelID)
+		}
+		// A routed prompt falls back to the Model first.
+		fallbacks = append([]*Model{m}, fallbacks...)
+	}
+
+	gen, err := answering.generateOnce(ctx, prompt, opts)
+	for _, fallback := range fallbacks {
+		if err == nil || streamed || !shouldFallback(err) {
+			break
+		}
+
+		log.Printf("%v, falling back to %s", err, fallback.modelID)
+		answering = fallback
+		gen, err = fallback.generateOnce(ctx, prompt, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if gen.GenerationInfo == nil {
+		gen.GenerationInfo = map[string]any{}
+	}
+	gen.GenerationInfo["model_id"] = answering.modelID
+	answerRecordFrom(ctx).set(answering.modelID)
+
+	return gen, nil
+}
+
+// answerRecord keeps the model that answered the last prompt of a context.
+type answerRecord struct {
+	mu      sync.Mutex
+	modelID string
+}
+
+type answerKey struct{}
+
+// withAnswerRecord returns a context whose Model calls record the model that answered them.
+func withAnswerRecord(ctx context.Context) (context.Context, *answerRecord) {
+	record := &answerRecord{}
+	return context.WithValue(ctx, answerKey{}, record), record
+}
+
+func answerRecordFrom(ctx context.Context) *answerRecord {
+	record, _ := ctx.Value(answerKey{}).(*answerRecord)
+	return record
+}
+
+func (r *answerRecord) set(modelID string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modelID = modelID
+}
+
+// ModelID is the model that answered last, or "" before any answer.
+func (r *answerRecord) ModelID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.modelID
+}
+
+// usageReports returns the usage of the Model and of the routed and fallback models that were called.
+func (m *Model) usageReports() []UsageReport {
+	reports := []UsageReport{m.Usage()}
+	if m.router != nil && m.router.Usage().Invocations > 0 {
+		reports = append(reports, m.router.Usage())
+	}
+	for _, fallback := range m.fallbacks {
+		if report := fallback.Usage(); report.Invocations > 0 {
+			reports = append(reports, report)
+		}
+	}
+
+	return reports
+}
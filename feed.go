@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type FeedEntry struct {
+	Title     string
+	Link      string
+	Published time.Time
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title   string `xml:"title"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Updated   string `xml:"updated"`
+		Published string `xml:"published"`
+	} `xml:"entry"`
+}
+
+func parseFeedTime(value string) time.Time {
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700"} {
+		t, err := time.Parse(layout, strings.TrimSpace(value))
+		if err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func parseFeed(data []byte) ([]FeedEntry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+
+	err := xml.Unmarshal(data, &root)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []FeedEntry
+
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+
+		err = xml.Unmarshal(data, &feed)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range feed.Items {
+			entries = append(entries, FeedEntry{
+				Title:     strings.TrimSpace(item.Title),
+				Link:      strings.TrimSpace(item.Link),
+				Published: parseFeedTime(item.PubDate),
+			})
+		}
+	case "feed":
+		var feed atomFeed
+
+		err = xml.Unmarshal(data, &feed)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range feed.Entries {
+			e := FeedEntry{Title: strings.TrimSpace(entry.Title), Published: parseFeedTime(entry.Published)}
+			if e.Published.IsZero() {
+				e.Published = parseFeedTime(entry.Updated)
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					e.Link = link.Href
+					break
+				}
+			}
+			entries = append(entries, e)
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed type %q", root.XMLName.Local)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Published.After(entries[j].Published)
+	})
+
+	return entries, nil
+}
+
+func getFeedEntries(link string, limit int) ([]FeedEntry, error) {
+	fmt.Fprintln(os.Stderr, "loading feed from", link)
+
+	data, err := fetchBytes(context.Background(), link)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseFeed(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func runFeed(large *Model, f Flags) {
+	entries, err := getFeedEntries(f.Feed, f.FeedLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	links := make([]string, len(entries))
+	for i, entry := range entries {
+		links[i] = entry.Link
+	}
+
+	publishers, err := newPublishers(f.Publish, f.DryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := f.PolicyFlags.policy(large)
+	if err != nil {
+		log.Fatal(err)
+	}
+	publishers = guard(publishers, policy)
+
+	results := summarizeBatch(context.Background(), large, links, f.Workers, f)
+	for i := range results {
+		results[i].Title = entries[i].Title
+	}
+	publishResults(context.Background(), publishers, results)
+
+	writeBatchReport(results, f.Report)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type FetchFlags struct {
+	FetchTimeout time.Duration
+	MaxBodySize  int64
+	MaxRedirects int
+	UserAgent    string
+	Headers      Headers
+	FetchAuthFlags
+}
+
+// fetchFlags configure every link loaded, with the defaults of the flags for the commands
+// without them.
+var fetchFlags = FetchFlags{FetchTimeout: 30 * time.Second, MaxBodySize: 20 << 20, MaxRedirects: 10, UserAgent: crawlerAgent}
+
+func (f *FetchFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.FetchTimeout, "fetch-timeout", 30*time.Second, "timeout of loading a link, body included, 0 for none")
+	fs.Int64Var(&f.MaxBodySize, "max-body-size", 20<<20, "maximum size in bytes of a loaded link, after decompression, 0 for no limit")
+	fs.IntVar(&f.MaxRedirects, "max-redirects", 10, "maximum number of redirects followed when loading a link")
+	fs.StringVar(&f.UserAgent, "user-agent", crawlerAgent, "User-Agent header sent when loading links")
+	fs.Var(&f.Headers, "header", "header sent when loading links, as \"Name: value\", may be repeated")
+	f.FetchAuthFlags.register(fs)
+}
+
+// Headers are the "Name: value" headers of the -header flag.
+type Headers []string
+
+func (h *Headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *Headers) Set(header string) error {
+	name, _, ok := strings.Cut(header, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header %q is not Name: value", header)
+	}
+	*h = append(*h, header)
+	return nil
+}
+
+func (f FetchFlags) client() (*http.Client, error) {
+	transport, err := fetchTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", f.MaxRedirects)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// fetch gets link as the fetch flags say.
+func fetch(ctx context.Context, link string) (*http.Response, error) {
+	return fetchFlags.fetch(ctx, link)
+}
+
+// fetch gets link as f says. The body of the response is decompressed when the server gzipped it,
+// fails to read past -max-body-size, and its timeout runs until it is closed.
+func (f FetchFlags) fetch(ctx context.Context, link string) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if f.FetchTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, f.FetchTimeout)
+	}
+
+	resp, err := f.get(ctx, link)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	body := &fetchBody{Reader: resp.Body, body: resp.Body, cancel: cancel}
+	resp.Body = body
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", link, resp.Status)
+	}
+	if f.MaxBodySize > 0 && resp.ContentLength > f.MaxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", link, errBodyTooLarge{f.MaxBodySize})
+	}
+
+	// The transport only decompresses what it asked for, not when -header sets Accept-Encoding.
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		body.Reader, err = gzip.NewReader(body.Reader)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %w", link, err)
+		}
+		resp.Header.Del("Content-Encoding")
+		resp.ContentLength = -1
+	}
+	if f.MaxBodySize > 0 {
+		body.Reader = &limitReader{r: body.Reader, n: f.MaxBodySize, max: f.MaxBodySize}
+	}
+
+	return resp, nil
+}
+
+func (f FetchFlags) get(ctx context.Context, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.UserAgent)
+	for _, header := range f.Headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	err = f.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+// fetchBody is the body of a fetched response, which ends its timeout when closed.
+type fetchBody struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *fetchBody) Close() error {
+	defer b.cancel()
+	return b.body.Close()
+}
+
+type errBodyTooLarge struct {
+	max int64
+}
+
+func (e errBodyTooLarge) Error() string {
+	return fmt.Sprintf("response larger than -max-body-size %d bytes", e.max)
+}
+
+// limitReader reads up to n bytes, failing when there are more instead of ending like an io.LimitReader.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// One more byte tells an exact fit from a longer body.
+		n, err := l.r.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, errBodyTooLarge{l.max}
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// fetchBytes reads the whole body of link.
+func fetchBytes(ctx context.Context, link string) ([]byte, error) {
+	return fetchFlags.fetchBytes(ctx, link)
+}
+
+func (f FetchFlags) fetchBytes(ctx context.Context, link string) ([]byte, error) {
+	resp, err := f.fetch(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", link, err)
+	}
+
+	return data, nil
+}
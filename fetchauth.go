@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FetchAuthFlags are the credentials links are loaded with, for pages behind a login such as
+// internal wikis. They are better given by environment variables or the netrc file, as the
+// arguments of a command are seen by every user of the machine.
+type FetchAuthFlags struct {
+	Cookies     Cookies
+	BearerToken string
+	BasicAuth   string
+	Netrc       string
+	AuthHosts   string
+}
+
+func (f *FetchAuthFlags) register(fs *flag.FlagSet) {
+	if cookie := os.Getenv("FETCH_COOKIE"); cookie != "" {
+		f.Cookies = Cookies{cookie}
+	}
+	fs.Var(&f.Cookies, "cookie", "cookies sent when loading links, as \"name=value; other=value\", may be repeated, added to FETCH_COOKIE")
+	fs.StringVar(&f.BearerToken, "bearer-token", os.Getenv("FETCH_BEARER_TOKEN"), "token sent as Authorization: Bearer when loading links")
+	fs.StringVar(&f.BasicAuth, "basic-auth", os.Getenv("FETCH_BASIC_AUTH"), "user:password sent as basic authentication when loading links")
+	fs.StringVar(&f.AuthHosts, "auth-hosts", os.Getenv("FETCH_AUTH_HOSTS"), "comma separated hosts -cookie, -bearer-token and -basic-auth are sent to, the host of -url when empty")
+	fs.StringVar(&f.Netrc, "netrc", os.Getenv("NETRC"), "netrc file of the logins and passwords of the sites links are loaded from, ~/.netrc when it exists")
+}
+
+// Cookies are the "name=value" cookies of the -cookie flag.
+type Cookies []string
+
+func (c *Cookies) String() string {
+	return strings.Join(*c, "; ")
+}
+
+func (c *Cookies) Set(cookie string) error {
+	for _, pair := range strings.Split(cookie, ";") {
+		name, _, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("cookie %q is not name=value", pair)
+		}
+	}
+	*c = append(*c, cookie)
+	return nil
+}
+
+// authorize adds the cookies and credentials to req. A bearer token is preferred to basic
+// authentication, which is preferred to the netrc login of the host. The cookies, token and basic
+// authentication are only sent to the -auth-hosts, as the links of a feed, a crawl or a server
+// request go anywhere. The client drops them when redirected to another domain.
+func (f FetchAuthFlags) authorize(req *http.Request) error {
+	authHost := f.authHost(req.URL.Hostname())
+	if len(f.Cookies) > 0 && authHost {
+		req.Header.Set("Cookie", f.Cookies.String())
+	}
+
+	switch {
+	case f.BearerToken != "" && authHost:
+		req.Header.Set("Authorization", "Bearer "+f.BearerToken)
+	case f.BasicAuth != "" && authHost:
+		user, password, _ := strings.Cut(f.BasicAuth, ":")
+		req.SetBasicAuth(user, password)
+	default:
+		login, err := f.netrcLogin(req.URL.Hostname())
+		if err != nil {
+			return err
+		}
+		if login.Login != "" {
+			req.SetBasicAuth(login.Login, login.Password)
+		}
+	}
+
+	return nil
+}
+
+// authHost reports whether host is one of the -auth-hosts.
+func (f FetchAuthFlags) authHost(host string) bool {
+	for _, h := range strings.Split(f.AuthHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scopeAuth returns f with the host of link as the -auth-hosts when none are given.
+func (f FetchAuthFlags) scopeAuth(link string) FetchAuthFlags {
+	if f.AuthHosts != "" {
+		return f
+	}
+	if u, err := url.Parse(link); err == nil {
+		f.AuthHosts = u.Hostname()
+	}
+
+	return f
+}
+
+// NetrcLogin is the login and password of a machine of a netrc file.
+type NetrcLogin struct {
+	Login    string
+	Password string
+}
+
+// netrcLogin returns the login of host in the netrc file, or none when there is no file.
+func (f FetchAuthFlags) netrcLogin(host string) (NetrcLogin, error) {
+	path := f.Netrc
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return NetrcLogin{}, nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && f.Netrc == "" {
+		return NetrcLogin{}, nil
+	}
+	if err != nil {
+		return NetrcLogin{}, err
+	}
+	defer file.Close()
+
+	logins, err := parseNetrc(file)
+	if err != nil {
+		return NetrcLogin{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if login, ok := logins[host]; ok {
+		return login, nil
+	}
+	return logins[""], nil
+}
+
+// parseNetrc reads the machine and default entries of a netrc file, the default one under the
+// empty host. Macro definitions are skipped.
+func parseNetrc(r io.Reader) (map[string]NetrcLogin, error) {
+	logins := map[string]NetrcLogin{}
+
+	scanner := bufio.NewScanner(r)
+	var tokens []string
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		// A macro definition runs until an empty line.
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if field == "macdef" {
+				fields = fields[:i]
+				inMacro = true
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	host, inEntry := "", false
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if i+1 >= len(tokens) {
+				return nil, errors.New("machine without a name")
+			}
+			i++
+			host, inEntry = tokens[i], true
+		case "default":
+			host, inEntry = "", true
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("%s without a value", tokens[i])
+			}
+			i++
+			if !inEntry {
+				continue
+			}
+			login := logins[host]
+			switch tokens[i-1] {
+			case "login":
+				login.Login = tokens[i]
+			case "password":
+				login.Password = tokens[i]
+			}
+			logins[host] = login
+		}
+	}
+
+	return logins, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type ServeFlags struct {
+	AWSFlags
+	LoaderFlags
+	FetchFlags
+	TransportFlags
+	SplitterFlags
+	CacheFlags
+	GuardrailFlags
+	SamplingFlags
+	AuditFlags
+	RateLimitFlags
+	CircuitFlags
+	RouterFlags
+	AuthFlags
+	Addr             string
+	Model            string
+	Debug            bool
+	Verbose          bool
+	Timeout          time.Duration
+	Converse         bool
+	System           string
+	Fallback         string
+	BaseModel        string
+	InferenceProfile string
+	Models           string
+	AdminKey         string
+	GracePeriod      time.Duration
+}
+
+type Flags struct {
+	AWSFlags
+	LoaderFlags
+	FetchFlags
+	TransportFlags
+	SplitterFlags
+	CacheFlags
+	GuardrailFlags
+	SamplingFlags
+	AuditFlags
+	RateLimitFlags
+	CircuitFlags
+	RouterFlags
+	VectorFlags
+	AgentFlags
+	WebSearchFlags
+	OutputFlags
+	PromptFlags
+	CrawlFlags
+	PIIFlags
+	PolicyFlags
+	URL              string
+	Model            string
+	Fallback         string
+	BaseModel        string
+	InferenceProfile string
+	MaxTokens        int
+	Temperature      float64
+	Debug            bool
+	Verbose          bool
+	Timeout          time.Duration
+	JSON             bool
+	Schema           string
+	Prices           string
+	URLs             string
+	Workers          int
+	Report           string
+	Checkpoint       string
+	BatchInference   string
+	BatchRole        string
+	Feed             string
+	FeedLimit        int
+	Interactive      bool
+	Mode             string
+	Question         string
+	Extract          string
+	Target           string
+	KnowledgeBase    string
+	Cite             bool
+	Memory           string
+	MemoryTokens     int
+	Converse         bool
+	System           string
+	Images           ImageSources
+	Card             string
+	CardModel        string
+	CharLimit        int
+	Thread           int
+	Publish          string
+	DryRun           bool
+	PrintPayload     bool
+	Schedule         string
+	MetricsAddr      string
+	GracePeriod      time.Duration
+	Compare          string
+	Hierarchical     bool
+	Incremental      bool
+
+	// hashtags is the number of hashtags the answer must end with, 0 when the prompt doesn't ask for any.
+	hashtags int
+}
+
+func parseFlags(args []string) Flags {
+	var f Flags
+
+	fs := flag.NewFlagSet("bedrock", flag.ExitOnError)
+	fs.StringVar(&f.URL, "url", defaultURL, "link, s3:// URI, postgres:// or mysql:// database, imaps:// mailbox, wikipedia:Title, arxiv:ID, file or directory of the content to summarize, - for stdin, empty to only send -image")
+	fs.StringVar(&f.Model, "model", modelID, "Bedrock model ID, cross-region inference profile, or provisioned throughput, custom model, application inference profile or prompt router ARN")
+	fs.StringVar(&f.BaseModel, "base-model", "", "foundation model ID behind a provisioned throughput or custom model -model ARN, looked up when not given")
+	fs.StringVar(&f.InferenceProfile, "inference-profile", "", "ARN of an application inference profile of -model, made with the profiles subcommand, the model is invoked through so its token spend is attributed to the tags of the profile")
+	fs.StringVar(&f.Fallback, "fallback", "", "comma separated Bedrock model IDs tried in order when -model is throttled, unavailable or filters the content")
+	fs.StringVar(&f.Compare, "compare", "", "comma separated Bedrock models the document is summarized with concurrently instead of -model, printed side by side with their latency and cost")
+	fs.IntVar(&f.MaxTokens, "max-tokens", 500, "maximum number of tokens to generate")
+	fs.Float64Var(&f.Temperature, "temperature", 0.1, "sampling temperature")
+	fs.BoolVar(&f.Debug, "debug", false, "log the payloads sent to Bedrock")
+	fs.BoolVar(&f.Verbose, "verbose", false, "write structured logs of LLM calls and chain steps to stderr")
+	fs.DurationVar(&f.Timeout, "timeout", 0, "timeout of each Bedrock call, 0 for none")
+	fs.BoolVar(&f.Converse, "converse", false, "call the model through the Converse API, which supports every Bedrock text model, instead of InvokeModel")
+	fs.StringVar(&f.System, "system", "", "system prompt sent with every call, e.g. to answer only from the document")
+	fs.BoolVar(&f.JSON, "json", false, "return structured JSON output instead of text")
+	fs.StringVar(&f.Schema, "schema", "", "JSON schema file the structured output is validated against")
+	fs.StringVar(&f.URLs, "urls", "", "file with one link per line to summarize in batch, or a JSON object of its url and its own model, max_tokens, temperature, top_p and top_k, - for stdin")
+	fs.IntVar(&f.Workers, "workers", 4, "number of links summarized, or pages and chunks mapped, concurrently, kept under -rps and -tpm")
+	fs.StringVar(&f.Checkpoint, "checkpoint", "", "JSONL file, or dynamodb:TABLE keyed by a string id, the progress of each -urls source is kept in, so an interrupted batch resumes without summarizing or publishing its sources again; delete it to start over")
+	fs.StringVar(&f.BatchInference, "batch-inference", "", "s3://bucket/prefix through which the -urls sources are summarized in a single Bedrock batch inference job, cheaper than a call for each but taking hours, and needing every document to fit in the context window")
+	fs.StringVar(&f.BatchRole, "batch-role", os.Getenv("BEDROCK_BATCH_ROLE"), "ARN of the service role a -batch-inference job reads and writes its S3 prefix with")
+	fs.StringVar(&f.Report, "report", "", "file the batch report is written to, as CSV when it ends in .csv and JSON otherwise")
+	fs.StringVar(&f.Feed, "feed", "", "RSS or Atom feed whose entries are summarized one by one")
+	fs.IntVar(&f.FeedLimit, "feed-limit", 10, "number of most recent feed entries to summarize, 0 for all")
+	fs.BoolVar(&f.Interactive, "interactive", false, "ask follow-up questions about the loaded document, or the -agent in -mode agent")
+	fs.StringVar(&f.Mode, "mode", "summarize", "summarize the document, qa to answer -question from it with citations of its chunks, kb to answer -question from the -knowledge-base instead, agent to send -question to the -agent, extract to pull the -extract fields from the document as JSON, sentiment to classify its sentiment and tone as JSON, seo to write its headline, meta description, slug and Open Graph text as JSON, or translate to translate it into -target")
+	fs.StringVar(&f.Question, "question", "", "question answered in -mode qa, kb or agent")
+	fs.StringVar(&f.Target, "target", "", "language -mode translate translates the document into, as a code such as de or a name")
+	fs.StringVar(&f.Extract, "extract", strings.Join(extractFieldNames(), ","), "comma separated fields -mode extract pulls from the document: "+strings.Join(extractFieldNames(), ", "))
+	fs.StringVar(&f.KnowledgeBase, "knowledge-base", "", "ID of the Bedrock knowledge base -mode kb retrieves from, the answer is generated by -model")
+	fs.BoolVar(&f.Cite, "cite", false, "cite the numbered document chunks the summary comes from, listed after it or as citations in -json output")
+	fs.StringVar(&f.Memory, "memory", "buffer", "conversation memory of interactive mode: buffer keeps every turn, token keeps the most recent within -memory-tokens")
+	fs.IntVar(&f.MemoryTokens, "memory-tokens", 2000, "maximum size of the token conversation memory")
+	fs.Var(&f.Images, "image", "link or file of an image sent along with the prompt to a multimodal model, may be repeated")
+	fs.StringVar(&f.Card, "card", "", "PNG file an illustration of the summary is written to, ready to post with it")
+	fs.StringVar(&f.CardModel, "card-model", cardModelID, "Bedrock Titan Image Generator or Stability model drawing the -card")
+	fs.IntVar(&f.CharLimit, "char-limit", 0, "also give a version of the summary of at most this many characters, 280 for X, 0 for none")
+	fs.IntVar(&f.Thread, "thread", 0, "also rewrite the summary as a thread of this many numbered posts of at most -char-limit characters, or 280 for X, published to X instead of the shortened version, 0 for none")
+	fs.StringVar(&f.Publish, "publish", "", "comma separated publishers of the summary: x (the -char-limit version), slack, discord, email, configured by environment variables")
+	fs.BoolVar(&f.DryRun, "dry-run", true, "only print what would be published")
+	fs.BoolVar(&f.PrintPayload, "print-payload", false, "print the Bedrock payloads of the summary, their estimated tokens and cost, and the chunks that fit the context window, without invoking the model")
+	fs.StringVar(&f.Schedule, "schedule", "", "JSON file of jobs summarizing links or feeds on cron schedules, run until stopped")
+	fs.StringVar(&f.MetricsAddr, "metrics-addr", "", "address Prometheus /metrics is served on while -schedule runs, e.g. :9090")
+	fs.DurationVar(&f.GracePeriod, "grace-period", 30*time.Second, "how long the running -schedule jobs are given to finish on SIGTERM or SIGINT before they are canceled")
+	fs.BoolVar(&f.Hierarchical, "hierarchical", false, "summarize documents too long for the context window chunk by chunk, then the summaries of the chunks until they fit, instead of truncating them")
+	fs.BoolVar(&f.Incremental, "incremental", false, "summarize each chunk of a source on its own and keep the summaries in -cache-dir, so a source summarized again only has its changed chunks summarized")
+	fs.StringVar(&f.Prices, "prices", "", "JSON file of per-model prices, in USD per 1000 tokens, overriding the built-in table")
+	f.AWSFlags.register(fs)
+	f.LoaderFlags.register(fs)
+	f.FetchFlags.register(fs)
+	f.TransportFlags.register(fs)
+	f.SplitterFlags.register(fs)
+	f.CacheFlags.register(fs)
+	f.GuardrailFlags.register(fs)
+	f.SamplingFlags.register(fs)
+	f.AuditFlags.register(fs)
+	f.RateLimitFlags.register(fs)
+	f.CircuitFlags.register(fs)
+	f.RouterFlags.register(fs)
+	f.VectorFlags.register(fs)
+	f.AgentFlags.register(fs)
+	f.WebSearchFlags.register(fs)
+	f.OutputFlags.register(fs)
+	f.PromptFlags.register(fs)
+	f.CrawlFlags.register(fs)
+	f.PIIFlags.register(fs)
+	f.PolicyFlags.register(fs)
+	err := applyConfig(fs, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_ = fs.Parse(args)
+
+	// The source may follow the flags instead of being given with -url, as in: cat article.txt | bedrock -
+	if fs.NArg() > 0 {
+		f.URL = fs.Arg(0)
+	}
+
+	return f
+}
+
+func parseServeFlags(args []string) ServeFlags {
+	f, err := loadServeFlags(args, flag.ExitOnError)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return f
+}
+
+// loadServeFlags reads the flags of the serve subcommand from the config file, the environment and
+// args, at start and again when the server reloads its configuration.
+func loadServeFlags(args []string, errorHandling flag.ErrorHandling) (ServeFlags, error) {
+	var f ServeFlags
+
+	fs := flag.NewFlagSet("serve", errorHandling)
+	fs.StringVar(&f.Addr, "addr", ":8080", "address the HTTP server listens on")
+	fs.StringVar(&f.Model, "model", modelID, "Bedrock model ID, cross-region inference profile, or provisioned throughput, custom model, application inference profile or prompt router ARN")
+	fs.StringVar(&f.BaseModel, "base-model", "", "foundation model ID behind a provisioned throughput or custom model -model ARN, looked up when not given")
+	fs.StringVar(&f.InferenceProfile, "inference-profile", "", "ARN of an application inference profile of -model, made with the profiles subcommand, the model is invoked through so its token spend is attributed to the tags of the profile")
+	fs.StringVar(&f.Fallback, "fallback", "", "comma separated Bedrock model IDs tried in order when -model is throttled, unavailable or filters the content")
+	fs.StringVar(&f.Models, "models", "", "comma separated Bedrock models a request may pick with its model field instead of -model, each with the same options")
+	fs.BoolVar(&f.Debug, "debug", false, "log the payloads sent to Bedrock")
+	fs.BoolVar(&f.Verbose, "verbose", false, "write structured logs of LLM calls and chain steps to stderr")
+	fs.DurationVar(&f.Timeout, "timeout", 0, "timeout of each Bedrock call, 0 for none")
+	fs.BoolVar(&f.Converse, "converse", false, "call the model through the Converse API, which supports every Bedrock text model, instead of InvokeModel")
+	fs.StringVar(&f.System, "system", "", "system prompt sent with every call, e.g. to answer only from the document")
+	f.AWSFlags.register(fs)
+	f.LoaderFlags.register(fs)
+	f.FetchFlags.register(fs)
+	f.TransportFlags.register(fs)
+	f.SplitterFlags.register(fs)
+	f.CacheFlags.register(fs)
+	f.GuardrailFlags.register(fs)
+	f.SamplingFlags.register(fs)
+	f.AuditFlags.register(fs)
+	f.RateLimitFlags.register(fs)
+	f.CircuitFlags.register(fs)
+	f.RouterFlags.register(fs)
+	f.AuthFlags.register(fs)
+	fs.DurationVar(&f.GracePeriod, "grace-period", 30*time.Second, "how long the requests in flight are given to finish on SIGTERM or SIGINT before they are canceled")
+	fs.StringVar(&f.AdminKey, "admin-key", os.Getenv("ADMIN_KEY"), "key of the /admin endpoints changing the model, rate limits, quotas and prompt templates while the server runs, sent as a bearer token or in X-Api-Key, none when empty")
+	err := applyConfig(fs, args)
+	if err != nil {
+		return f, err
+	}
+	err = fs.Parse(args)
+
+	return f, err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+const githubAPI = "https://api.github.com"
+
+type githubRepo struct {
+	FullName      string   `json:"full_name"`
+	Description   string   `json:"description"`
+	HTMLURL       string   `json:"html_url"`
+	Homepage      string   `json:"homepage"`
+	Language      string   `json:"language"`
+	Topics        []string `json:"topics"`
+	Stars         int      `json:"stargazers_count"`
+	DefaultBranch string   `json:"default_branch"`
+}
+
+type githubRelease struct {
+	Name        string `json:"name"`
+	TagName     string `json:"tag_name"`
+	Body        string `json:"body"`
+	HTMLURL     string `json:"html_url"`
+	PublishedAt string `json:"published_at"`
+	Draft       bool   `json:"draft"`
+}
+
+// githubContent is a file of the contents API, base64 encoded.
+type githubContent struct {
+	Type     string `json:"type"`
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	HTMLURL  string `json:"html_url"`
+}
+
+func (c githubContent) text() (string, error) {
+	if c.Type != "file" {
+		return "", fmt.Errorf("%s is a %s, not a file", c.Path, c.Type)
+	}
+	if c.Encoding != "base64" {
+		return c.Content, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(c.Content, "\n", ""))
+
+	return string(data), err
+}
+
+// githubRepoPath returns the owner/repo of a link to the front page of a GitHub repository.
+func githubRepoPath(link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || strings.TrimPrefix(u.Hostname(), "www.") != "github.com" {
+		return "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	return parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"), true
+}
+
+// githubGet decodes the response of the GitHub API to path into v, authenticated with GITHUB_TOKEN
+// when it is set, as the API allows few requests without it.
+func githubGet(ctx context.Context, path string, v any) error {
+	f := fetchFlags
+	f.Headers = append(slices.Clone(f.Headers), "Accept: application/vnd.github+json", "X-GitHub-Api-Version: 2022-11-28")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		f.BearerToken, f.AuthHosts = token, ""
+		f.FetchAuthFlags = f.scopeAuth(githubAPI)
+	}
+
+	data, err := f.fetchBytes(ctx, githubAPI+path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// getDocsFromGitHub loads a GitHub repository through the GitHub API: its latest releases first, as
+// they are what changed, then its README, then the -github-files.
+func getDocsFromGitHub(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading GitHub repository", link)
+
+	path, _ := githubRepoPath(link)
+
+	var repo githubRepo
+
+	err := githubGet(ctx, "/repos/"+path, &repo)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := func(kind, source string) map[string]any {
+		return map[string]any{"source": source, "repository": repo.FullName, "kind": kind}
+	}
+
+	var docs []schema.Document
+
+	if l.GitHubReleases > 0 {
+		var releases []githubRelease
+
+		err = githubGet(ctx, fmt.Sprintf("/repos/%s/releases?per_page=%d", path, l.GitHubReleases), &releases)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if release.Draft {
+				continue
+			}
+			name := release.Name
+			if name == "" {
+				name = release.TagName
+			}
+			doc := schema.Document{
+				PageContent: fmt.Sprintf("# %s %s\n\nReleased %s\n\n%s", repo.FullName, name, release.PublishedAt, strings.TrimSpace(release.Body)),
+				Metadata:    metadata("release", release.HTMLURL),
+			}
+			doc.Metadata["release"] = release.TagName
+			doc.Metadata["published"] = release.PublishedAt
+			docs = append(docs, doc)
+		}
+	}
+
+	about := []string{"# " + repo.FullName}
+	if repo.Description != "" {
+		about = append(about, repo.Description)
+	}
+	if repo.Language != "" {
+		about = append(about, "Language: "+repo.Language)
+	}
+	if len(repo.Topics) > 0 {
+		about = append(about, "Topics: "+strings.Join(repo.Topics, ", "))
+	}
+	if repo.Homepage != "" {
+		about = append(about, "Homepage: "+repo.Homepage)
+	}
+	about = append(about, fmt.Sprintf("Stars: %d", repo.Stars))
+
+	var readme githubContent
+
+	// A repository without a README is still described by the rest.
+	err = githubGet(ctx, "/repos/"+path+"/readme", &readme)
+	if err == nil {
+		text, err := readme.text()
+		if err != nil {
+			return nil, err
+		}
+		about = append(about, text)
+	}
+	docs = append(docs, schema.Document{PageContent: strings.Join(about, "\n\n"), Metadata: metadata("readme", repo.HTMLURL)})
+
+	for _, file := range strings.Split(l.GitHubFiles, ",") {
+		file = strings.Trim(strings.TrimSpace(file), "/")
+		if file == "" {
+			continue
+		}
+
+		var content githubContent
+
+		err = githubGet(ctx, fmt.Sprintf("/repos/%s/contents/%s?ref=%s", path, (&url.URL{Path: file}).EscapedPath(), url.QueryEscape(repo.DefaultBranch)), &content)
+		if err != nil {
+			return nil, err
+		}
+		text, err := content.text()
+		if err != nil {
+			return nil, err
+		}
+		doc := schema.Document{PageContent: fmt.Sprintf("# %s\n\n%s", content.Path, text), Metadata: metadata("file", content.HTMLURL)}
+		doc.Metadata["path"] = content.Path
+		docs = append(docs, doc)
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded", len(docs), "documents of", repo.FullName)
+
+	return docs, nil
+}
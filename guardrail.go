@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type GuardrailFlags struct {
+	GuardrailID      string
+	GuardrailVersion string
+}
+
+func (f *GuardrailFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.GuardrailID, "guardrail-id", "", "identifier of the Bedrock guardrail applied to every call")
+	fs.StringVar(&f.GuardrailVersion, "guardrail-version", "DRAFT", "version of the Bedrock guardrail")
+}
+
+type Guardrail struct {
+	ID      string
+	Version string
+}
+
+// guardrailResult is what Bedrock adds to a response body, or the last stream chunk, when a guardrail is applied.
+type guardrailResult struct {
+	Action string         `json:"amazon-bedrock-guardrailAction"`
+	Trace  map[string]any `json:"amazon-bedrock-trace"`
+}
+
+// WithGuardrail applies a Bedrock guardrail to every invocation of the Model.
+func WithGuardrail(id, version string) ModelOption {
+	if version == "" {
+		version = "DRAFT"
+	}
+
+	return func(m *Model) {
+		m.guardrail = Guardrail{ID: id, Version: version}
+	}
+}
+
+// invokeOptions sets the guardrail headers InvokeModel and InvokeModelWithResponseStream accept.
+func (g Guardrail) invokeOptions() []func(*bedrockruntime.Options) {
+	if g.ID == "" {
+		return nil
+	}
+
+	return []func(*bedrockruntime.Options){
+		func(o *bedrockruntime.Options) {
+			o.APIOptions = append(o.APIOptions,
+				smithyhttp.SetHeaderValue("X-Amzn-Bedrock-GuardrailIdentifier", g.ID),
+				smithyhttp.SetHeaderValue("X-Amzn-Bedrock-GuardrailVersion", g.Version),
+				smithyhttp.SetHeaderValue("X-Amzn-Bedrock-Trace", "ENABLED"),
+			)
+		},
+	}
+}
+
+// invokeHeaders are the values of the headers invokeOptions sets, which change the response.
+func (g Guardrail) invokeHeaders() []string {
+	if g.ID == "" {
+		return nil
+	}
+
+	return []string{g.ID, g.Version}
+}
+
+func guardrailFromBody(body []byte) (guardrailResult, bool) {
+	var result guardrailResult
+
+	err := json.Unmarshal(body, &result)
+	if err != nil {
+		return guardrailResult{}, false
+	}
+	if result.Action == "" {
+		// The Converse APIs report an intervention as the stop reason instead.
+		var event converseStreamEvent
+		_ = json.Unmarshal(body, &event)
+		if event.MessageStop == nil || event.MessageStop.StopReason != "guardrail_intervened" {
+			return guardrailResult{}, false
+		}
+		result.Action = "INTERVENED"
+	}
+
+	return result, true
+}
+
+// generationInfo exposes the guardrail intervention, including blocked topics and masked PII found in the trace.
+func (r guardrailResult) generationInfo() map[string]any {
+	if r.Action == "" {
+		return nil
+	}
+
+	info := map[string]any{"guardrail_action": r.Action}
+	if guardrail, ok := r.Trace["guardrail"]; ok {
+		info["guardrail_trace"] = guardrail
+	}
+
+	return info
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// hashtagAttempts is how many times the model is asked for missing hashtags.
+const hashtagAttempts = 2
+
+const hashtagPromptFormat = `Suggest %d hashtags for this social media post%s. Answer with the hashtags only, separated by spaces.
+
+%s`
+
+var (
+	hashtagPattern = regexp.MustCompile(`#[\p{L}\p{N}_]+`)
+	// trailingHashtags matches the block of hashtags the templates ask for at the end of the answer.
+	trailingHashtags = regexp.MustCompile(`(?:[\s,]*#[\p{L}\p{N}_]+)+[\s,.]*$`)
+)
+
+// hashtagCount is the number of hashtags the template asks for, if -prompt doesn't replace it, 0
+// for none.
+func (f PromptFlags) hashtagCount() (int, error) {
+	if f.Prompt != "" {
+		return 0, nil
+	}
+
+	name, variables, err := f.template()
+	if err != nil {
+		return 0, err
+	}
+
+	tmpl, err := readTemplate(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return tmplHashtagCount(tmpl, variables)
+}
+
+// templateHashtagCount is hashtagCount for the template loadTemplate returns.
+func templateHashtagCount(name string, variables map[string]string) (int, error) {
+	tmpl, err := loadTemplate(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return tmplHashtagCount(tmpl, variables)
+}
+
+// tmplHashtagCount is the number of hashtags tmpl asks for with the variables, 0 for none.
+func tmplHashtagCount(tmpl string, variables map[string]string) (int, error) {
+	if !strings.Contains(tmpl, "{hashtag_count}") {
+		return 0, nil
+	}
+
+	value, ok := variables["hashtag_count"]
+	if !ok {
+		value = defaultVariables["hashtag_count"]
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("hashtag_count %q is not a number", value)
+	}
+
+	return count, nil
+}
+
+// splitHashtags separates the hashtags at the end of text from the text before them.
+func splitHashtags(text string) (string, []string) {
+	loc := trailingHashtags.FindStringIndex(text)
+	if loc == nil {
+		return strings.TrimSpace(text), nil
+	}
+
+	return strings.TrimSpace(text[:loc[0]]), hashtagPattern.FindAllString(text[loc[0]:], -1)
+}
+
+// normalizeHashtags drops duplicates, compared without case, keeping the spelling with the most capitals
+// since CamelCase hashtags are easier to read and are read word by word by screen readers.
+func normalizeHashtags(tags []string) []string {
+	index := map[string]int{}
+
+	var normalized []string
+	for _, tag := range tags {
+		key := strings.ToLower(tag)
+		if i, ok := index[key]; ok {
+			if capitals(tag) > capitals(normalized[i]) {
+				normalized[i] = tag
+			}
+			continue
+		}
+		index[key] = len(normalized)
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+func capitals(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// fixHashtags rewrites the hashtags at the end of text to exactly count distinct ones,
+// asking llm for more when the answer has too few.
+func fixHashtags(ctx context.Context, llm llms.LLM, text string, count int) (string, error) {
+	body, tags := splitHashtags(text)
+	tags = normalizeHashtags(tags)
+
+	for attempt := 0; attempt < hashtagAttempts && len(tags) < count; attempt++ {
+		var exclude string
+		if len(tags) > 0 {
+			exclude = ", other than " + strings.Join(tags, " ")
+		}
+
+		answer, err := llm.Call(ctx, fmt.Sprintf(hashtagPromptFormat, count-len(tags), exclude, body), llms.WithMaxTokens(100))
+		if err != nil {
+			return "", err
+		}
+
+		tags = normalizeHashtags(append(tags, hashtagPattern.FindAllString(answer, -1)...))
+	}
+
+	if len(tags) > count {
+		tags = tags[:count]
+	}
+	if len(tags) == 0 {
+		return body, nil
+	}
+
+	return body + "\n\n" + strings.Join(tags, " "), nil
+}
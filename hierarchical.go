@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const condenseTemplate = `Summarize this part of a longer document. Keep its facts, names, figures, arguments and conclusions, in the order they come, so the summary can stand in for it when the whole document is summarized. Reply only with the summary.
+
+Part:
+
+%s`
+
+// condense replaces docs too long for budget with summaries of their chunks, then with summaries of
+// those summaries, until they fit. The progress is reported to the callbacks handler of large.
+func condense(ctx context.Context, large *Model, docs []schema.Document, budget, maxTokens int, temperature float64) ([]schema.Document, error) {
+	tokens := countTokens(large, docs)
+	for level := 1; tokens > budget; level++ {
+		chunks := packDocuments(large, docs, large.DocumentBudget(maxTokens))
+
+		summaries, err := condenseChunks(ctx, large, chunks, fmt.Sprintf("hierarchical summary level %d", level), maxTokens, temperature)
+		if err != nil {
+			return nil, err
+		}
+
+		condensed := countTokens(large, summaries)
+		if condensed >= tokens {
+			return nil, fmt.Errorf("level %d of the hierarchical summary is no shorter than the %d tokens it summarizes", level, tokens)
+		}
+		docs, tokens = summaries, condensed
+	}
+
+	return docs, nil
+}
+
+// condenseChunks summarizes each chunk, -workers at a time, keeping their order. The progress is
+// reported as that of stage.
+func condenseChunks(ctx context.Context, large *Model, chunks []string, stage string, maxTokens int, temperature float64) ([]schema.Document, error) {
+	summaries := make([]schema.Document, len(chunks))
+	errs := make([]error, len(chunks))
+	jobs := make(chan int)
+
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(large.Concurrency, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summary, err := large.Call(ctx, fmt.Sprintf(condenseTemplate, chunks[i]), llms.WithMaxTokens(maxTokens), llms.WithTemperature(temperature))
+				if err != nil {
+					errs[i] = fmt.Errorf("%s, chunk %d: %w", stage, i+1, err)
+					continue
+				}
+				summaries[i] = schema.Document{PageContent: strings.TrimSpace(summary)}
+
+				mu.Lock()
+				done++
+				reportProgress(ctx, large, fmt.Sprintf("%s: %d of %d chunks summarized", stage, done, len(chunks)))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range chunks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return summaries, nil
+}
+
+// packDocuments joins docs in order into chunks of at most budget tokens, splitting the documents
+// longer than that between words.
+func packDocuments(llm llms.LanguageModel, docs []schema.Document, budget int) []string {
+	var chunks []string
+	chunk := ""
+	for _, doc := range docs {
+		text := strings.TrimSpace(doc.PageContent)
+		if text == "" {
+			continue
+		}
+		if chunk != "" && llm.GetNumTokens(chunk+"\n\n"+text) > budget {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += "\n\n" + text
+			continue
+		}
+
+		for tokens := llm.GetNumTokens(text); tokens > budget; tokens = llm.GetNumTokens(text) {
+			words := strings.Fields(text)
+			cut := max(len(words)*budget/tokens, 1)
+			chunks = append(chunks, strings.Join(words[:cut], " "))
+			text = strings.Join(words[cut:], " ")
+		}
+		chunk = text
+	}
+	if chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+func countTokens(llm llms.LanguageModel, docs []schema.Document) int {
+	tokens := 0
+	for _, doc := range docs {
+		tokens += llm.GetNumTokens(doc.PageContent)
+	}
+
+	return tokens
+}
+
+// reportProgress sends text to the callbacks handler of large, or writes it to stderr when it has none.
+func reportProgress(ctx context.Context, large *Model, text string) {
+	if large.CallbacksHandler != nil {
+		large.CallbacksHandler.HandleText(ctx, text)
+		return
+	}
+	fmt.Fprintln(os.Stderr, text)
+}
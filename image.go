@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+type Image struct {
+	MediaType string
+	Data      []byte
+}
+
+// ImageCodec is implemented by the codecs of multimodal models, which accept images next to the prompt.
+type ImageCodec interface {
+	EncodeImageRequest(system, prompt string, images []Image, opts *llms.CallOptions) ([]byte, error)
+}
+
+// imagesKey carries the images of a call through the chain down to the Model.
+type imagesKey struct{}
+
+// withImages makes every model call made with ctx send images along with the prompt.
+func withImages(ctx context.Context, images []Image) context.Context {
+	if len(images) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, imagesKey{}, images)
+}
+
+func imagesFrom(ctx context.Context) []Image {
+	images, _ := ctx.Value(imagesKey{}).([]Image)
+	return images
+}
+
+// ImageSources collects repeated -image flags.
+type ImageSources []string
+
+func (s *ImageSources) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *ImageSources) Set(source string) error {
+	*s = append(*s, source)
+	return nil
+}
+
+// loadImage reads a PNG, JPEG, GIF or WebP image from a link or a file.
+func loadImage(source string) (Image, error) {
+	var data []byte
+	var err error
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetchBytes(context.Background(), source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+	default:
+		return Image{}, fmt.Errorf("%s: unsupported image type %s", source, mediaType)
+	}
+
+	return Image{MediaType: mediaType, Data: data}, nil
+}
+
+func loadImages(sources []string) ([]Image, error) {
+	images := make([]Image, 0, len(sources))
+	for _, source := range sources {
+		image, err := loadImage(source)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// format is the image format name used by the Converse and Nova payloads.
+func (i Image) format() string {
+	return strings.TrimPrefix(i.MediaType, "image/")
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/tmc/langchaingo/schema"
+)
+
+var (
+	// replyHeader matches the line introducing a quoted reply, such as "On Mon, 1 Jan 2024, Ann
+	// <ann@example.com> wrote:", and the separators of forwarded and Outlook replies.
+	replyHeader = regexp.MustCompile(`(?m)^(On .{1,200}wrote:|-{2,} ?(Original|Forwarded) [Mm]essage ?-{2,}|From: .+\n(Sent|Date): )`)
+	// subjectPrefix matches the reply and forward prefixes of a subject.
+	subjectPrefix = regexp.MustCompile(`(?i)^((re|fwd?|aw|wg|tr)(\[\d+\])?:\s*)+`)
+)
+
+// dialIMAP connects to the IMAP server of u, over TLS for imaps links. The connection is closed
+// when ctx is done.
+func dialIMAP(ctx context.Context, u *url.URL) (*imapclient.Client, error) {
+	host := u.Host
+	if u.Port() == "" {
+		port := "993"
+		if u.Scheme == "imap" {
+			port = "143"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "imaps" {
+		config := &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		if transportFlags.CABundle != "" {
+			config.RootCAs, err = transportFlags.rootCAs()
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		conn = tls.Client(conn, config)
+	}
+
+	c := imapclient.New(conn, nil)
+	context.AfterFunc(ctx, func() { c.Close() })
+
+	err = c.WaitGreeting()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// imapLogin returns the user and password of an IMAP link: those of the link, else IMAP_PASSWORD,
+// else the netrc login of the host.
+func imapLogin(u *url.URL) (string, string, error) {
+	user := u.User.Username()
+	if password, ok := u.User.Password(); ok {
+		return user, password, nil
+	}
+	if password := os.Getenv("IMAP_PASSWORD"); password != "" {
+		return user, password, nil
+	}
+
+	login, err := fetchFlags.netrcLogin(u.Hostname())
+	if err != nil {
+		return "", "", err
+	}
+	if user == "" {
+		user = login.Login
+	}
+	if user == "" || login.Password == "" {
+		return "", "", fmt.Errorf("no IMAP login for %s: set IMAP_PASSWORD or add it to the netrc file", u.Hostname())
+	}
+
+	return user, login.Password, nil
+}
+
+// imapSearch is the search of the messages loaded: -imap-search, or those of the last day.
+func imapSearch(l LoaderFlags) (*imap.SearchCriteria, error) {
+	if l.IMAPSearch == "" {
+		return &imap.SearchCriteria{Since: time.Now().AddDate(0, 0, -1)}, nil
+	}
+
+	return parseIMAPSearch(l.IMAPSearch)
+}
+
+// imapFlagKeys are the search keys of the messages with, or without, a flag.
+var imapFlagKeys = map[string]struct {
+	flag imap.Flag
+	not  bool
+}{
+	"ANSWERED": {imap.FlagAnswered, false}, "UNANSWERED": {imap.FlagAnswered, true},
+	"DELETED": {imap.FlagDeleted, false}, "UNDELETED": {imap.FlagDeleted, true},
+	"DRAFT": {imap.FlagDraft, false}, "UNDRAFT": {imap.FlagDraft, true},
+	"FLAGGED": {imap.FlagFlagged, false}, "UNFLAGGED": {imap.FlagFlagged, true},
+	"SEEN": {imap.FlagSeen, false}, "UNSEEN": {imap.FlagSeen, true},
+}
+
+// imapHeaderKeys are the search keys of the messages whose header field holds a string.
+var imapHeaderKeys = map[string]string{"BCC": "Bcc", "CC": "Cc", "FROM": "From", "SUBJECT": "Subject", "TO": "To"}
+
+// parseIMAPSearch parses the search keys of an IMAP SEARCH command, such as UNSEEN FROM
+// "news@example.com", all of which the messages match.
+func parseIMAPSearch(s string) (*imap.SearchCriteria, error) {
+	tokens, err := imapSearchTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var criteria imap.SearchCriteria
+	for len(tokens) > 0 {
+		var key imap.SearchCriteria
+		key, tokens, err = parseIMAPSearchKey(tokens)
+		if err != nil {
+			return nil, fmt.Errorf("IMAP search %q: %w", s, err)
+		}
+		criteria.And(&key)
+	}
+
+	return &criteria, nil
+}
+
+// imapSearchTokens splits an IMAP search into its keys and arguments, unquoting the quoted strings.
+func imapSearchTokens(s string) ([]string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return nil, fmt.Errorf("IMAP search %q holds a line break or a NUL", s)
+	}
+
+	var tokens []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] != '"' {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+			continue
+		}
+
+		var b strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return nil, fmt.Errorf("IMAP search %q has an unterminated string", s)
+		}
+		tokens = append(tokens, b.String())
+		s = s[i+1:]
+	}
+
+	return tokens, nil
+}
+
+// parseIMAPSearchKey parses the search key tokens start with, and returns the tokens after it.
+func parseIMAPSearchKey(tokens []string) (imap.SearchCriteria, []string, error) {
+	var criteria imap.SearchCriteria
+
+	name := strings.ToUpper(tokens[0])
+	args := tokens[1:]
+	arg := func() (string, error) {
+		if len(args) == 0 {
+			return "", fmt.Errorf("%s without a value", name)
+		}
+		value := args[0]
+		args = args[1:]
+		return value, nil
+	}
+
+	if key, ok := imapFlagKeys[name]; ok {
+		if key.not {
+			criteria.NotFlag = []imap.Flag{key.flag}
+		} else {
+			criteria.Flag = []imap.Flag{key.flag}
+		}
+		return criteria, args, nil
+	}
+	if field, ok := imapHeaderKeys[name]; ok {
+		value, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		criteria.Header = []imap.SearchCriteriaHeaderField{{Key: field, Value: value}}
+		return criteria, args, nil
+	}
+
+	switch name {
+	case "ALL":
+	case "SINCE", "BEFORE", "ON", "SENTSINCE", "SENTBEFORE", "SENTON":
+		value, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		date, err := time.Parse("2-Jan-2006", value)
+		if err != nil {
+			return criteria, nil, fmt.Errorf("%s %s is not a date such as 1-Feb-2024", name, value)
+		}
+		switch name {
+		case "SINCE":
+			criteria.Since = date
+		case "BEFORE":
+			criteria.Before = date
+		case "ON":
+			criteria.Since, criteria.Before = date, date.AddDate(0, 0, 1)
+		case "SENTSINCE":
+			criteria.SentSince = date
+		case "SENTBEFORE":
+			criteria.SentBefore = date
+		case "SENTON":
+			criteria.SentSince, criteria.SentBefore = date, date.AddDate(0, 0, 1)
+		}
+	case "BODY", "TEXT", "KEYWORD", "UNKEYWORD":
+		value, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		switch name {
+		case "BODY":
+			criteria.Body = []string{value}
+		case "TEXT":
+			criteria.Text = []string{value}
+		case "KEYWORD":
+			criteria.Flag = []imap.Flag{imap.Flag(value)}
+		case "UNKEYWORD":
+			criteria.NotFlag = []imap.Flag{imap.Flag(value)}
+		}
+	case "HEADER":
+		field, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		value, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		criteria.Header = []imap.SearchCriteriaHeaderField{{Key: field, Value: value}}
+	case "LARGER", "SMALLER":
+		value, err := arg()
+		if err != nil {
+			return criteria, nil, err
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return criteria, nil, fmt.Errorf("%s %s is not a size in bytes", name, value)
+		}
+		if name == "LARGER" {
+			criteria.Larger = size
+		} else {
+			criteria.Smaller = size
+		}
+	case "NOT":
+		if len(args) == 0 {
+			return criteria, nil, fmt.Errorf("NOT without a search key")
+		}
+		not, rest, err := parseIMAPSearchKey(args)
+		if err != nil {
+			return criteria, nil, err
+		}
+		criteria.Not = []imap.SearchCriteria{not}
+		args = rest
+	case "OR":
+		var or [2]imap.SearchCriteria
+		for i := range or {
+			if len(args) == 0 {
+				return criteria, nil, fmt.Errorf("OR without two search keys")
+			}
+			key, rest, err := parseIMAPSearchKey(args)
+			if err != nil {
+				return criteria, nil, err
+			}
+			or[i], args = key, rest
+		}
+		criteria.Or = [][2]imap.SearchCriteria{or}
+	default:
+		return criteria, nil, fmt.Errorf("unknown search key %s", tokens[0])
+	}
+
+	return criteria, args, nil
+}
+
+// EmailMessage is a message with its quoted replies and signature stripped.
+type EmailMessage struct {
+	ID         string
+	References []string
+	Subject    string
+	From       string
+	Date       time.Time
+	Body       string
+}
+
+// getDocsFromIMAP loads the messages of an imaps://user@host/mailbox link matching -imap-search,
+// the most recent -imap-limit of them, as one document per thread. The mailbox is opened read
+// only, so the messages are not marked as read.
+func getDocsFromIMAP(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	mailbox := strings.TrimPrefix(u.Path, "/")
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	source := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + mailbox}).String()
+
+	fmt.Fprintln(os.Stderr, "loading messages from", source)
+
+	user, password, err := imapLogin(u)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	search, err := imapSearch(l)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dialIMAP(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	err = c.Login(user, password).Wait()
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := c.UIDSearch(search, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	uids := found.AllUIDs()
+	if l.IMAPLimit > 0 && len(uids) > l.IMAPLimit {
+		uids = uids[len(uids)-l.IMAPLimit:]
+	}
+	if len(uids) == 0 {
+		return nil, fmt.Errorf("no messages in %s match the search", source)
+	}
+
+	body := &imap.FetchItemBodySection{Peek: true}
+	fetched, err := c.Fetch(imap.UIDSetNum(uids...), &imap.FetchOptions{BodySection: []*imap.FetchItemBodySection{body}}).Collect()
+	if err != nil {
+		return nil, err
+	}
+	_ = c.Logout().Wait()
+
+	var messages []EmailMessage
+	for _, msg := range fetched {
+		raw := msg.FindBodySection(body)
+		if raw == nil {
+			continue
+		}
+		message, err := parseEmail(raw)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "skipping a message:", err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	docs := emailThreads(messages, source)
+
+	fmt.Fprintln(os.Stderr, "successfully loaded", len(messages), "messages in", len(docs), "threads from", source)
+
+	return docs, nil
+}
+
+func parseEmail(raw []byte) (EmailMessage, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		return EmailMessage{}, err
+	}
+
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	from, err := decoder.DecodeHeader(msg.Header.Get("From"))
+	if err != nil {
+		from = msg.Header.Get("From")
+	}
+	date, _ := msg.Header.Date()
+
+	body, err := emailText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return EmailMessage{}, err
+	}
+
+	return EmailMessage{
+		ID:         msg.Header.Get("Message-Id"),
+		References: strings.Fields(msg.Header.Get("References") + " " + msg.Header.Get("In-Reply-To")),
+		Subject:    strings.TrimSpace(subject),
+		From:       from,
+		Date:       date,
+		Body:       stripReply(body),
+	}, nil
+}
+
+// emailText returns the text of a message body, its plain text part when it has one, else the text
+// of its HTML part.
+func emailText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineSkipper{r: body})
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var html string
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := emailText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "text/html" {
+				html = text
+				continue
+			}
+			if text != "" {
+				return text, nil
+			}
+		}
+		return html, nil
+	}
+
+	switch mediaType {
+	case "text/plain":
+		data, err := io.ReadAll(body)
+		return string(data), err
+	case "text/html":
+		return extractArticle(body)
+	}
+
+	// Attachments are not loaded.
+	return "", nil
+}
+
+// newlineSkipper drops the line breaks of a base64 body, which the decoder doesn't accept.
+type newlineSkipper struct {
+	r io.Reader
+}
+
+func (s *newlineSkipper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+
+	return kept, err
+}
+
+// stripReply drops the quoted reply and the signature of a message body.
+func stripReply(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if loc := replyHeader.FindStringIndex(body); loc != nil {
+		body = body[:loc[0]]
+	}
+	if i := strings.Index(body, "\n-- \n"); i >= 0 {
+		body = body[:i]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// emailThreads groups messages into one document per thread, by the first message they reference
+// or else their subject, oldest message first.
+func emailThreads(messages []EmailMessage, source string) []schema.Document {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Date.Before(messages[j].Date)
+	})
+
+	threads := map[string][]EmailMessage{}
+	var order []string
+	// keys are the thread of each message ID and subject seen.
+	keys := map[string]string{}
+	for _, message := range messages {
+		subject := strings.ToLower(subjectPrefix.ReplaceAllString(message.Subject, ""))
+
+		key := ""
+		for _, id := range append(message.References, message.ID) {
+			if key = keys[id]; key != "" {
+				break
+			}
+		}
+		if key == "" {
+			key = keys["subject:"+subject]
+		}
+		if key == "" {
+			key = message.ID
+			if key == "" {
+				key = "subject:" + subject
+			}
+			order = append(order, key)
+		}
+		for _, id := range append(message.References, message.ID, "subject:"+subject) {
+			if id != "" && keys[id] == "" {
+				keys[id] = key
+			}
+		}
+		threads[key] = append(threads[key], message)
+	}
+
+	docs := make([]schema.Document, 0, len(order))
+	for _, key := range order {
+		thread := threads[key]
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "# %s\n", thread[0].Subject)
+		participants := map[string]bool{}
+		for _, message := range thread {
+			fmt.Fprintf(&b, "\nFrom %s, %s:\n\n%s\n", message.From, message.Date.Format(time.RFC1123), message.Body)
+			participants[message.From] = true
+		}
+
+		docs = append(docs, schema.Document{
+			PageContent: b.String(),
+			Metadata: map[string]any{
+				"source":       source,
+				"subject":      thread[0].Subject,
+				"messages":     len(thread),
+				"participants": len(participants),
+				"date":         thread[len(thread)-1].Date.Format(time.RFC3339),
+			},
+		})
+	}
+
+	return docs
+}
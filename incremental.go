@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// SummaryState is what an -incremental run remembers of a source: the hash of its content, and
+// the summaries of its chunks by the hash of each chunk.
+type SummaryState struct {
+	Source  string            `json:"source"`
+	Model   string            `json:"model"`
+	Hash    string            `json:"hash"`
+	Chunks  map[string]string `json:"chunks"`
+	Updated time.Time         `json:"updated"`
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// statePath is where the SummaryState of source summarized by modelID is kept under dir.
+func statePath(dir, source, modelID string) string {
+	return filepath.Join(dir, "incremental", cacheKey(modelID, []byte(source))+".json")
+}
+
+func loadSummaryState(path string) (SummaryState, error) {
+	var state SummaryState
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(data, &state)
+
+	return state, err
+}
+
+func saveSummaryState(path string, state SummaryState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// summarizeChanged replaces each chunk of source with its summary, reusing the summaries of the
+// chunks that haven't changed since the last run stored in dir, and summarizing only the others.
+// The summaries are then summarized together as any documents.
+func summarizeChanged(ctx context.Context, large *Model, dir, source string, docs []schema.Document, maxTokens int, temperature float64) ([]schema.Document, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("-incremental keeps the chunk summaries in -cache-dir, which is empty")
+	}
+
+	path := statePath(dir, source, large.modelID)
+	state, err := loadSummaryState(path)
+	if err != nil {
+		return nil, fmt.Errorf("summary state of %s: %w", source, err)
+	}
+
+	hashes := make([]string, len(docs))
+	all := sha256.New()
+	for i, doc := range docs {
+		hashes[i] = contentHash(doc.PageContent)
+		all.Write([]byte(hashes[i]))
+	}
+	hash := hex.EncodeToString(all.Sum(nil))
+
+	var changed []string
+	var changedAt []int
+	for i, doc := range docs {
+		if _, ok := state.Chunks[hashes[i]]; !ok {
+			changed = append(changed, doc.PageContent)
+			changedAt = append(changedAt, i)
+		}
+	}
+	if hash == state.Hash {
+		reportProgress(ctx, large, fmt.Sprintf("%s is unchanged since %s", source, state.Updated.Format(time.RFC3339)))
+	} else {
+		reportProgress(ctx, large, fmt.Sprintf("%d of %d chunks of %s changed, summarizing them", len(changed), len(docs), source))
+	}
+
+	summaries, err := condenseChunks(ctx, large, changed, "incremental summary of "+source, maxTokens, temperature)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the summaries of the current chunks are kept, so the state doesn't grow with every change.
+	chunks := make(map[string]string, len(docs))
+	for i, summary := range summaries {
+		chunks[hashes[changedAt[i]]] = summary.PageContent
+	}
+	condensed := make([]schema.Document, len(docs))
+	for i, doc := range docs {
+		summary, ok := chunks[hashes[i]]
+		if !ok {
+			summary = state.Chunks[hashes[i]]
+			chunks[hashes[i]] = summary
+		}
+		condensed[i] = schema.Document{PageContent: summary, Metadata: doc.Metadata}
+	}
+
+	if hash != state.Hash {
+		err = saveSummaryState(path, SummaryState{Source: source, Model: large.modelID, Hash: hash, Chunks: chunks, Updated: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return condensed, nil
+}
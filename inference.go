@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// profileGeographies are the prefixes of the cross-region inference profiles, such as
+// us.anthropic.claude-3-haiku-20240307-v1:0, by the region prefix they serve.
+var profileGeographies = []struct {
+	regionPrefix string
+	profile      string
+}{
+	{"us-gov-", "us-gov"},
+	{"us-", "us"},
+	{"eu-", "eu"},
+	{"ap-", "apac"},
+}
+
+// baseModelID returns the foundation model an inference profile, or a foundation or custom model
+// ARN, calls, so the codec, context window and price of the model can be found.
+func baseModelID(modelID string) string {
+	if strings.HasPrefix(modelID, "arn:") {
+		// The resource is inference-profile/<id>, foundation-model/<id> or custom-model/<base id>/<name>.
+		_, resource, ok := strings.Cut(modelID, "/")
+		if !ok {
+			return modelID
+		}
+		modelID, _, _ = strings.Cut(resource, "/")
+	}
+
+	for _, geo := range profileGeographies {
+		if id, ok := strings.CutPrefix(modelID, geo.profile+"."); ok {
+			return id
+		}
+	}
+
+	return modelID
+}
+
+// inferenceProfileID returns the cross-region inference profile of modelID for the geography of region.
+func inferenceProfileID(modelID, region string) (string, bool) {
+	if baseModelID(modelID) != modelID {
+		return "", false
+	}
+
+	for _, geo := range profileGeographies {
+		if strings.HasPrefix(region, geo.regionPrefix) {
+			return geo.profile + "." + modelID, true
+		}
+	}
+
+	return "", false
+}
+
+// regionRoute is a client and the model ID to send it.
+type regionRoute struct {
+	region  string
+	client  BedrockInvoker
+	profile bool
+}
+
+// regionFailover is a BedrockInvoker that, when a model is not enabled in the configured region,
+// calls its cross-region inference profile instead, then the model in each of the -failover-regions.
+// The first route that works is kept for the next calls of the model.
+type regionFailover struct {
+	cfg       aws.Config
+	newClient func(aws.Config) BedrockInvoker
+	routes    []regionRoute
+
+	mu      sync.Mutex
+	chosen  map[string]int
+	clients map[string]BedrockInvoker
+}
+
+// newRegionFailover creates the clients of the configured region and of the other regions with newClient.
+func newRegionFailover(newClient func(aws.Config) BedrockInvoker) BedrockInvoker {
+	cfg := loadAWSConfig()
+	primary := newClient(cfg)
+
+	r := &regionFailover{
+		cfg:       cfg,
+		newClient: newClient,
+		routes:    []regionRoute{{region: cfg.Region, client: primary}, {region: cfg.Region, client: primary, profile: true}},
+		chosen:    map[string]int{},
+		clients:   map[string]BedrockInvoker{cfg.Region: primary},
+	}
+	for _, region := range strings.Split(awsFlags.FailoverRegions, ",") {
+		if region = strings.TrimSpace(region); region != "" && region != cfg.Region {
+			r.routes = append(r.routes, regionRoute{region: region, client: r.clientIn(region)})
+		}
+	}
+
+	return r
+}
+
+// modelNotEnabled reports whether err says the model cannot be called in the region.
+func modelNotEnabled(modelID string, err error) bool {
+	err = bedrockError(modelID, err)
+	return errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrModelNotFound)
+}
+
+// clientIn returns the client of region, creating it on first use.
+func (r *regionFailover) clientIn(region string) BedrockInvoker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, ok := r.clients[region]
+	if !ok {
+		cfg := r.cfg.Copy()
+		cfg.Region = region
+		client = r.newClient(cfg)
+		r.clients[region] = client
+	}
+
+	return client
+}
+
+// call tries fn on the routes of modelID, starting from the one that worked last.
+func (r *regionFailover) call(modelID string, fn func(client BedrockInvoker, modelID string) error) error {
+	// An ARN is bound to the region of its capacity, which is the only one it can be invoked in.
+	if region := arnRegion(modelID); region != "" {
+		return fn(r.clientIn(region), modelID)
+	}
+
+	r.mu.Lock()
+	start := r.chosen[modelID]
+	r.mu.Unlock()
+
+	var err error
+	for i := start; i < len(r.routes); i++ {
+		route := r.routes[i]
+
+		id := modelID
+		if route.profile {
+			profile, ok := inferenceProfileID(modelID, route.region)
+			if !ok {
+				continue
+			}
+			id = profile
+		}
+
+		if i != start {
+			log.Printf("%s is not enabled in %s, calling %s in %s", modelID, r.routes[start].region, id, route.region)
+		}
+
+		err = fn(route.client, id)
+		if err == nil || !modelNotEnabled(id, err) {
+			if err == nil && i != start {
+				r.mu.Lock()
+				r.chosen[modelID] = i
+				r.mu.Unlock()
+			}
+			return err
+		}
+	}
+
+	return err
+}
+
+func (r *regionFailover) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	var out *bedrockruntime.InvokeModelOutput
+
+	err := r.call(aws.ToString(params.ModelId), func(client BedrockInvoker, modelID string) error {
+		input := *params
+		input.ModelId = aws.String(modelID)
+
+		var err error
+		out, err = client.InvokeModel(ctx, &input, optFns...)
+		return err
+	})
+
+	return out, err
+}
+
+func (r *regionFailover) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (ResponseEventStream, error) {
+	var stream ResponseEventStream
+
+	err := r.call(aws.ToString(params.ModelId), func(client BedrockInvoker, modelID string) error {
+		input := *params
+		input.ModelId = aws.String(modelID)
+
+		var err error
+		stream, err = client.InvokeModelWithResponseStream(ctx, &input, optFns...)
+		return err
+	})
+
+	return stream, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// ResponseEventStream is the part of *bedrockruntime.InvokeModelWithResponseStreamEventStream the Model reads from.
+type ResponseEventStream interface {
+	Events() <-chan types.ResponseStream
+	Close() error
+	Err() error
+}
+
+// BedrockInvoker is the part of the Bedrock runtime API the Model depends on, so it can be replaced in tests.
+type BedrockInvoker interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+	InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (ResponseEventStream, error)
+}
+
+type runtimeClient struct {
+	*bedrockruntime.Client
+}
+
+func (c runtimeClient) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (ResponseEventStream, error) {
+	out, err := c.Client.InvokeModelWithResponseStream(ctx, params, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.GetStream(), nil
+}
+
+type ModelOption func(*Model)
+
+// WithSystemPrompt sends system as the system prompt of every call, in the way the model's payload supports it.
+func WithSystemPrompt(system string) ModelOption {
+	return func(m *Model) {
+		m.system = system
+	}
+}
+
+// WithStopSequences adds stop sequences to those of every call, for instance to end at a chain's next turn.
+func WithStopSequences(stop ...string) ModelOption {
+	return func(m *Model) {
+		m.stopWords = append(m.stopWords, stop...)
+	}
+}
+
+func (m *Model) withStopWords(stop []string) []string {
+	merged := append([]string(nil), stop...)
+	for _, word := range m.stopWords {
+		if !slices.Contains(merged, word) {
+			merged = append(merged, word)
+		}
+	}
+
+	return merged
+}
+
+// WithInvoker makes the Model call invoker instead of a Bedrock client built from the AWS configuration.
+func WithInvoker(invoker BedrockInvoker) ModelOption {
+	return func(m *Model) {
+		m.bedrock = invoker
+	}
+}
+
+// Middleware wraps the invoker of a Model with custom logic run around every Bedrock call, such as
+// rewriting payloads, adding headers with the option functions, logging or encryption. It usually
+// returns a struct embedding next that overrides InvokeModel, InvokeModelWithResponseStream or both.
+type Middleware func(next BedrockInvoker) BedrockInvoker
+
+// WithMiddleware wraps the invoker of the Model, and of its fallbacks, with middleware. The first
+// middleware is the outermost, it sees the calls first and their results last.
+func WithMiddleware(middleware ...Middleware) ModelOption {
+	return func(m *Model) {
+		m.middleware = append(m.middleware, middleware...)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// tracingInvoker records name in trace around the InvokeModel calls of the BedrockInvoker it embeds.
+type tracingInvoker struct {
+	BedrockInvoker
+	name  string
+	trace *[]string
+}
+
+func (t tracingInvoker) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	*t.trace = append(*t.trace, t.name+" before")
+	out, err := t.BedrockInvoker.InvokeModel(ctx, params, optFns...)
+	*t.trace = append(*t.trace, t.name+" after")
+
+	return out, err
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+	tracing := func(name string) Middleware {
+		return func(next BedrockInvoker) BedrockInvoker {
+			return tracingInvoker{BedrockInvoker: next, name: name, trace: &trace}
+		}
+	}
+
+	fake := &FakeInvoker{Body: []byte(`{"completion":"A summary.","stop_reason":"stop_sequence"}`)}
+	m, err := buildLargeLanguageModel("anthropic.claude-v2:1", WithInvoker(fake), WithMiddleware(tracing("outer"), tracing("inner")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Call(context.Background(), "Summarize the text.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.LastRequest(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "outer before, inner before, inner after, outer after"
+	if got := strings.Join(trace, ", "); got != want {
+		t.Errorf("got calls %s, want %s", got, want)
+	}
+}
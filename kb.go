@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockagentruntime/types"
+)
+
+// knowledgeBaseModelArn returns the ARN RetrieveAndGenerate takes for the model generating the answer.
+func knowledgeBaseModelArn(modelID, region string) string {
+	if strings.HasPrefix(modelID, "arn:") {
+		return modelID
+	}
+
+	return fmt.Sprintf("arn:aws:bedrock:%s::foundation-model/%s", region, baseModelID(modelID))
+}
+
+// askKnowledgeBase answers question with RetrieveAndGenerate, which retrieves the chunks from the
+// knowledge base and generates the answer in Bedrock. The answer cites the chunks as -mode qa does.
+func askKnowledgeBase(ctx context.Context, knowledgeBaseID, modelID, question string, results int) (Answer, error) {
+	cfg := loadAWSConfig()
+
+	out, err := bedrockagentruntime.NewFromConfig(cfg).RetrieveAndGenerate(ctx, &bedrockagentruntime.RetrieveAndGenerateInput{
+		Input: &types.RetrieveAndGenerateInput{Text: aws.String(question)},
+		RetrieveAndGenerateConfiguration: &types.RetrieveAndGenerateConfiguration{
+			Type: types.RetrieveAndGenerateTypeKnowledgeBase,
+			KnowledgeBaseConfiguration: &types.KnowledgeBaseRetrieveAndGenerateConfiguration{
+				KnowledgeBaseId: aws.String(knowledgeBaseID),
+				ModelArn:        aws.String(knowledgeBaseModelArn(modelID, cfg.Region)),
+				RetrievalConfiguration: &types.KnowledgeBaseRetrievalConfiguration{
+					VectorSearchConfiguration: &types.KnowledgeBaseVectorSearchConfiguration{NumberOfResults: aws.Int32(int32(results))},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return Answer{}, bedrockError(modelID, err)
+	}
+
+	return knowledgeBaseAnswer(question, out), nil
+}
+
+// referenceText returns the text of a chunk a knowledge base retrieved.
+func referenceText(content *types.RetrievalResultContent) string {
+	if content == nil {
+		return ""
+	}
+
+	return aws.ToString(content.Text)
+}
+
+// referenceSource returns the URI of the S3 object, or the URL of the web page, a chunk a
+// knowledge base retrieved is from.
+func referenceSource(location *types.RetrievalResultLocation) string {
+	switch {
+	case location == nil:
+		return ""
+	case location.S3Location != nil:
+		return aws.ToString(location.S3Location.Uri)
+	case location.WebLocation != nil:
+		return aws.ToString(location.WebLocation.Url)
+	}
+
+	return ""
+}
+
+// knowledgeBaseAnswer numbers the references of a RetrieveAndGenerate response in the order they
+// are cited, and inserts their numbers at the end of the part of the answer they support.
+func knowledgeBaseAnswer(question string, out *bedrockagentruntime.RetrieveAndGenerateOutput) Answer {
+	text := ""
+	if out.Output != nil {
+		text = aws.ToString(out.Output.Text)
+	}
+	answer := Answer{Question: question, Citations: []Citation{}}
+	numbers := map[string]int{}
+	offset := 0
+	for _, citation := range out.Citations {
+		var marks strings.Builder
+		for _, ref := range citation.RetrievedReferences {
+			source, content := referenceSource(ref.Location), referenceText(ref.Content)
+
+			key := source + "\x00" + content
+			n, ok := numbers[key]
+			if !ok {
+				n = len(numbers) + 1
+				numbers[key] = n
+				answer.Citations = append(answer.Citations, Citation{Number: n, Source: source, Excerpt: excerpt(content)})
+			}
+			fmt.Fprintf(&marks, " [%d]", n)
+		}
+
+		// The span ends, in characters of the original answer, are moved by the marks inserted before.
+		runes := []rune(text)
+		end := min(citationEnd(citation)+1+offset, len(runes))
+		text = string(runes[:end]) + marks.String() + string(runes[end:])
+		offset += len([]rune(marks.String()))
+	}
+
+	answer.Text = strings.TrimSpace(text)
+	answer.Known = len(answer.Citations) > 0
+
+	return answer
+}
+
+// citationEnd returns where the part of the answer a citation supports ends, in characters.
+func citationEnd(citation types.Citation) int {
+	part := citation.GeneratedResponsePart
+	if part == nil || part.TextResponsePart == nil || part.TextResponsePart.Span == nil {
+		return 0
+	}
+
+	return int(aws.ToInt32(part.TextResponsePart.Span.End))
+}
+
+// runKnowledgeBase answers -question from the -knowledge-base, as text or, with -json, as an Answer.
+func runKnowledgeBase(ctx context.Context, f Flags) {
+	if f.KnowledgeBase == "" || f.Question == "" {
+		log.Fatal("-mode kb needs a -knowledge-base and a -question")
+	}
+
+	answer, err := askKnowledgeBase(ctx, f.KnowledgeBase, f.Model, f.Question, f.TopChunks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(answer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Println(answer.Text)
+	printCitations(answer.Citations)
+}
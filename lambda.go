@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+const lambdaAPIVersion = "2018-06-01"
+
+// lambdaEvent accepts a SummarizeRequest as is, as the body of an API Gateway proxy event or as the detail of an EventBridge event.
+type lambdaEvent struct {
+	SummarizeRequest
+	Body            *string           `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	Detail          *SummarizeRequest `json:"detail"`
+}
+
+type apiGatewayResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// newLambdaServer builds the server of the Lambda function from the environment of the function,
+// the serve flags not being given there.
+func newLambdaServer() (*server, error) {
+	awsFlags.FailoverRegions = os.Getenv("BEDROCK_FAILOVER_REGIONS")
+
+	model := os.Getenv("BEDROCK_MODEL_ID")
+	if model == "" {
+		model = modelID
+	}
+
+	options := []ModelOption{
+		WithGuardrail(os.Getenv("BEDROCK_GUARDRAIL_ID"), os.Getenv("BEDROCK_GUARDRAIL_VERSION")),
+		WithSystemPrompt(os.Getenv("BEDROCK_SYSTEM_PROMPT")),
+		WithBaseModel(os.Getenv("BEDROCK_BASE_MODEL_ID")),
+		WithInferenceProfile(os.Getenv("BEDROCK_INFERENCE_PROFILE_ARN")),
+		WithFallbacks(modelList(os.Getenv("BEDROCK_FALLBACK_MODEL_IDS"))...),
+	}
+	if os.Getenv("BEDROCK_API") == "converse" {
+		options = append(options, WithConverse())
+	}
+
+	audit := AuditFlags{Audit: os.Getenv("BEDROCK_AUDIT"), AuditRedact: os.Getenv("BEDROCK_AUDIT_REDACT")}
+	if audit.AuditRedact == "" {
+		audit.AuditRedact = "email,phone,card"
+	}
+	auditor, err := audit.auditor()
+	if err != nil {
+		return nil, err
+	}
+	build := func(modelID string) (*Model, error) {
+		m, err := buildLargeLanguageModel(modelID, options...)
+		if err != nil {
+			return nil, err
+		}
+		m.Auditor = auditor
+		return m, nil
+	}
+	large, err := build(model)
+	if err != nil {
+		return nil, err
+	}
+
+	// BEDROCK_MODEL_IDS are the models a request may pick, as -models of the serve subcommand.
+	allowed := modelList(os.Getenv("BEDROCK_MODEL_IDS"))
+	s := &server{
+		models:   newModelSet(large, allowed, build),
+		loader:   LoaderFlags{Format: "auto"},
+		splitter: SplitterFlags{Splitter: "recursive", ChunkSize: 4000, ChunkOverlap: 200},
+	}
+	options = append(options, WithBaseModel(""), WithInferenceProfile(""))
+	for _, id := range allowed {
+		_, err = s.models.get(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// lambdaInitError reports to the Lambda runtime API that the function failed to start, and exits.
+func lambdaInitError(runtimeAPI string, err error) {
+	log.Print(err)
+	postLambda(fmt.Sprintf("http://%s/%s/runtime/init/error", runtimeAPI, lambdaAPIVersion), map[string]string{"errorMessage": err.Error(), "errorType": "Runtime.InitError"})
+	os.Exit(1)
+}
+
+func (s *server) handleLambdaEvent(ctx context.Context, event lambdaEvent) (any, error) {
+	switch {
+	case event.Body != nil:
+		var err error
+
+		body := []byte(*event.Body)
+		if event.IsBase64Encoded {
+			body, err = base64.StdEncoding.DecodeString(*event.Body)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var req SummarizeRequest
+
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return apiGatewayJSON(http.StatusBadRequest, SummarizeResponse{Error: err.Error()}), nil
+		}
+
+		status, resp := s.summarize(ctx, req, nil)
+		return apiGatewayJSON(status, resp), nil
+	case event.Detail != nil:
+		_, resp := s.summarize(ctx, *event.Detail, nil)
+		return resp, nil
+	}
+
+	_, resp := s.summarize(ctx, event.SummarizeRequest, nil)
+	return resp, nil
+}
+
+func apiGatewayJSON(status int, v any) apiGatewayResponse {
+	body, _ := json.Marshal(v)
+
+	return apiGatewayResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}
+}
+
+func postLambda(url string, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	resp.Body.Close()
+}
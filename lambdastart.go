@@ -0,0 +1,25 @@
+//go:build lambda
+
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// startLambda serves the invocations of the Lambda function until it is shut down. The binary is
+// deployed as the bootstrap of a provided.al2 runtime, see the lambda target of the Makefile.
+func startLambda(runtimeAPI string) {
+	s, err := newLambdaServer()
+	if err != nil {
+		lambdaInitError(runtimeAPI, err)
+	}
+
+	lambda.Start(func(ctx context.Context, event lambdaEvent) (any, error) {
+		// Lambda freezes the process between invocations, so spans are sent before responding.
+		defer flushTracing()
+
+		return s.handleLambdaEvent(ctx, event)
+	})
+}
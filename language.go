@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// minLanguageHits is how many stop words a text needs before its language is trusted.
+const minLanguageHits = 5
+
+type language struct {
+	name      string
+	stopWords []string
+}
+
+// languages is keyed by ISO 639-1 code and detected by counting frequent function words.
+var languages = map[string]language{
+	"en": {"English", []string{"the", "and", "is", "of", "to", "in", "that", "it", "with", "for", "this", "are"}},
+	"de": {"German", []string{"der", "die", "und", "ist", "nicht", "das", "ein", "eine", "mit", "auf", "sich", "auch"}},
+	"fr": {"French", []string{"le", "la", "les", "et", "est", "des", "une", "pas", "que", "pour", "dans", "avec"}},
+	"es": {"Spanish", []string{"el", "los", "las", "y", "es", "una", "por", "que", "con", "para", "del", "como"}},
+	"it": {"Italian", []string{"il", "gli", "e", "che", "di", "una", "non", "per", "sono", "della", "con", "anche"}},
+	"pt": {"Portuguese", []string{"os", "as", "e", "que", "não", "uma", "para", "com", "por", "mais", "dos", "como"}},
+	"nl": {"Dutch", []string{"de", "het", "een", "en", "is", "niet", "van", "dat", "op", "voor", "met", "zijn"}},
+}
+
+type LanguageMismatchError struct {
+	Want string
+	Got  string
+}
+
+func (e *LanguageMismatchError) Error() string {
+	return fmt.Sprintf("answer is written in %s instead of %s", languageName(e.Got), languageName(e.Want))
+}
+
+// detectLanguage returns the code of the language text is most likely written in, if enough of it is recognised.
+func detectLanguage(text string) (string, bool) {
+	counts := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		counts[word]++
+	}
+
+	var best string
+	var bestHits, secondHits int
+	for code, lang := range languages {
+		hits := 0
+		for _, word := range lang.stopWords {
+			hits += counts[word]
+		}
+		if hits > bestHits {
+			best, bestHits, secondHits = code, hits, bestHits
+		} else if hits > secondHits {
+			secondHits = hits
+		}
+	}
+	if bestHits < minLanguageHits || bestHits == secondHits {
+		return "", false
+	}
+
+	return best, true
+}
+
+func languageName(code string) string {
+	if lang, ok := languages[code]; ok {
+		return lang.name
+	}
+
+	return code
+}
+
+// languageInstruction is appended to the question so the answer, hashtags included, is written in lang.
+func languageInstruction(lang string) string {
+	return fmt.Sprintf(" Write the answer, including any hashtags, in %s.", languageName(lang))
+}
+
+// checkLanguage reports a LanguageMismatchError when text is recognisably written in another language than lang.
+func checkLanguage(text, lang string) error {
+	if _, ok := languages[lang]; !ok {
+		return nil
+	}
+
+	got, ok := detectLanguage(text)
+	if !ok || got == lang {
+		return nil
+	}
+
+	return &LanguageMismatchError{Want: lang, Got: got}
+}
+
+// resolveLanguage turns "auto" into the detected language of docs, or "" when it can't be told.
+func resolveLanguage(lang string, docs []schema.Document) string {
+	if lang != "auto" {
+		return lang
+	}
+
+	var text strings.Builder
+	for _, doc := range docs {
+		text.WriteString(doc.PageContent)
+		text.WriteString("\n")
+	}
+
+	detected, _ := detectLanguage(text.String())
+
+	return detected
+}
+
+// summarizeIn runs summarize asking for the answer in lang, and verifies it is. A LanguageMismatchError
+// is returned along with the answer, so callers can decide whether to keep it.
+func summarizeIn(ctx context.Context, llm llms.LanguageModel, docs []schema.Document, question, lang string, options ...chains.ChainCallOption) (string, error) {
+	lang = resolveLanguage(lang, docs)
+	if lang == "" {
+		return summarize(ctx, llm, docs, question, options...)
+	}
+
+	text, err := summarize(ctx, llm, docs, question+languageInstruction(lang), options...)
+	if err != nil {
+		return "", err
+	}
+
+	return text, checkLanguage(text, lang)
+}
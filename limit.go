@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// xCharLimit is the length limit of a post on X.
+const xCharLimit = 280
+
+// compressAttempts is how many times the model is asked to shorten a text before it is cut.
+const compressAttempts = 3
+
+const compressPromptFormat = `Rewrite this social media post in at most %d characters, it is %d characters now. Keep the key point and the hashtags at the end. Answer with the post only.
+
+%s`
+
+// fitCharLimit returns text, or when it is longer than limit characters, a version shortened by llm.
+// The hashtags are fixed after each attempt, and if the model never gets under the limit the text
+// before the hashtags is cut at a word boundary.
+func fitCharLimit(ctx context.Context, llm llms.LLM, text string, limit, hashtags int) (string, error) {
+	short := strings.TrimSpace(text)
+
+	for attempt := 0; attempt < compressAttempts && utf8.RuneCountInString(short) > limit; attempt++ {
+		answer, err := llm.Call(ctx, fmt.Sprintf(compressPromptFormat, limit, utf8.RuneCountInString(short), short), llms.WithMaxTokens(limit))
+		if err != nil {
+			return "", err
+		}
+		short = strings.TrimSpace(answer)
+
+		if hashtags > 0 {
+			short, err = fixHashtags(ctx, llm, short, hashtags)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if utf8.RuneCountInString(short) <= limit {
+		return short, nil
+	}
+
+	return cutToLimit(short, limit), nil
+}
+
+// cutToLimit shortens the text before the hashtags at a word boundary, ending it with an ellipsis.
+func cutToLimit(text string, limit int) string {
+	body, tags := splitHashtags(text)
+
+	var suffix string
+	if len(tags) > 0 {
+		suffix = "\n\n" + strings.Join(tags, " ")
+	}
+
+	room := limit - utf8.RuneCountInString(suffix) - 1
+	if room <= 0 {
+		return string([]rune(text)[:limit])
+	}
+
+	runes := []rune(body)
+	if len(runes) > room {
+		cut := string(runes[:room])
+		if i := strings.LastIndexAny(cut, " \n"); i > 0 {
+			cut = cut[:i]
+		}
+		body = strings.TrimRight(cut, " ,;:.-") + "…"
+	}
+
+	return body + suffix
+}
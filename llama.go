@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	llamaFormat       = "<|begin_of_text|>%s<|start_header_id|>user<|end_header_id|>\n\n%s<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"
+	llamaSystemFormat = "<|start_header_id|>system<|end_header_id|>\n\n%s<|eot_id|>"
+)
+
+type LlamaRequest struct {
+	Prompt      string  `json:"prompt"`
+	MaxGenLen   int     `json:"max_gen_len,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+	TopP        float64 `json:"top_p,omitempty"`
+}
+
+type LlamaResponse struct {
+	Generation string `json:"generation"`
+	StopReason string `json:"stop_reason"`
+}
+
+// LlamaCodec speaks the Meta Llama 3 instruct payload.
+type LlamaCodec struct{}
+
+func (LlamaCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	var header string
+	if system != "" {
+		header = fmt.Sprintf(llamaSystemFormat, system)
+	}
+
+	return json.Marshal(LlamaRequest{
+		Prompt:      fmt.Sprintf(llamaFormat, header, prompt),
+		MaxGenLen:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+	})
+}
+
+func (LlamaCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp LlamaResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{Completion: resp.Generation, StopReason: resp.StopReason}, nil
+}
+
+func (c LlamaCodec) DecodeChunk(body []byte) (string, error) {
+	resp, err := c.DecodeResponse(body)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Completion, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/langchaingo/documentloaders"
+	"github.com/tmc/langchaingo/schema"
+)
+
+type LoaderFlags struct {
+	Format           string
+	Language         string
+	RawHTML          bool
+	Render           string
+	Browser          string
+	GitHubReleases   int
+	GitHubFiles      string
+	IMAPSearch       string
+	IMAPLimit        int
+	WikiPages        int
+	SQL              string
+	SampleRows       int
+	TranscribeBucket string
+	TranscribeLang   string
+	OCR              string
+	OCRBucket        string
+}
+
+func (f *LoaderFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Format, "format", "auto", "format of the loaded content: auto, html, pdf, text, csv, xlsx, image, whose text is recognized with -ocr, or audio, transcribed with Amazon Transcribe")
+	fs.StringVar(&f.Language, "transcript-lang", "en", "preferred language of YouTube transcripts")
+	fs.BoolVar(&f.RawHTML, "raw-html", false, "load the whole HTML page instead of extracting the main article")
+	fs.StringVar(&f.Render, "render", "off", "run the scripts of web pages in a headless Chrome before loading them: off, auto for the pages that have almost no text without them, or always")
+	fs.StringVar(&f.Browser, "browser", os.Getenv("CHROME_PATH"), "Chrome or Chromium binary pages are rendered with, looked up in PATH when not given")
+	fs.IntVar(&f.GitHubReleases, "github-releases", 3, "number of latest releases loaded along with the README of a GitHub repository link, authenticated with GITHUB_TOKEN when set")
+	fs.StringVar(&f.GitHubFiles, "github-files", "", "comma separated paths of the files of a GitHub repository link also loaded, such as CHANGELOG.md")
+	fs.StringVar(&f.IMAPSearch, "imap-search", "", "IMAP search of the messages an imaps://user@host/mailbox link loads, such as UNSEEN FROM \"news@example.com\", empty for those of the last day; the password is IMAP_PASSWORD or that of the netrc file")
+	fs.IntVar(&f.IMAPLimit, "imap-limit", 100, "maximum number of most recent messages an IMAP link loads, 0 for all")
+	fs.IntVar(&f.WikiPages, "wiki-pages", 50, "maximum number of pages a Confluence space or Notion database link loads, 0 for all; Confluence is read with CONFLUENCE_USER and CONFLUENCE_TOKEN, Notion with NOTION_TOKEN")
+	fs.IntVar(&f.SampleRows, "sample-rows", 50, "number of rows, spread over the whole table, loaded from a CSV file or Excel sheet along with the description of its columns, 0 for all")
+	fs.StringVar(&f.TranscribeBucket, "transcribe-bucket", os.Getenv("TRANSCRIBE_BUCKET"), "s3://bucket/prefix audio and video files and links are uploaded to for Amazon Transcribe, S3 objects are transcribed where they are")
+	fs.StringVar(&f.TranscribeLang, "transcribe-lang", "auto", "language code of the audio transcribed, such as en-US, or auto to identify it")
+	fs.StringVar(&f.OCR, "ocr", "auto", "OCR of images and of PDFs without a text layer: auto for Amazon Textract, falling back to a local tesseract when it fails, textract, tesseract, or off")
+	fs.StringVar(&f.OCRBucket, "ocr-bucket", os.Getenv("OCR_BUCKET"), "s3://bucket/prefix scanned PDFs of several pages are uploaded to for Amazon Textract")
+	fs.StringVar(&f.SQL, "sql", "", "query whose rows a postgres:// or mysql:// -url loads, each as a document of its columns")
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "html"
+	}
+
+	switch mediaType {
+	case "application/pdf":
+		return "pdf"
+	case "text/plain", "text/markdown":
+		return "text"
+	case "image/png", "image/jpeg", "image/tiff":
+		return "image"
+	case "text/csv", "text/tab-separated-values":
+		return "csv"
+	case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return "xlsx"
+	}
+	if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+		return "audio"
+	}
+
+	return "html"
+}
+
+func formatFromExtension(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm":
+		return "html"
+	case ".pdf":
+		return "pdf"
+	case ".txt", ".md", ".markdown":
+		return "text"
+	case ".csv", ".tsv":
+		return "csv"
+	case ".xlsx":
+		return "xlsx"
+	case ".png", ".jpg", ".jpeg", ".tif", ".tiff":
+		return "image"
+	case ".mp3", ".m4a", ".wav", ".flac", ".ogg", ".amr", ".mp4", ".webm":
+		return "audio"
+	}
+
+	return ""
+}
+
+// getDocs loads a web link, an S3 object or prefix, the rows of a -sql query on a postgres:// or
+// mysql:// database, the threads of an IMAP mailbox, a Wikipedia article named as wikipedia:Title,
+// an arXiv paper named as arxiv:ID, Confluence pages named as confluence:page:ID or
+// confluence:space:KEY, Notion pages named as notion:ID, the content piped in when source is "-"
+// or, when source is not a URL, a local file or directory.
+func getDocs(ctx context.Context, source string, l LoaderFlags) ([]schema.Document, error) {
+	if source == "-" {
+		return getDocsFromStdin(ctx, l)
+	}
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return getWebDocs(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "s3://") {
+		return getDocsFromS3(ctx, source, l)
+	}
+	if isSQLSource(source) {
+		return getDocsFromSQL(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "imaps://") || strings.HasPrefix(source, "imap://") {
+		return getDocsFromIMAP(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "wikipedia:") {
+		return getDocsFromWikipedia(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "arxiv:") {
+		return getDocsFromArxiv(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "confluence:") {
+		return getDocsFromConfluence(ctx, source, l)
+	}
+	if strings.HasPrefix(source, "notion:") {
+		return getDocsFromNotion(ctx, source, l)
+	}
+
+	return getDocsFromPath(ctx, source, l)
+}
+
+// getDocsFromStdin loads the content piped in, in -format or, by default, the format it looks like.
+func getDocsFromStdin(ctx context.Context, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading data from stdin")
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("nothing was piped in")
+	}
+
+	format := l.Format
+	if format == "auto" {
+		format = formatFromContentType(http.DetectContentType(data))
+	}
+
+	docs, err := loadDocs(ctx, bytes.NewReader(data), format, l)
+	if err != nil {
+		return nil, err
+	}
+	for i := range docs {
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		docs[i].Metadata["source"] = "stdin"
+	}
+
+	return docs, nil
+}
+
+func getDocsFromPath(ctx context.Context, root string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading data from", root)
+
+	var docs []schema.Document
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		format := l.Format
+		if format == "auto" {
+			format = formatFromExtension(path)
+		}
+		if format == "" {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		loaded, err := loadDocs(ctx, file, format, l)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		for i := range loaded {
+			if loaded[i].Metadata == nil {
+				loaded[i].Metadata = map[string]any{}
+			}
+			loaded[i].Metadata["source"] = path
+		}
+
+		docs = append(docs, loaded...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no supported documents found in %s", root)
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded data from", root)
+
+	return docs, nil
+}
+
+func loadDocs(ctx context.Context, r io.Reader, format string, l LoaderFlags) ([]schema.Document, error) {
+	switch format {
+	case "html":
+		if l.RawHTML {
+			return documentloaders.NewHTML(r).Load(ctx)
+		}
+		text, err := extractArticle(r)
+		if err != nil {
+			return nil, err
+		}
+		return []schema.Document{{PageContent: text, Metadata: map[string]any{}}}, nil
+	case "pdf":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := documentloaders.NewPDF(bytes.NewReader(data), int64(len(data))).Load(ctx)
+		if err != nil || l.OCR == "off" || textLength(docs) >= ocrThreshold*max(len(docs), 1) {
+			return docs, err
+		}
+		fmt.Fprintln(os.Stderr, "the PDF has no text layer, recognizing the text of its", len(docs), "pages")
+		return ocr(ctx, data, true, len(docs), l)
+	case "image":
+		if l.OCR == "off" {
+			return nil, errors.New("loading an image needs -ocr")
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ocr(ctx, data, false, 1, l)
+	case "text":
+		return documentloaders.NewText(r).Load(ctx)
+	case "csv", "xlsx":
+		return loadTables(r, format, l)
+	case "audio":
+		return transcribeAudio(ctx, r, l)
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// getWebDocs loads a web link, using the transcript for YouTube videos.
+func getWebDocs(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	if isYouTubeURL(link) {
+		return getDocsFromYouTube(ctx, link, l)
+	}
+	if _, ok := githubRepoPath(link); ok && !l.RawHTML {
+		return getDocsFromGitHub(ctx, link, l)
+	}
+	if isWikipediaURL(link) && !l.RawHTML {
+		return getDocsFromWikipedia(ctx, link, l)
+	}
+	if _, ok := arxivID(link); ok && !l.RawHTML {
+		return getDocsFromArxiv(ctx, link, l)
+	}
+	if _, _, _, ok := confluenceSource(link); ok && !l.RawHTML {
+		return getDocsFromConfluence(ctx, link, l)
+	}
+	if _, ok := notionID(link); ok && !l.RawHTML {
+		return getDocsFromNotion(ctx, link, l)
+	}
+
+	return getDocsFromLink(ctx, link, l)
+}
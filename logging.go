@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// LogHandler is a callbacks.Handler that writes a JSON log line for every LLM call, chain step and
+// agent step.
+type LogHandler struct {
+	callbacks.SimpleHandler
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	llmStarts   map[context.Context]time.Time
+	chainStarts map[context.Context]time.Time
+}
+
+var _ callbacks.Handler = &LogHandler{}
+
+func newLogHandler(w io.Writer) *LogHandler {
+	return &LogHandler{
+		logger:      slog.New(slog.NewJSONHandler(w, nil)),
+		llmStarts:   map[context.Context]time.Time{},
+		chainStarts: map[context.Context]time.Time{},
+	}
+}
+
+func (h *LogHandler) HandleLLMStart(ctx context.Context, prompts []string) {
+	h.mu.Lock()
+	h.llmStarts[ctx] = time.Now()
+	h.mu.Unlock()
+
+	size := 0
+	for _, prompt := range prompts {
+		size += len(prompt)
+	}
+
+	h.logger.InfoContext(ctx, "llm start", "prompts", len(prompts), "prompt_chars", size)
+}
+
+func (h *LogHandler) HandleLLMEnd(ctx context.Context, output llms.LLMResult) {
+	size := 0
+	for _, generations := range output.Generations {
+		for _, generation := range generations {
+			size += len(generation.Text)
+		}
+	}
+
+	h.logger.InfoContext(ctx, "llm end", "completion_chars", size, "latency", h.since(h.llmStarts, ctx))
+}
+
+func (h *LogHandler) HandleChainStart(ctx context.Context, inputs map[string]any) {
+	h.mu.Lock()
+	h.chainStarts[ctx] = time.Now()
+	h.mu.Unlock()
+
+	attrs := []any{"inputs", sortedKeys(inputs)}
+	if docs, ok := inputs["input_documents"].([]schema.Document); ok {
+		attrs = append(attrs, "documents", len(docs))
+	}
+
+	h.logger.InfoContext(ctx, "chain start", attrs...)
+}
+
+func (h *LogHandler) HandleChainEnd(ctx context.Context, outputs map[string]any) {
+	h.logger.InfoContext(ctx, "chain end", "outputs", sortedKeys(outputs), "latency", h.since(h.chainStarts, ctx))
+}
+
+func (h *LogHandler) since(starts map[context.Context]time.Time, ctx context.Context) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start, ok := starts[ctx]
+	if !ok {
+		return 0
+	}
+	delete(starts, ctx)
+
+	return time.Since(start)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (h *LogHandler) HandleText(ctx context.Context, text string) {
+	h.logger.InfoContext(ctx, "text", "text", text)
+}
+
+func (h *LogHandler) HandleAgentAction(ctx context.Context, action schema.AgentAction) {
+	h.logger.InfoContext(ctx, "agent action", "tool", action.Tool, "input", action.ToolInput)
+}
+
+func (h *LogHandler) HandleToolStart(ctx context.Context, input string) {
+	h.logger.InfoContext(ctx, "tool start", "input_chars", len(input))
+}
+
+func (h *LogHandler) HandleToolEnd(ctx context.Context, output string) {
+	h.logger.InfoContext(ctx, "tool end", "output_chars", len(output))
+}
+
+func (h *LogHandler) HandleRetrieverStart(ctx context.Context, query string) {
+	h.logger.InfoContext(ctx, "retriever start", "query", query)
+}
+
+func (h *LogHandler) HandleRetrieverEnd(ctx context.Context, query string, documents []schema.Document) {
+	h.logger.InfoContext(ctx, "retriever end", "query", query, "documents", len(documents))
+}
@@ -6,71 +6,589 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 	"github.com/tmc/langchaingo/callbacks"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/documentloaders"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/schema"
+	"io"
 	"log"
-	"net/http"
+	"mime"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 const (
-	format  = "\n\nHuman:%s\n\nAssistant:"
-	modelID = "anthropic.claude-v2"
-	prompt  = "Give me a summary with maximum of 150 words. Add 3 hashtags at the end to publish on Twitter."
+	defaultURL = "https://medium.com/@spei/ai-without-machine-learning-47e90e5ae7c5"
+	modelID    = "anthropic.claude-v2"
 )
 
-type Request struct {
-	Prompt            string   `json:"prompt"`
-	MaxTokensToSample int      `json:"max_tokens_to_sample"`
-	Temperature       float64  `json:"temperature,omitempty"`
-	TopP              float64  `json:"top_p,omitempty"`
-	TopK              int      `json:"top_k,omitempty"`
-	StopSequences     []string `json:"stop_sequences,omitempty"`
+type Response struct {
+	Completion string               `json:"completion"`
+	ToolCall   *schema.FunctionCall `json:"tool_call,omitempty"`
+	StopReason string               `json:"stop_reason,omitempty"`
+	Usage      Usage                `json:"-"`
+	Guardrail  guardrailResult      `json:"-"`
+	Metadata   ResponseMetadata     `json:"-"`
 }
 
-type Response struct {
-	Completion string `json:"completion"`
+func (r Response) generation() *llms.Generation {
+	return &llms.Generation{
+		Text:           r.Completion,
+		Message:        &schema.AIChatMessage{Content: r.Completion, FunctionCall: r.ToolCall},
+		GenerationInfo: r.generationInfo(),
+	}
 }
 
 type Model struct {
-	CallbacksHandler        callbacks.Handler
-	bedrock                 *bedrockruntime.Client
-	useHumanAssistantPrompt bool
-	modelID                 string
+	CallbacksHandler callbacks.Handler
+	Timeout          time.Duration
+	Concurrency      int
+	Cache            Cache
+	Auditor          *Auditor
+	bedrock          BedrockInvoker
+	codec            Codec
+	modelID          string
+	baseModel        string
+	inferenceProfile string
+	usage            usageTracker
+	guardrail        Guardrail
+	converse         bool
+	system           string
+	stopWords        []string
+	sampling         Sampling
+	limiter          *RateLimiter
+	breaker          *CircuitBreaker
+	fallbackIDs      []string
+	fallbacks        []*Model
+	routeID          string
+	routeTokens      int
+	router           *Model
+	dryRun           io.Writer
+	replay           *Cassette
+	fallbackOnce     sync.Once
+	middleware       []Middleware
 }
 
+var debug bool
+
 func main() {
+	shutdown := initTracing()
+	defer shutdown()
+
+	if runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API"); runtimeAPI != "" {
+		startLambda(runtimeAPI)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(parseServeFlags(os.Args[2:]))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "models" {
+		runModels(parseModelsFlags(os.Args[2:]))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		runEval(parseEvalFlags(os.Args[2:]))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "profiles" {
+		runProfiles(parseProfilesFlags(os.Args[2:]))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		runDoctor(parseDoctorFlags(os.Args[2:]))
+		return
+	}
+
+	f := parseFlags(os.Args[1:])
+	debug = f.Debug
+	awsFlags = f.AWSFlags
+	fetchFlags = f.FetchFlags
+	fetchFlags.FetchAuthFlags = f.FetchAuthFlags.scopeAuth(f.URL)
+	transportFlags = f.TransportFlags
+
+	if f.Prices != "" {
+		err := loadPrices(f.Prices)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// The other runs would go on with, and store, the empty answers of the model, and the
+	// hierarchical summary and the embeddings of -dedup and the semantic splitter call Bedrock.
+	if f.PrintPayload && (f.URLs != "" || f.Feed != "" || f.Crawl != "" || f.Schedule != "" || f.Compare != "" || f.Interactive || f.Incremental || f.JSON || f.Mode != "summarize") {
+		log.Fatal("-print-payload only prints the payloads of a single summary, without -urls, -feed, -crawl, -schedule, -compare, -interactive, -incremental, -json or another -mode")
+	}
+	if f.PrintPayload && (f.Hierarchical || f.Dedup > 0 || f.Splitter == "semantic") {
+		log.Fatal("-print-payload doesn't invoke Bedrock, so it can't be used with -hierarchical, -dedup or -splitter semantic")
+	}
+
+	if f.Schedule != "" {
+		runSchedule(f)
+		return
+	}
+
+	question, err := f.PromptFlags.question()
+	if err != nil {
+		log.Fatal(err)
+	}
+	f.hashtags, err = f.PromptFlags.hashtagCount()
+	if err != nil {
+		log.Fatal(err)
+	}
+	f.Prompt = question
+
+	large := newModel(f)
+
+	images, err := loadImages(f.Images)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(images) > 0 && (f.URLs != "" || f.Feed != "" || f.Crawl != "" || f.Interactive) {
+		log.Fatal("-image can't be combined with -urls, -feed, -crawl or -interactive")
+	}
+	ctx := withImages(context.Background(), images)
+
+	publishers, err := newPublishers(f.Publish, f.DryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := f.PolicyFlags.policy(large)
+	if err != nil {
+		log.Fatal(err)
+	}
+	publishers = guard(publishers, policy)
+
+	if f.URLs != "" {
+		printUsage(os.Stderr, runBatch(large, f)...)
+		return
+	}
+
+	if f.Feed != "" {
+		runFeed(large, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	if f.Crawl != "" {
+		runCrawl(ctx, large, publishers, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	// A knowledge base or an agent holds its own documents, so none are loaded.
+	if f.Mode == "kb" {
+		runKnowledgeBase(ctx, f)
+		return
+	}
+	if f.Mode == "agent" {
+		runAgent(ctx, f)
+		return
+	}
+	// A translation is made of the whole document, so it is loaded unsplit and chunked to fit.
+	if f.Mode == "translate" {
+		runTranslate(ctx, large, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	if f.URL == "-" && f.Interactive {
+		log.Fatal("-interactive reads questions from stdin, so the content can't be piped in")
+	}
+
+	var docs []schema.Document
+	if f.URL != "" {
+		docs = loadData(ctx, f.URL, f.LoaderFlags, f.SplitterFlags)
+	}
+	redactor, err := f.PIIFlags.redactor()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if redactor != nil {
+		docs, err = redactor.redactDocs(ctx, docs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx = withRedactor(ctx, redactor)
+	}
+	// A question is answered from the chunks most relevant to it, so all of them are stored, not only those that fit.
+	if f.Mode == "qa" && f.PGVector != "" {
+		docs, err = retrieveChunks(ctx, docs, f.Question, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Each model fits the documents to its own context window.
+	if f.Compare != "" {
+		runCompare(ctx, docs, f)
+		return
+	}
+	if f.Incremental {
+		docs, err = summarizeChanged(ctx, large, f.CacheFlags.Dir, f.URL, docs, f.MaxTokens, f.Temperature)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if f.Hierarchical {
+		docs, err = condense(ctx, large, docs, large.DocumentBudget(f.MaxTokens), f.MaxTokens, f.Temperature)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	fitted := fitDocuments(large, docs, large.DocumentBudget(f.MaxTokens))
+	if f.PrintPayload {
+		printSelection(os.Stdout, large, docs, fitted)
+	}
+	docs = fitted
+
+	if f.Interactive {
+		runChat(large, docs, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	switch f.Mode {
+	case "summarize":
+	case "qa":
+		runQA(ctx, large, docs, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	default:
+		mode, ok := analysisModes[f.Mode]
+		if !ok {
+			log.Fatalf("unknown -mode %q, expected summarize, qa, kb, agent, translate, %s", f.Mode, strings.Join(analysisModeNames(), ", "))
+		}
+		runAnalysis(ctx, large, docs, mode, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	if f.Cite {
+		f.Prompt += citeInstruction
+	}
+
+	if f.JSON {
+		if lang := resolveLanguage(f.Lang, docs); lang != "" {
+			f.Prompt += languageInstruction(lang)
+		}
+		printStructured(ctx, large, docs, f)
+		printUsage(os.Stderr, large.usageReports()...)
+		return
+	}
+
+	writer, err := newOutputWriter(f.OutputFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	large := newLargeLanguageModel()
-	chain := chains.LoadStuffQA(large)
+	var mismatch *LanguageMismatchError
+
+	callOptions := []chains.ChainCallOption{chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature)}
+	// The hashtags are fixed once the answer is complete, the other formats wrap it, the
+	// pseudonymized PII is put back in it, and the content policy checks it, so it is only streamed
+	// as plain text to the terminal when none of these apply.
+	streamed := f.hashtags == 0 && f.Output == "" && writer == (PlainWriter{}) && (redactor == nil || !redactor.Pseudonymize) && policy == nil
+	if streamed {
+		callOptions = append(callOptions, chains.WithStreamingFunc(printChunk))
+	}
+
+	cited := docs
+	if f.Cite {
+		cited = numberDocs(docs)
+	}
+
+	if f.PrintPayload {
+		_, err = summarizeIn(ctx, large, cited, f.Prompt, f.Lang, callOptions...)
+		if err != nil && !errors.As(err, &mismatch) {
+			log.Fatal(err)
+		}
+		printUsage(os.Stdout, large.usageReports()...)
+		return
+	}
+
+	answerCtx, answering := withAnswerRecord(ctx)
+	generate := func(prompt string) (string, error) {
+		summary, err := summarizeIn(answerCtx, large, cited, prompt, f.Lang, callOptions...)
+		if errors.As(err, &mismatch) {
+			log.Println("warning:", err)
+		} else if err != nil {
+			return "", err
+		}
+		summary = redactor.restore(summary)
+
+		if f.hashtags > 0 {
+			return fixHashtags(ctx, large, summary, f.hashtags)
+		}
+		return summary, nil
+	}
+	summary, err := generate(f.Prompt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	summary, err = policy.enforce(ctx, summary, func(avoid string) (string, error) {
+		return generate(f.Prompt + avoidInstruction(avoid))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	post := summary
+	if f.CharLimit > 0 && utf8.RuneCountInString(summary) > f.CharLimit {
+		post, err = fitCharLimit(ctx, large, summary, f.CharLimit, f.hashtags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var thread []string
+	if f.Thread > 0 {
+		limit := f.CharLimit
+		if limit == 0 {
+			limit = xCharLimit
+		}
+		thread, err = makeThread(ctx, large, summary, f.Thread, limit)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	out := Output{Title: "Summary of " + f.URL, Source: f.URL, Model: answering.ModelID(), Created: time.Now(), Summary: strings.TrimSpace(summary)}
+	if post != summary {
+		out.Short = post
+	}
+	out.Thread = thread
+	if f.Cite {
+		out.Citations = restoreCitations(redactor, citations(summary, docs, f.URL))
+	}
+	// A streamed summary is on the terminal already, only what follows it is left to write.
+	if streamed {
+		out.Summary = ""
+	}
+	err = writeOutput(f.Output, writer, out)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	answer, err := chains.Call(context.Background(), chain, map[string]any{
-		"input_documents": loadData("https://medium.com/@spei/ai-without-machine-learning-47e90e5ae7c5"),
-		"question":        prompt,
-	}, chains.WithMaxTokens(500), chains.WithTemperature(0.1))
+	err = publish(ctx, publishers, Post{Title: "Summary of " + f.URL, Link: f.URL, Text: summary, Short: post, Thread: thread})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Println(answer["text"].(string))
+	if f.Card != "" {
+		err = writeCard(ctx, large, newImageGenerator(f.CardModel, nil), summary, f.Card)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	printUsage(os.Stderr, large.usageReports()...)
 }
 
-func newLargeLanguageModel() *Model {
-	cfg, err := config.LoadDefaultConfig(context.Background())
+// newModel creates the Model the flags describe.
+func newModel(f Flags) *Model {
+	large, err := buildModel(f)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	return &Model{
-		CallbacksHandler:        nil,
-		bedrock:                 bedrockruntime.NewFromConfig(cfg),
-		useHumanAssistantPrompt: true,
-		modelID:                 modelID,
+	return large
+}
+
+// buildModel is newModel returning an error for a model it can't call.
+func buildModel(f Flags) (*Model, error) {
+	options := []ModelOption{WithGuardrail(f.GuardrailID, f.GuardrailVersion), WithSystemPrompt(f.System), WithBaseModel(f.BaseModel), WithInferenceProfile(f.InferenceProfile), WithFallbacks(modelList(f.Fallback)...), WithRouter(f.Route, f.RouteTokens), WithSampling(f.Sampling), WithRateLimit(f.RPS, f.TPM), WithCircuitBreaker(f.CircuitFailures, f.CircuitCooldown)}
+	if f.Converse {
+		options = append(options, WithConverse())
+	}
+	if f.PrintPayload {
+		options = append(options, WithDryRun(os.Stdout))
+	}
+	cassette, err := f.AuditFlags.cassette()
+	if err != nil {
+		return nil, err
+	}
+	if cassette != nil {
+		options = append(options, WithReplay(cassette))
+	}
+
+	large, err := buildLargeLanguageModel(f.Model, options...)
+	if err != nil {
+		return nil, err
+	}
+	large.Timeout = f.Timeout
+	large.Concurrency = f.Workers
+	large.Cache = f.CacheFlags.cache()
+	auditor, err := f.AuditFlags.auditor()
+	if err != nil {
+		return nil, err
+	}
+	large.Auditor = auditor
+	if f.Verbose {
+		large.CallbacksHandler = newLogHandler(os.Stderr)
+	}
+
+	return large, nil
+}
+
+func summarize(ctx context.Context, llm llms.LanguageModel, docs []schema.Document, question string, options ...chains.ChainCallOption) (_ string, err error) {
+	ctx, span := startSpan(ctx, "chain stuff_qa", spanKindInternal, "documents", len(docs))
+	defer func() { span.End(err) }()
+
+	chain := chains.LoadStuffQA(llm)
+
+	inputs := map[string]any{
+		"input_documents": docs,
+		"question":        question,
+	}
+
+	var handler callbacks.Handler
+	if h, ok := llm.(callbacks.HandlerHaver); ok {
+		handler = h.GetCallbackHandler()
+	}
+	if handler != nil {
+		handler.HandleChainStart(ctx, inputs)
 	}
+
+	answer, err := chains.Call(ctx, chain, inputs, options...)
+	if err != nil {
+		return "", err
+	}
+
+	if handler != nil {
+		handler.HandleChainEnd(ctx, answer)
+	}
+
+	return answer["text"].(string), nil
+}
+
+func printStructured(ctx context.Context, large *Model, docs []schema.Document, f Flags) {
+	s, err := loadSchema(f.Schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cited := docs
+	if f.Cite {
+		cited = numberDocs(docs)
+	}
+
+	v, err := summarizeStructured(ctx, large, cited, f.Prompt, s, f.MaxTokens, f.Temperature)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The citations are those made anywhere in the output, listed next to its own fields.
+	if object, ok := v.(map[string]any); ok && f.Cite {
+		object["citations"] = citations(string(out), docs, f.URL)
+		out, err = json.MarshalIndent(object, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println(redactorFrom(ctx).restore(string(out)))
+}
+
+func printChunk(ctx context.Context, chunk []byte) error {
+	fmt.Print(string(chunk))
+	return nil
+}
+
+func newBedrockClient() BedrockInvoker {
+	return newRegionFailover(func(cfg aws.Config) BedrockInvoker {
+		return runtimeClient{bedrockruntime.NewFromConfig(cfg)}
+	})
+}
+
+func newLargeLanguageModel(modelID string, options ...ModelOption) *Model {
+	m, err := buildLargeLanguageModel(modelID, options...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return m
+}
+
+// buildLargeLanguageModel is newLargeLanguageModel returning an error for a model it can't call,
+// for the models picked while serving.
+func buildLargeLanguageModel(modelID string, options ...ModelOption) (*Model, error) {
+	m := &Model{
+		CallbacksHandler: nil,
+		modelID:          modelID,
+	}
+	for _, option := range options {
+		option(m)
+	}
+
+	if m.baseModel == "" && baseModelUnknown(modelID) {
+		base, err := lookupBaseModel(context.Background(), modelID)
+		if err != nil {
+			return nil, fmt.Errorf("finding the model of %s: %w, name it with -base-model", modelID, err)
+		}
+		m.baseModel = base
+	}
+	if m.baseModel == "" {
+		m.baseModel = baseModelID(modelID)
+	}
+
+	if m.converse {
+		m.codec = ConverseCodec{guardrail: m.guardrail, minP: m.sampling.MinP}
+	} else {
+		codec, err := codecForModel(m.baseModel)
+		if err != nil {
+			return nil, err
+		}
+		m.codec = codec
+	}
+	m.warnUnsupportedSampling()
+
+	if m.bedrock == nil && m.converse {
+		m.bedrock = newConverseClient()
+	}
+	if m.bedrock == nil {
+		m.bedrock = newBedrockClient()
+	}
+
+	for _, id := range m.fallbackIDs {
+		fallback, err := buildLargeLanguageModel(id, append(slices.Clip(options), WithFallbacks(), WithRouter("", 0), WithBaseModel(""), WithInferenceProfile(""), WithInvoker(m.bedrock))...)
+		if err != nil {
+			return nil, err
+		}
+		m.fallbacks = append(m.fallbacks, fallback)
+	}
+	if m.routeID != "" {
+		router, err := buildLargeLanguageModel(m.routeID, append(slices.Clip(options), WithFallbacks(), WithRouter("", 0), WithBaseModel(""), WithInferenceProfile(""), WithInvoker(m.bedrock))...)
+		if err != nil {
+			return nil, err
+		}
+		m.router = router
+	}
+	// The fallbacks share the invoker before it is wrapped, as they wrap it with the same middleware.
+	for i := len(m.middleware) - 1; i >= 0; i-- {
+		m.bedrock = m.middleware[i](m.bedrock)
+	}
+
+	return m, nil
+}
+
+func (m *Model) GetCallbackHandler() callbacks.Handler {
+	return m.CallbacksHandler
 }
 
 func (m *Model) GeneratePrompt(ctx context.Context, prompts []schema.PromptValue, options ...llms.CallOption) (llms.LLMResult, error) {
@@ -92,7 +610,14 @@ func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOpt
 	return r[0].Text, nil
 }
 
-func (m *Model) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) ([]*llms.Generation, error) {
+func (m *Model) Generate(ctx context.Context, prompts []string, options ...llms.CallOption) (_ []*llms.Generation, err error) {
+	if len(prompts) == 0 {
+		return nil, errors.New("no prompts")
+	}
+
+	ctx, span := startSpan(ctx, "llm generate", spanKindInternal, "gen_ai.request.model", m.modelID, "prompts", len(prompts))
+	defer func() { span.End(err) }()
+
 	if m.CallbacksHandler != nil {
 		m.CallbacksHandler.HandleLLMStart(ctx, prompts)
 	}
@@ -101,41 +626,162 @@ func (m *Model) Generate(ctx context.Context, prompts []string, options ...llms.
 	for _, opt := range options {
 		opt(opts)
 	}
+	opts.StopWords = m.withStopWords(opts.StopWords)
+	m.sampling.apply(opts)
+
+	generations := make([]*llms.Generation, len(prompts))
+
+	// Streamed chunks of concurrent prompts would interleave, so those run one at a time.
+	concurrency := max(m.Concurrency, 1)
+	if opts.StreamingFunc != nil {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	errs := make([]error, len(prompts))
+
+	var wg sync.WaitGroup
+	for i, prompt := range prompts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, prompt string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			generations[i], errs[i] = m.generate(ctx, prompt, opts)
+		}(i, prompt)
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
 
-	request := Request{
-		Prompt:            fmt.Sprintf(format, prompts[0]),
-		MaxTokensToSample: opts.MaxTokens,
-		Temperature:       opts.Temperature,
-		TopK:              opts.TopK,
-		TopP:              opts.TopP,
-		StopSequences:     opts.StopWords,
+	if m.CallbacksHandler != nil {
+		m.CallbacksHandler.HandleLLMEnd(ctx, llms.LLMResult{Generations: [][]*llms.Generation{generations}})
+	}
+	return generations, nil
+}
+
+func (m *Model) generateOnce(ctx context.Context, prompt string, opts *llms.CallOptions) (*llms.Generation, error) {
+	err := m.checkPromptSize(prompt, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	payload, err := json.Marshal(request)
+	payload, err := m.encodeRequest(ctx, prompt, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	if debug {
+		log.Printf("invoking %s with %s", m.modelID, payload)
+	}
+	if m.dryRun != nil {
+		return m.printPayload(prompt, payload, opts)
+	}
+	if m.replay != nil {
+		return m.replayResponse(ctx, prompt, opts)
+	}
+
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	var key string
+	if m.Cache != nil {
+		key = cacheKey(m.modelID, payload, m.guardrail.invokeHeaders()...)
+		resp, ok := m.Cache.Get(key)
+		result := "miss"
+		if ok {
+			result = "hit"
+		}
+		cacheMetric.WithLabelValues(m.modelID, result).Inc()
+		if ok {
+			if opts.StreamingFunc != nil {
+				err = opts.StreamingFunc(ctx, []byte(resp.Completion))
+				if err != nil {
+					return nil, err
+				}
+			}
+			return resp.generation(), nil
+		}
+	}
+
+	probe, err := m.breaker.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Bedrock counts the maximum output against the tokens per minute until the response tells the actual usage.
+	estimated := m.GetNumTokens(prompt) + opts.MaxTokens
+	if m.limiter != nil {
+		err = m.limiter.Wait(ctx, estimated)
+		if err != nil {
+			m.breaker.release(probe)
+			return nil, err
+		}
+	}
+
 	var resp Response
 
-	resp, err = m.getResponse(payload)
+	// A tool call is only known once the response is complete, so calls with tools are not streamed.
+	start := time.Now()
+	if opts.StreamingFunc != nil && len(opts.Functions) == 0 {
+		resp, err = m.getResponseStream(ctx, payload, opts.StreamingFunc)
+	} else {
+		resp, err = m.getResponse(ctx, payload)
+		if err == nil && opts.StreamingFunc != nil && resp.Completion != "" {
+			err = opts.StreamingFunc(ctx, []byte(resp.Completion))
+		}
+	}
+	latency := time.Since(start)
+	m.breaker.done(time.Now(), probe, err)
 	if err != nil {
+		m.audit(ctx, start, latency, prompt, resp, err)
 		return nil, err
 	}
 
-	generations := []*llms.Generation{
-		{Text: resp.Completion},
+	if m.Cache != nil {
+		m.Cache.Set(key, resp)
 	}
 
-	if m.CallbacksHandler != nil {
-		m.CallbacksHandler.HandleLLMEnd(ctx, llms.LLMResult{Generations: [][]*llms.Generation{generations}})
+	if resp.Usage == (Usage{}) {
+		resp.Usage = Usage{InputTokens: m.GetNumTokens(prompt), OutputTokens: m.GetNumTokens(resp.Completion)}
 	}
-	return generations, nil
+	m.usage.add(resp.Usage)
+	usageMeterFrom(ctx).add(resp.Usage)
+	if m.limiter != nil {
+		m.limiter.Settle(estimated, resp.Usage.InputTokens+resp.Usage.OutputTokens)
+	}
+	m.audit(ctx, start, latency, prompt, resp, nil)
+
+	return resp.generation(), nil
 }
 
-func loadData(link string) []schema.Document {
+func (m *Model) encodeRequest(ctx context.Context, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	if _, ok := m.codec.(MessagesCodec); len(opts.Functions) > 0 && !ok {
+		return nil, fmt.Errorf("%s does not call tools, only Claude 3 models do", m.modelID)
+	}
 
-	docs, err := getDocsFromLink(link)
+	images := imagesFrom(ctx)
+	if len(images) == 0 {
+		return m.codec.EncodeRequest(m.system, prompt, opts)
+	}
+
+	codec, ok := m.codec.(ImageCodec)
+	if !ok {
+		return nil, fmt.Errorf("%s does not accept images", m.modelID)
+	}
+
+	return codec.EncodeImageRequest(m.system, prompt, images, opts)
+}
+
+func loadData(ctx context.Context, link string, l LoaderFlags, s SplitterFlags) []schema.Document {
+	docs, err := loadDocuments(ctx, link, getDocs, l, s)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -143,41 +789,194 @@ func loadData(link string) []schema.Document {
 	return docs
 }
 
-func getDocsFromLink(link string) ([]schema.Document, error) {
-	fmt.Println("loading data from", link)
+// loadDocuments loads the documents of source with load, splits them and drops the duplicate
+// chunks with -dedup, tracing each step and checkpointing it in a batch.
+func loadDocuments(ctx context.Context, source string, load func(context.Context, string, LoaderFlags) ([]schema.Document, error), l LoaderFlags, s SplitterFlags) ([]schema.Document, error) {
+	_, span := startSpan(ctx, "load documents", spanKindInternal, "source", source)
+	docs, err := load(ctx, source, l)
+	for i := range docs {
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		if _, ok := docs[i].Metadata["source"]; !ok {
+			docs[i].Metadata["source"] = source
+		}
+	}
+	span.SetAttributes("documents", len(docs))
+	span.End(err)
+	if err != nil {
+		return nil, err
+	}
+	checkpointsFrom(ctx).mark(ctx, source, "loaded", 0, nil)
+
+	_, span = startSpan(ctx, "split documents", spanKindInternal, "splitter", s.Splitter)
+	docs, err = splitDocs(docs, s)
+	span.SetAttributes("chunks", len(docs))
+	span.End(err)
+	if err == nil && s.Dedup > 0 {
+		_, span = startSpan(ctx, "deduplicate chunks", spanKindInternal, "threshold", s.Dedup)
+		docs, err = dedupDocs(ctx, newEmbeddings(s.EmbeddingModel), docs, s.Dedup)
+		span.SetAttributes("chunks", len(docs))
+		span.End(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkpointsFrom(ctx).mark(ctx, source, "chunked", len(docs), nil)
+
+	return docs, nil
+}
+
+func getDocsFromLink(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	switch l.Render {
+	case "", "off", "auto":
+	case "always":
+		return getRenderedDocs(ctx, link, l)
+	default:
+		return nil, fmt.Errorf("unknown -render %q, expected off, auto or always", l.Render)
+	}
+
+	fmt.Fprintln(os.Stderr, "loading data from", link)
 
-	resp, err := http.Get(link)
+	resp, err := fetch(ctx, link)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	docs, err := documentloaders.NewHTML(resp.Body).Load(context.Background())
+	format := l.Format
+	if format == "auto" {
+		format = formatFromContentType(resp.Header.Get("Content-Type"))
+		// Podcast episodes and other downloads are often served without their media type.
+		if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/octet-stream" || mediaType == "binary/octet-stream" {
+			if f := formatFromExtension(resp.Request.URL.Path); f != "" {
+				format = f
+			}
+		}
+	}
+
+	docs, err := loadDocs(ctx, resp.Body, format, l)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if l.Render == "auto" && format == "html" && textLength(docs) < renderThreshold {
+		return getRenderedDocs(ctx, link, l)
 	}
 
-	fmt.Println("successfully loaded data from", link)
+	fmt.Fprintln(os.Stderr, "successfully loaded data from", link)
 
 	return docs, nil
 }
 
-func (m *Model) getResponse(payload []byte) (Response, error) {
+func (m *Model) getResponse(ctx context.Context, payload []byte) (resp Response, err error) {
+	ctx, done := m.instrument(ctx, "InvokeModel")
+	defer func() { done(resp, err) }()
 
-	out, err := m.bedrock.InvokeModel(context.Background(), &bedrockruntime.InvokeModelInput{
+	out, err := m.bedrock.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
 		Body:        payload,
-		ModelId:     aws.String(m.modelID),
+		ModelId:     aws.String(m.invokeID()),
 		ContentType: aws.String("application/json"),
-	})
+	}, m.guardrail.invokeOptions()...)
 	if err != nil {
-		return Response{}, err
+		return Response{}, bedrockError(m.modelID, err)
 	}
-	var resp Response
 
-	err = json.Unmarshal(out.Body, &resp)
+	resp, err = m.codec.DecodeResponse(out.Body)
 	if err != nil {
 		return Response{}, err
 	}
 
+	if usage, ok := usageFromHeaders(out.ResultMetadata); ok {
+		resp.Usage = usage
+	}
+	md := metadataFromHeaders(out.ResultMetadata)
+	resp.Metadata.RequestID = md.RequestID
+	if md.ModelLatency > 0 {
+		resp.Metadata.ModelLatency = md.ModelLatency
+	}
+	if guardrail, ok := guardrailFromBody(out.Body); ok {
+		resp.Guardrail = guardrail
+	}
+
 	return resp, nil
 }
+
+func (m *Model) getResponseStream(ctx context.Context, payload []byte, streamingFunc func(ctx context.Context, chunk []byte) error) (resp Response, err error) {
+	ctx, done := m.instrument(ctx, "InvokeModelWithResponseStream")
+	defer func() { done(resp, err) }()
+
+	var requestID string
+	stream, err := m.bedrock.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+		Body:        payload,
+		ModelId:     aws.String(m.invokeID()),
+		ContentType: aws.String("application/json"),
+	}, append(m.guardrail.invokeOptions(), requestIDOption(&requestID))...)
+	if err != nil {
+		return Response{}, bedrockError(m.modelID, err)
+	}
+	defer stream.Close()
+
+	var completion strings.Builder
+	var usage Usage
+	var guardrail guardrailResult
+	var metadata ResponseMetadata
+	var stopReason string
+
+	for event := range stream.Events() {
+		chunk, ok := event.(*types.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+
+		if u, ok := usageFromChunk(chunk.Value.Bytes); ok {
+			usage = u
+		}
+		if g, ok := guardrailFromBody(chunk.Value.Bytes); ok {
+			guardrail = g
+		}
+		if md, ok := metadataFromChunk(chunk.Value.Bytes); ok {
+			metadata = md
+		}
+		if reason := stopReasonFromChunk(chunk.Value.Bytes); reason != "" {
+			stopReason = reason
+		}
+
+		text, err := m.codec.DecodeChunk(chunk.Value.Bytes)
+		if err != nil {
+			return Response{}, err
+		}
+		if text == "" {
+			continue
+		}
+
+		completion.WriteString(text)
+
+		err = streamingFunc(ctx, []byte(text))
+		if err != nil {
+			return Response{}, err
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return Response{}, bedrockError(m.modelID, err)
+	}
+
+	metadata.RequestID = requestID
+
+	return Response{Completion: completion.String(), StopReason: stopReason, Usage: usage, Guardrail: guardrail, Metadata: metadata}, nil
+}
+
+// instrument starts the client span of a Bedrock call, named and attributed after the
+// OpenTelemetry semantic conventions for generative AI, and returns the function recording
+// the outcome of the call in the span and the metrics.
+func (m *Model) instrument(ctx context.Context, operation string) (context.Context, func(Response, error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "bedrock "+operation, spanKindClient,
+		"rpc.service", "BedrockRuntime", "rpc.method", operation,
+		"gen_ai.system", "aws.bedrock", "gen_ai.request.model", m.modelID)
+
+	return ctx, func(resp Response, err error) {
+		span.endInvoke(resp, err)
+		recordInvoke(m.modelID, operation, start, resp, err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strconv"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ResponseMetadata is what Bedrock tells of a call besides its completion and usage.
+type ResponseMetadata struct {
+	RequestID string
+	// ModelLatency is the time the model took to answer, as measured by Bedrock.
+	ModelLatency time.Duration
+	// FirstByteLatency is the time to the first chunk of a stream, as measured by Bedrock.
+	FirstByteLatency time.Duration
+}
+
+// generationInfo is the GenerationInfo of the response, for callers and callbacks to log and act on.
+func (r Response) generationInfo() map[string]any {
+	info := map[string]any{
+		"input_tokens":  r.Usage.InputTokens,
+		"output_tokens": r.Usage.OutputTokens,
+	}
+	if r.StopReason != "" {
+		info["stop_reason"] = r.StopReason
+	}
+	if r.Metadata.RequestID != "" {
+		info["request_id"] = r.Metadata.RequestID
+	}
+	if r.Metadata.ModelLatency > 0 {
+		info["model_latency_ms"] = r.Metadata.ModelLatency.Milliseconds()
+	}
+	if r.Metadata.FirstByteLatency > 0 {
+		info["first_byte_latency_ms"] = r.Metadata.FirstByteLatency.Milliseconds()
+	}
+	maps.Copy(info, r.Guardrail.generationInfo())
+
+	return info
+}
+
+// metadataFromHeaders reads the request ID and the X-Amzn-Bedrock-Invocation-Latency header of an InvokeModel response.
+func metadataFromHeaders(metadata middleware.Metadata) ResponseMetadata {
+	var md ResponseMetadata
+	md.RequestID, _ = awsmiddleware.GetRequestIDMetadata(metadata)
+
+	if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+		if ms, err := strconv.Atoi(resp.Header.Get("X-Amzn-Bedrock-Invocation-Latency")); err == nil {
+			md.ModelLatency = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	return md
+}
+
+// metadataFromChunk reads the latencies Bedrock appends to the last chunk of a stream, or sends as
+// the metadata event of a ConverseStream.
+func metadataFromChunk(body []byte) (ResponseMetadata, bool) {
+	var chunk invocationMetrics
+
+	err := json.Unmarshal(body, &chunk)
+	if err != nil {
+		return ResponseMetadata{}, false
+	}
+	if chunk.Metadata != nil {
+		return ResponseMetadata{ModelLatency: time.Duration(chunk.Metadata.Metrics.LatencyMs) * time.Millisecond}, true
+	}
+	if chunk.Metrics == nil {
+		return ResponseMetadata{}, false
+	}
+
+	return ResponseMetadata{
+		ModelLatency:     time.Duration(chunk.Metrics.InvocationLatency) * time.Millisecond,
+		FirstByteLatency: time.Duration(chunk.Metrics.FirstByteLatency) * time.Millisecond,
+	}, true
+}
+
+// chunkStop holds where the payloads of the models put the stop reason in the last chunk of a stream.
+type chunkStop struct {
+	StopReason       string `json:"stop_reason"`
+	FinishReason     string `json:"finish_reason"`
+	CompletionReason string `json:"completionReason"`
+	Delta            struct {
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Outputs     []MistralOutput `json:"outputs"`
+	MessageStop *struct {
+		StopReason string `json:"stopReason"`
+	} `json:"messageStop"`
+}
+
+// stopReasonFromChunk reads the stop reason of a chunk, whichever model it is from.
+func stopReasonFromChunk(body []byte) string {
+	var chunk chunkStop
+
+	err := json.Unmarshal(body, &chunk)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case chunk.MessageStop != nil:
+		return chunk.MessageStop.StopReason
+	case len(chunk.Outputs) > 0:
+		return chunk.Outputs[0].StopReason
+	case chunk.Delta.StopReason != "":
+		return chunk.Delta.StopReason
+	case chunk.StopReason != "":
+		return chunk.StopReason
+	case chunk.FinishReason != "":
+		return chunk.FinishReason
+	}
+
+	return chunk.CompletionReason
+}
+
+// requestIDOption records the request ID of a call in id, for the streams whose output the Model
+// does not see.
+func requestIDOption(id *string) func(*bedrockruntime.Options) {
+	return func(o *bedrockruntime.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("RecordRequestID",
+				func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+					out, metadata, err := next.HandleDeserialize(ctx, in)
+					if resp, ok := out.RawResponse.(*smithyhttp.Response); ok {
+						*id = resp.Header.Get("X-Amzn-Requestid")
+					}
+					return out, metadata, err
+				}), middleware.After)
+		})
+	}
+}
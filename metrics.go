@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histograms.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+
+// metricsRegistry holds the metrics of the program alone, without those of the Go runtime.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	metricsFactory = promauto.With(metricsRegistry)
+
+	invocationsMetric = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "bedrock_invocations_total", Help: "Bedrock model invocations."}, []string{"model", "operation", "status"})
+	invocationSeconds = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "bedrock_invocation_duration_seconds", Help: "Latency of Bedrock model invocations.", Buckets: latencyBuckets}, []string{"model", "operation"})
+	tokensMetric      = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "bedrock_tokens_total", Help: "Tokens read and written by Bedrock models."}, []string{"model", "direction"})
+	throttledMetric   = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "bedrock_throttling_errors_total", Help: "Bedrock invocations rejected by throttling."}, []string{"model"})
+	cacheMetric       = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "bedrock_cache_requests_total", Help: "Response cache lookups."}, []string{"model", "result"})
+	circuitMetric     = metricsFactory.NewCounterVec(prometheus.CounterOpts{Name: "bedrock_circuit_transitions_total", Help: "Circuit breaker state changes of the models."}, []string{"model", "state"})
+	summarizeSeconds  = metricsFactory.NewHistogramVec(prometheus.HistogramOpts{Name: "summarization_duration_seconds", Help: "End-to-end latency of summarization requests.", Buckets: latencyBuckets}, []string{"status"})
+)
+
+// metricsHandler serves the metrics in the Prometheus exposition format.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// recordInvoke records a Bedrock call that started at start.
+func recordInvoke(modelID, operation string, start time.Time, resp Response, err error) {
+	if errors.Is(err, ErrThrottled) {
+		throttledMetric.WithLabelValues(modelID).Inc()
+	}
+
+	invocationsMetric.WithLabelValues(modelID, operation, outcome(err == nil)).Inc()
+	invocationSeconds.WithLabelValues(modelID, operation).Observe(time.Since(start).Seconds())
+	tokensMetric.WithLabelValues(modelID, "input").Add(float64(resp.Usage.InputTokens))
+	tokensMetric.WithLabelValues(modelID, "output").Add(float64(resp.Usage.OutputTokens))
+}
+
+// outcome is the status label of a call or summary.
+func outcome(ok bool) string {
+	if ok {
+		return "success"
+	}
+
+	return "error"
+}
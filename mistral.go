@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const mistralFormat = "<s>[INST] %s [/INST]"
+
+type MistralRequest struct {
+	Prompt      string   `json:"prompt"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature float64  `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type MistralOutput struct {
+	Text       string `json:"text"`
+	StopReason string `json:"stop_reason"`
+}
+
+type MistralResponse struct {
+	Outputs []MistralOutput `json:"outputs"`
+}
+
+// MistralCodec speaks the Mistral instruct payload.
+type MistralCodec struct{}
+
+func (MistralCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return json.Marshal(MistralRequest{
+		Prompt:      fmt.Sprintf(mistralFormat, withSystem(system, prompt)),
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		TopK:        opts.TopK,
+		Stop:        opts.StopWords,
+	})
+}
+
+func (MistralCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp MistralResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(resp.Outputs) == 0 {
+		return Response{}, nil
+	}
+
+	return Response{Completion: resp.Outputs[0].Text, StopReason: resp.Outputs[0].StopReason}, nil
+}
+
+func (c MistralCodec) DecodeChunk(body []byte) (string, error) {
+	resp, err := c.DecodeResponse(body)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Completion, nil
+}
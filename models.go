@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+)
+
+type ModelsFlags struct {
+	AWSFlags
+	Modality string
+	Provider string
+	JSON     bool
+}
+
+func parseModelsFlags(args []string) ModelsFlags {
+	var f ModelsFlags
+
+	fs := flag.NewFlagSet("models", flag.ExitOnError)
+	fs.StringVar(&f.Modality, "modality", "text", "output modality of the models listed: text, embedding, image or all")
+	fs.StringVar(&f.Provider, "provider", "", "only list the models of this provider, e.g. anthropic")
+	fs.BoolVar(&f.JSON, "json", false, "print the models as JSON instead of a table")
+	f.AWSFlags.register(fs)
+	_ = fs.Parse(args)
+
+	return f
+}
+
+// FoundationModel is a model of ListFoundationModels, with whether the account can call it.
+type FoundationModel struct {
+	ModelID                    string   `json:"modelId"`
+	ModelName                  string   `json:"modelName"`
+	ProviderName               string   `json:"providerName"`
+	InputModalities            []string `json:"inputModalities"`
+	OutputModalities           []string `json:"outputModalities"`
+	ResponseStreamingSupported bool     `json:"responseStreamingSupported"`
+	InferenceTypesSupported    []string `json:"inferenceTypesSupported"`
+	ModelLifecycle             struct {
+		Status string `json:"status"`
+	} `json:"modelLifecycle"`
+
+	// Access is AUTHORIZED when the model is enabled in the account, and Supported is true when
+	// this tool has a payload format for it.
+	Access    string `json:"access"`
+	Supported bool   `json:"supported"`
+}
+
+// listFoundationModels calls ListFoundationModels, then GetFoundationModelAvailability for each model.
+func listFoundationModels(ctx context.Context, cfg aws.Config, modality, provider string) ([]FoundationModel, error) {
+	client := bedrock.NewFromConfig(cfg)
+
+	in := &bedrock.ListFoundationModelsInput{}
+	if modality != "all" {
+		in.ByOutputModality = types.ModelModality(strings.ToUpper(modality))
+	}
+	if provider != "" {
+		in.ByProvider = aws.String(provider)
+	}
+
+	list, err := client.ListFoundationModels(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]FoundationModel, len(list.ModelSummaries))
+	for i, summary := range list.ModelSummaries {
+		models[i] = FoundationModel{
+			ModelID:                    aws.ToString(summary.ModelId),
+			ModelName:                  aws.ToString(summary.ModelName),
+			ProviderName:               aws.ToString(summary.ProviderName),
+			InputModalities:            enumStrings(summary.InputModalities),
+			OutputModalities:           enumStrings(summary.OutputModalities),
+			ResponseStreamingSupported: aws.ToBool(summary.ResponseStreamingSupported),
+			InferenceTypesSupported:    enumStrings(summary.InferenceTypesSupported),
+		}
+		if summary.ModelLifecycle != nil {
+			models[i].ModelLifecycle.Status = string(summary.ModelLifecycle.Status)
+		}
+	}
+
+	errs := make([]error, len(models))
+	sem := make(chan struct{}, 8)
+
+	var wg sync.WaitGroup
+	for i := range models {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m *FoundationModel, errp *error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			availability, err := client.GetFoundationModelAvailability(ctx, &bedrock.GetFoundationModelAvailabilityInput{ModelId: aws.String(m.ModelID)})
+			if err == nil {
+				m.Access = string(availability.AuthorizationStatus)
+			}
+			*errp = err
+			m.Supported = supportedModel(*m)
+		}(&models[i], &errs[i])
+	}
+	wg.Wait()
+
+	// Without the permission to read the availability, the models are still listed.
+	for _, err := range errs {
+		if err != nil {
+			log.Println("warning: cannot tell which models are enabled:", err)
+			break
+		}
+	}
+
+	slices.SortFunc(models, func(a, b FoundationModel) int { return strings.Compare(a.ModelID, b.ModelID) })
+
+	return models, nil
+}
+
+// supportedModel reports whether this tool can call the model, as the -model, the -card-model
+// or for embeddings.
+func supportedModel(m FoundationModel) bool {
+	switch {
+	case slices.Contains(m.OutputModalities, "TEXT"):
+		_, err := codecForModel(m.ModelID)
+		return err == nil
+	case slices.Contains(m.OutputModalities, "EMBEDDING"):
+		return strings.HasPrefix(m.ModelID, "amazon.titan-embed") || strings.HasPrefix(m.ModelID, "cohere.embed")
+	case slices.Contains(m.OutputModalities, "IMAGE"):
+		return strings.HasPrefix(m.ModelID, "amazon.titan-image") || strings.HasPrefix(m.ModelID, "stability.")
+	}
+
+	return false
+}
+
+// enumStrings returns the values of an enum of the SDK as strings.
+func enumStrings[T ~string](values []T) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v)
+	}
+
+	return s
+}
+
+// runModels prints the foundation models of the region, for the models subcommand.
+func runModels(f ModelsFlags) {
+	awsFlags = f.AWSFlags
+	cfg := loadAWSConfig()
+
+	models, err := listFoundationModels(context.Background(), cfg, f.Modality, f.Provider)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(models)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL ID\tPROVIDER\tINPUT\tOUTPUT\tSTREAMING\tINFERENCE\tSTATUS\tACCESS\tSUPPORTED")
+	for _, m := range models {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.ModelID, m.ProviderName,
+			strings.Join(m.InputModalities, ","), strings.Join(m.OutputModalities, ","),
+			yesNo(m.ResponseStreamingSupported), strings.Join(m.InferenceTypesSupported, ","),
+			m.ModelLifecycle.Status, valueOr(m.Access, "unknown"), yesNo(m.Supported))
+	}
+	err = w.Flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("\nregion:", cfg.Region)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+
+	return s
+}
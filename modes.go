@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// AnalysisMode is a -mode that, rather than summarizing the documents, pulls a JSON object from
+// them: a prompt, and the schema its output is parsed and repaired with.
+type AnalysisMode struct {
+	Prompt string
+	Schema func(f Flags) (*JSONSchema, error)
+}
+
+// analysisModes are the analysis modes by -mode name. Another mode only needs to be added here.
+var analysisModes = map[string]AnalysisMode{
+	"extract": {
+		Prompt: extractPrompt,
+		Schema: func(f Flags) (*JSONSchema, error) {
+			return extractSchema(f.Extract)
+		},
+	},
+	"seo": {
+		Prompt: seoPrompt,
+		Schema: func(Flags) (*JSONSchema, error) {
+			return seoSchema, nil
+		},
+	},
+	"sentiment": {
+		Prompt: sentimentPrompt,
+		Schema: func(Flags) (*JSONSchema, error) {
+			return sentimentSchema, nil
+		},
+	},
+}
+
+func analysisModeNames() []string {
+	names := make([]string, 0, len(analysisModes))
+	for name := range analysisModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// analyze pulls the object of mode from docs.
+func analyze(ctx context.Context, large *Model, docs []schema.Document, mode AnalysisMode, s *JSONSchema, lang string, maxTokens int, temperature float64) (any, error) {
+	prompt := mode.Prompt
+	if lang != "" {
+		prompt += languageInstruction(lang)
+	}
+
+	return summarizeStructured(ctx, large, docs, prompt, s, maxTokens, temperature)
+}
+
+// runAnalysis prints the object the analysis -mode pulls from the documents as JSON.
+func runAnalysis(ctx context.Context, large *Model, docs []schema.Document, mode AnalysisMode, f Flags) {
+	s, err := mode.Schema(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	v, err := analyze(ctx, large, docs, mode, s, resolveLanguage(f.Lang, docs), f.MaxTokens, f.Temperature)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(redactorFrom(ctx).restore(string(out)))
+}
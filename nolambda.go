@@ -0,0 +1,10 @@
+//go:build !lambda
+
+package main
+
+import "errors"
+
+// startLambda fails the Lambda function, as the binary is built without the Lambda runtime.
+func startLambda(runtimeAPI string) {
+	lambdaInitError(runtimeAPI, errors.New("the binary is built without the lambda tag, build it with make lambda"))
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+const (
+	notionAPI     = "https://api.notion.com/v1"
+	notionVersion = "2022-06-28"
+)
+
+// notionIDPattern matches the ID at the end of a Notion link, with or without its dashes.
+var notionIDPattern = regexp.MustCompile(`([0-9a-f]{8}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{12})$`)
+
+type notionRichText []struct {
+	PlainText string `json:"plain_text"`
+}
+
+func (t notionRichText) String() string {
+	var b strings.Builder
+	for _, part := range t {
+		b.WriteString(part.PlainText)
+	}
+
+	return b.String()
+}
+
+type notionPage struct {
+	ID             string `json:"id"`
+	URL            string `json:"url"`
+	LastEditedTime string `json:"last_edited_time"`
+	Properties     map[string]struct {
+		Type  string         `json:"type"`
+		Title notionRichText `json:"title"`
+	} `json:"properties"`
+}
+
+func (p notionPage) title() string {
+	for _, property := range p.Properties {
+		if property.Type == "title" {
+			return property.Title.String()
+		}
+	}
+
+	return ""
+}
+
+// notionBlock is a block of a page. Its text is under the key of its type, such as "paragraph".
+type notionBlock struct {
+	ID          string                     `json:"id"`
+	Type        string                     `json:"type"`
+	HasChildren bool                       `json:"has_children"`
+	Content     map[string]json.RawMessage `json:"-"`
+}
+
+func (b *notionBlock) UnmarshalJSON(data []byte) error {
+	type plain notionBlock
+	err := json.Unmarshal(data, (*plain)(b))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &b.Content)
+}
+
+// text returns the block as a line of Markdown, and whether it has any.
+func (b notionBlock) text(depth int) (string, bool) {
+	var content struct {
+		RichText notionRichText `json:"rich_text"`
+		Checked  bool           `json:"checked"`
+		Title    string         `json:"title"`
+	}
+	_ = json.Unmarshal(b.Content[b.Type], &content)
+	text := content.RichText.String()
+	indent := strings.Repeat("  ", depth)
+
+	switch b.Type {
+	case "heading_1":
+		return "# " + text, true
+	case "heading_2":
+		return "## " + text, true
+	case "heading_3":
+		return "### " + text, true
+	case "bulleted_list_item", "toggle":
+		return indent + "- " + text, true
+	case "numbered_list_item":
+		return indent + "1. " + text, true
+	case "to_do":
+		if content.Checked {
+			return indent + "- [x] " + text, true
+		}
+		return indent + "- [ ] " + text, true
+	case "quote", "callout":
+		return "> " + text, true
+	case "code":
+		return "```\n" + text + "\n```", true
+	case "child_page", "child_database":
+		return "## " + content.Title, true
+	}
+
+	return text, text != ""
+}
+
+func notionID(source string) (string, bool) {
+	if rest, ok := strings.CutPrefix(source, "notion:"); ok {
+		source = rest
+	} else {
+		u, err := url.Parse(source)
+		if err != nil || (u.Hostname() != "notion.so" && u.Hostname() != "www.notion.so" && !strings.HasSuffix(u.Hostname(), ".notion.site")) {
+			return "", false
+		}
+		source = strings.TrimSuffix(u.Path, "/")
+	}
+
+	m := notionIDPattern.FindStringSubmatch(source)
+	if m == nil {
+		return "", false
+	}
+
+	return strings.ReplaceAll(m[1], "-", ""), true
+}
+
+// notionDo decodes the response of the Notion API to a request into v, authenticated with the
+// integration token NOTION_TOKEN.
+func notionDo(ctx context.Context, method, path string, body, v any) error {
+	token := os.Getenv("NOTION_TOKEN")
+	if token == "" {
+		return fmt.Errorf("loading from Notion needs the token of an integration the pages are shared with in NOTION_TOKEN")
+	}
+
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, notionAPI+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fetchFlags.UserAgent)
+
+	client, err := fetchFlags.client()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return &notionError{Status: resp.StatusCode, Code: apiErr.Code, Message: apiErr.Message}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type notionError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *notionError) Error() string {
+	return fmt.Sprintf("Notion: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// notionBlocks returns the blocks of a page as lines of Markdown, their children indented under them.
+func notionBlocks(ctx context.Context, id string, depth int) ([]string, error) {
+	var lines []string
+	cursor := ""
+	for {
+		path := "/blocks/" + id + "/children?page_size=100"
+		if cursor != "" {
+			path += "&start_cursor=" + url.QueryEscape(cursor)
+		}
+
+		var result struct {
+			Results    []notionBlock `json:"results"`
+			HasMore    bool          `json:"has_more"`
+			NextCursor string        `json:"next_cursor"`
+		}
+
+		err := notionDo(ctx, http.MethodGet, path, nil, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range result.Results {
+			if line, ok := block.text(depth); ok {
+				lines = append(lines, line)
+			}
+			// The pages and databases under a page are their own documents.
+			if block.HasChildren && block.Type != "child_page" && block.Type != "child_database" {
+				children, err := notionBlocks(ctx, block.ID, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				lines = append(lines, children...)
+			}
+		}
+
+		if !result.HasMore {
+			return lines, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func notionPageDoc(ctx context.Context, page notionPage) (schema.Document, error) {
+	lines, err := notionBlocks(ctx, page.ID, 0)
+	if err != nil {
+		return schema.Document{}, err
+	}
+
+	return schema.Document{
+		PageContent: "# " + page.title() + "\n\n" + strings.Join(lines, "\n\n"),
+		Metadata: map[string]any{
+			"source":  page.URL,
+			"title":   page.title(),
+			"updated": page.LastEditedTime,
+		},
+	}, nil
+}
+
+// getDocsFromNotion loads a Notion page, or the first -wiki-pages pages of a database, as one
+// document per page. An ID is tried as a page first, as links don't tell them apart.
+func getDocsFromNotion(ctx context.Context, source string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading Notion", source)
+
+	id, _ := notionID(source)
+
+	var page notionPage
+
+	err := notionDo(ctx, http.MethodGet, "/pages/"+id, nil, &page)
+	if err == nil {
+		doc, err := notionPageDoc(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, "successfully loaded Notion page", page.title())
+		return []schema.Document{doc}, nil
+	}
+	var notFound *notionError
+	if !errors.As(err, &notFound) || notFound.Status != http.StatusNotFound && notFound.Code != "validation_error" {
+		return nil, err
+	}
+
+	var docs []schema.Document
+	cursor := ""
+	for l.WikiPages == 0 || len(docs) < l.WikiPages {
+		query := map[string]any{"page_size": 100}
+		if l.WikiPages > 0 {
+			query["page_size"] = min(100, l.WikiPages-len(docs))
+		}
+		if cursor != "" {
+			query["start_cursor"] = cursor
+		}
+
+		var result struct {
+			Results    []notionPage `json:"results"`
+			HasMore    bool         `json:"has_more"`
+			NextCursor string       `json:"next_cursor"`
+		}
+
+		err = notionDo(ctx, http.MethodPost, "/databases/"+id+"/query", query, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range result.Results {
+			doc, err := notionPageDoc(ctx, page)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, doc)
+		}
+
+		if !result.HasMore {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded", len(docs), "pages of Notion database", source)
+
+	return docs, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const novaSchemaVersion = "messages-v1"
+
+type NovaRequest struct {
+	SchemaVersion   string                  `json:"schemaVersion"`
+	Messages        []ConverseMessage       `json:"messages"`
+	System          []ConverseContent       `json:"system,omitempty"`
+	InferenceConfig ConverseInferenceConfig `json:"inferenceConfig"`
+}
+
+// NovaCodec speaks the Amazon Nova payload, which has the shape of a Converse request and response.
+type NovaCodec struct {
+	ConverseCodec
+}
+
+func (c NovaCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return c.EncodeImageRequest(system, prompt, nil, opts)
+}
+
+func (NovaCodec) EncodeImageRequest(system, prompt string, images []Image, opts *llms.CallOptions) ([]byte, error) {
+	req := NovaRequest{
+		SchemaVersion: novaSchemaVersion,
+		Messages: []ConverseMessage{
+			{Role: "user", Content: converseContent(prompt, images)},
+		},
+		InferenceConfig: ConverseInferenceConfig{
+			MaxTokens:     opts.MaxTokens,
+			Temperature:   opts.Temperature,
+			TopP:          opts.TopP,
+			StopSequences: opts.StopWords,
+		},
+	}
+	if system != "" {
+		req.System = []ConverseContent{{Text: system}}
+	}
+
+	return json.Marshal(req)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"github.com/aws/aws-sdk-go-v2/service/textract/types"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const (
+	// ocrThreshold is the number of characters per page under which a PDF is taken for a scan.
+	ocrThreshold = 20
+	// textractBytesLimit is the largest document DetectDocumentText takes inline.
+	textractBytesLimit = 10 << 20
+	// textractPollInterval is how often the status of a text detection job is checked.
+	textractPollInterval = 5 * time.Second
+)
+
+// textractPages returns the text of each page of the LINE blocks, in order.
+func textractPages(blocks []types.Block) []string {
+	lines := map[int][]string{}
+	for _, block := range blocks {
+		if block.BlockType == types.BlockTypeLine {
+			page := max(int(aws.ToInt32(block.Page)), 1)
+			lines[page] = append(lines[page], aws.ToString(block.Text))
+		}
+	}
+
+	numbers := make([]int, 0, len(lines))
+	for page := range lines {
+		numbers = append(numbers, page)
+	}
+	sort.Ints(numbers)
+
+	pages := make([]string, 0, len(numbers))
+	for _, page := range numbers {
+		pages = append(pages, strings.Join(lines[page], "\n"))
+	}
+
+	return pages
+}
+
+// detectText recognizes the text of an image or a PDF with Amazon Textract. Images and PDFs of a
+// single page are sent inline, other PDFs are uploaded to the -ocr-bucket for a text detection job.
+func detectText(ctx context.Context, data []byte, pages int, l LoaderFlags) ([]string, error) {
+	cfg := loadAWSConfig()
+	client := textract.NewFromConfig(cfg)
+
+	if pages <= 1 && len(data) <= textractBytesLimit {
+		out, err := client.DetectDocumentText(ctx, &textract.DetectDocumentTextInput{Document: &types.Document{Bytes: data}})
+		if err != nil {
+			return nil, err
+		}
+
+		return textractPages(out.Blocks), nil
+	}
+
+	if l.OCRBucket == "" {
+		return nil, errors.New("recognizing the text of a PDF of several pages with Textract needs the s3://bucket/prefix it is uploaded to in -ocr-bucket")
+	}
+
+	uri, remove, err := uploadS3(ctx, cfg, l.OCRBucket, data)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := client.StartDocumentTextDetection(ctx, &textract.StartDocumentTextDetectionInput{
+		DocumentLocation: &types.DocumentLocation{S3Object: &types.S3Object{Bucket: aws.String(bucket), Name: aws.String(key)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(os.Stderr, "waiting for text detection job", aws.ToString(job.JobId))
+
+	var blocks []types.Block
+	var token *string
+	for {
+		out, err := client.GetDocumentTextDetection(ctx, &textract.GetDocumentTextDetectionInput{
+			JobId:      job.JobId,
+			MaxResults: aws.Int32(1000),
+			NextToken:  token,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch out.JobStatus {
+		case types.JobStatusInProgress:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(textractPollInterval):
+			}
+			continue
+		case types.JobStatusFailed:
+			return nil, fmt.Errorf("text detection of %s failed: %s", uri, aws.ToString(out.StatusMessage))
+		}
+
+		blocks = append(blocks, out.Blocks...)
+		if aws.ToString(out.NextToken) == "" {
+			return textractPages(blocks), nil
+		}
+		token = out.NextToken
+	}
+}
+
+// tesseract recognizes the text of an image, or of the pages of a PDF rendered by pdftoppm, with a
+// local Tesseract.
+func tesseract(ctx context.Context, data []byte, pdf bool) ([]string, error) {
+	path, err := exec.LookPath("tesseract")
+	if err != nil {
+		return nil, errors.New("no tesseract found for OCR, install it or use -ocr textract")
+	}
+
+	run := func(image []byte) (string, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, path, "stdin", "stdout")
+		cmd.Stdin = bytes.NewReader(image)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			return "", fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	if !pdf {
+		text, err := run(data)
+		if err != nil {
+			return nil, err
+		}
+		return []string{text}, nil
+	}
+
+	pdftoppm, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil, errors.New("no pdftoppm found to render the pages of the PDF for tesseract, install poppler or use -ocr textract")
+	}
+
+	dir, err := os.MkdirTemp("", "ocr")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, pdftoppm, "-r", "300", "-png", "-", filepath.Join(dir, "page"))
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("pdftoppm: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// The pages are numbered with as many digits as the last one, so they sort in order.
+	images, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(images)
+
+	pages := make([]string, 0, len(images))
+	for _, image := range images {
+		png, err := os.ReadFile(image)
+		if err != nil {
+			return nil, err
+		}
+		text, err := run(png)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, text)
+	}
+
+	return pages, nil
+}
+
+// ocr recognizes the text of a scanned PDF of pages pages, or of an image, with the engine of -ocr:
+// textract, tesseract, or auto for Textract and, when it fails, a local Tesseract if there is one.
+// It returns a document per page.
+func ocr(ctx context.Context, data []byte, pdf bool, pages int, l LoaderFlags) ([]schema.Document, error) {
+	engine := l.OCR
+
+	var texts []string
+	var err error
+	switch engine {
+	case "textract":
+		texts, err = detectText(ctx, data, pages, l)
+	case "tesseract":
+		texts, err = tesseract(ctx, data, pdf)
+	case "", "auto":
+		engine = "textract"
+		texts, err = detectText(ctx, data, pages, l)
+		if _, lookErr := exec.LookPath("tesseract"); err != nil && lookErr == nil {
+			fmt.Fprintln(os.Stderr, "Textract failed, falling back to tesseract:", err)
+			engine = "tesseract"
+			texts, err = tesseract(ctx, data, pdf)
+		}
+	default:
+		return nil, fmt.Errorf("unknown -ocr %q, expected auto, textract, tesseract or off", l.OCR)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]schema.Document, 0, len(texts))
+	for i, text := range texts {
+		metadata := map[string]any{"ocr": engine}
+		if pdf {
+			metadata["page"] = i + 1
+			metadata["total_pages"] = len(texts)
+		}
+		docs = append(docs, schema.Document{PageContent: text, Metadata: metadata})
+	}
+	if textLength(docs) == 0 {
+		return nil, errors.New("no text was recognized")
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type OutputFlags struct {
+	OutputFormat string
+	Output       string
+}
+
+func (f *OutputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.OutputFormat, "output-format", "plain", "format the summary is written in: plain, markdown (with front matter), json or html (a snippet)")
+	fs.StringVar(&f.Output, "output", "", "file the summary is written to instead of stdout")
+}
+
+// Output is a summary with what it was made from, as output writers write it.
+type Output struct {
+	Title   string    `json:"title"`
+	Source  string    `json:"source"`
+	Model   string    `json:"model"`
+	Created time.Time `json:"created"`
+	Summary string    `json:"summary"`
+	// Short is the -char-limit version of Summary, when it had to be shortened.
+	Short string `json:"short,omitempty"`
+	// Thread is the -thread version of Summary.
+	Thread    []string   `json:"thread,omitempty"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// OutputWriter writes an Output in a format.
+type OutputWriter interface {
+	WriteOutput(w io.Writer, out Output) error
+}
+
+func newOutputWriter(format string) (OutputWriter, error) {
+	switch format {
+	case "plain", "text":
+		return PlainWriter{}, nil
+	case "markdown", "md":
+		return MarkdownWriter{}, nil
+	case "json":
+		return JSONWriter{}, nil
+	case "html":
+		return HTMLWriter{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown -output-format %q, expected plain, markdown, json or html", format)
+}
+
+// writeOutput writes out with writer to path, or to stdout when path is empty.
+func writeOutput(path string, writer OutputWriter, out Output) error {
+	if path == "" {
+		return writer.WriteOutput(os.Stdout, out)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteOutput(file, out)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// PlainWriter writes the summary as the terminal shows it.
+type PlainWriter struct{}
+
+func (PlainWriter) WriteOutput(w io.Writer, out Output) error {
+	_, err := fmt.Fprintln(w, out.Summary)
+	if err != nil {
+		return err
+	}
+
+	err = writeCitations(w, out.Citations)
+	if err != nil {
+		return err
+	}
+
+	if out.Short != "" {
+		_, err = fmt.Fprintf(w, "\nshortened to %d characters:\n%s\n", len([]rune(out.Short)), out.Short)
+	}
+	if err == nil && len(out.Thread) > 0 {
+		_, err = fmt.Fprintf(w, "\nthread:\n%s\n", strings.Join(out.Thread, "\n---\n"))
+	}
+
+	return err
+}
+
+// MarkdownWriter writes the summary as a Markdown document whose YAML front matter holds the
+// metadata, ready for a static site generator.
+type MarkdownWriter struct{}
+
+func (MarkdownWriter) WriteOutput(w io.Writer, out Output) error {
+	var b strings.Builder
+
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(out.Title))
+	fmt.Fprintf(&b, "source: %s\n", strconv.Quote(out.Source))
+	fmt.Fprintf(&b, "model: %s\n", strconv.Quote(out.Model))
+	fmt.Fprintf(&b, "date: %s\n", out.Created.Format(time.RFC3339))
+	if out.Short != "" {
+		fmt.Fprintf(&b, "short: %s\n", strconv.Quote(out.Short))
+	}
+	if len(out.Thread) > 0 {
+		b.WriteString("thread:\n")
+		for _, post := range out.Thread {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(post))
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(out.Summary)
+	b.WriteString("\n")
+
+	if len(out.Citations) > 0 {
+		b.WriteString("\n## Sources\n\n")
+		for _, c := range out.Citations {
+			where := c.Source
+			if strings.Contains(c.Source, "://") {
+				where = fmt.Sprintf("<%s>", c.Source)
+			}
+			if c.Heading != "" {
+				where += ", " + c.Heading
+			}
+			fmt.Fprintf(&b, "%d. %s: %s\n", c.Number, where, c.Excerpt)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// JSONWriter writes the Output as a JSON object.
+type JSONWriter struct{}
+
+func (JSONWriter) WriteOutput(w io.Writer, out Output) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(out)
+}
+
+// HTMLWriter writes the summary as an HTML snippet to embed in a page: an article of paragraphs
+// and lists, with the metadata as data attributes and the sources as an ordered list.
+type HTMLWriter struct{}
+
+func (HTMLWriter) WriteOutput(w io.Writer, out Output) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<article class=\"summary\" data-source=\"%s\" data-model=\"%s\" data-date=\"%s\">\n",
+		html.EscapeString(out.Source), html.EscapeString(out.Model), out.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(out.Title))
+
+	for _, paragraph := range strings.Split(strings.TrimSpace(out.Summary), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(paragraph), "\n")
+		if isList(lines) {
+			b.WriteString("<ul>\n")
+			for _, line := range lines {
+				fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•"))))
+			}
+			b.WriteString("</ul>\n")
+			continue
+		}
+		fmt.Fprintf(&b, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(strings.Join(lines, "\n")), "\n", "<br>\n"))
+	}
+
+	if len(out.Thread) > 0 {
+		b.WriteString("<ol class=\"thread\">\n")
+		for _, post := range out.Thread {
+			fmt.Fprintf(&b, "<li>%s</li>\n", strings.ReplaceAll(html.EscapeString(post), "\n", "<br>\n"))
+		}
+		b.WriteString("</ol>\n")
+	}
+
+	if len(out.Citations) > 0 {
+		b.WriteString("<ol class=\"sources\">\n")
+		for _, c := range out.Citations {
+			source := html.EscapeString(c.Source)
+			if strings.HasPrefix(c.Source, "http://") || strings.HasPrefix(c.Source, "https://") {
+				source = fmt.Sprintf("<a href=\"%s\">%s</a>", source, source)
+			}
+			if c.Heading != "" {
+				source += ", " + html.EscapeString(c.Heading)
+			}
+			fmt.Fprintf(&b, "<li value=\"%d\">%s: %s</li>\n", c.Number, source, html.EscapeString(c.Excerpt))
+		}
+		b.WriteString("</ol>\n")
+	}
+	b.WriteString("</article>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// isList reports whether every line is a bullet.
+func isList(lines []string) bool {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "* ") && !strings.HasPrefix(line, "• ") {
+			return false
+		}
+	}
+
+	return len(lines) > 0
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// InferenceOverrides are the inference settings a server request or a batch line may set for
+// itself instead of taking those of the flags, so that one deployment serves several tiers.
+type InferenceOverrides struct {
+	Model       string   `json:"model,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        float64  `json:"top_p,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+}
+
+func (o InferenceOverrides) validate() error {
+	switch {
+	case o.MaxTokens < 0:
+		return fmt.Errorf("max_tokens must not be negative")
+	case o.Temperature != nil && *o.Temperature < 0:
+		return fmt.Errorf("temperature must not be negative")
+	case o.TopP < 0 || o.TopP > 1:
+		return fmt.Errorf("top_p must be between 0 and 1")
+	case o.TopK < 0:
+		return fmt.Errorf("top_k must not be negative")
+	}
+
+	return nil
+}
+
+// apply returns f with the overrides in place of its flags.
+func (o InferenceOverrides) apply(f Flags) Flags {
+	if o.MaxTokens > 0 {
+		f.MaxTokens = o.MaxTokens
+	}
+	if o.Temperature != nil {
+		f.Temperature = *o.Temperature
+	}
+	if o.TopP > 0 {
+		f.TopP = o.TopP
+	}
+	if o.TopK > 0 {
+		f.TopK = o.TopK
+	}
+
+	return f
+}
+
+// parseBatchLine splits a line of a -urls file into its source and overrides. A line is either a
+// source alone or a JSON object of the source as "url" and the InferenceOverrides fields.
+func parseBatchLine(line string) (string, InferenceOverrides, error) {
+	if !strings.HasPrefix(line, "{") {
+		return line, InferenceOverrides{}, nil
+	}
+
+	var item struct {
+		URL string `json:"url"`
+		InferenceOverrides
+	}
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&item)
+	if err != nil {
+		return "", InferenceOverrides{}, fmt.Errorf("batch line %s: %w", line, err)
+	}
+	if item.URL == "" {
+		return "", InferenceOverrides{}, fmt.Errorf("batch line %s has no url", line)
+	}
+
+	return item.URL, item.InferenceOverrides, item.validate()
+}
+
+// ModelSet is the default Model and the others requests and batch lines pick by ID, each built
+// with the options of the default the first time it is picked.
+type ModelSet struct {
+	// Default is read with defaultModel, as the admin endpoints of the server change it.
+	Default *Model
+	// Allowed are the IDs that may be picked besides the default.
+	Allowed []string
+	// AnyModel lets any supported model be picked, as by the lines of a -urls file, which the
+	// operator writes, but not by the requests of clients.
+	AnyModel bool
+
+	build  func(modelID string) (*Model, error)
+	mu     sync.Mutex
+	models map[string]*modelBuild
+	// limits are the rate limits set on the Models while the server runs, nil until then.
+	limits *RateLimitFlags
+}
+
+// modelBuild is a Model of the set, built once however many requests pick it meanwhile.
+type modelBuild struct {
+	done chan struct{}
+	// m is set once done is closed, nil if the build failed.
+	m   *Model
+	err error
+}
+
+func newModelSet(large *Model, allowed []string, build func(modelID string) (*Model, error)) *ModelSet {
+	return &ModelSet{Default: large, Allowed: allowed, build: build, models: map[string]*modelBuild{}}
+}
+
+func (s *ModelSet) defaultModel() *Model {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Default
+}
+
+// get returns the Model of modelID, the default when it is the ID of the default.
+func (s *ModelSet) get(modelID string) (*Model, error) {
+	if s == nil {
+		return nil, fmt.Errorf("model %s can't be picked here", modelID)
+	}
+
+	s.mu.Lock()
+	if modelID == s.Default.modelID {
+		s.mu.Unlock()
+		return s.Default, nil
+	}
+	if !s.AnyModel && !slices.Contains(s.Allowed, modelID) {
+		s.mu.Unlock()
+		if len(s.Allowed) == 0 {
+			return nil, fmt.Errorf("model %s is not allowed, list the models requests may pick with -models", modelID)
+		}
+		return nil, fmt.Errorf("model %s is not allowed, expected one of %s", modelID, strings.Join(append([]string{s.Default.modelID}, s.Allowed...), ", "))
+	}
+	b, ok := s.models[modelID]
+	if ok {
+		s.mu.Unlock()
+		<-b.done
+		return b.m, b.err
+	}
+	b = &modelBuild{done: make(chan struct{})}
+	s.models[modelID] = b
+	s.mu.Unlock()
+
+	// The build may ask Bedrock for the base model, so the other IDs are not held up meanwhile.
+	m, err := s.build(modelID)
+
+	s.mu.Lock()
+	if err != nil {
+		// A failed build is not kept, a later request tries again.
+		delete(s.models, modelID)
+		b.err = fmt.Errorf("model %s: %w", modelID, err)
+	} else {
+		if s.limits != nil {
+			m.setRateLimit(s.limits.RPS, s.limits.TPM)
+		}
+		b.m = m
+	}
+	s.mu.Unlock()
+	close(b.done)
+
+	return b.m, b.err
+}
+
+// setDefault makes the Model of modelID, which get accepts, the default. The requests already
+// answered by the former default keep it, and it stays in the set for its usage.
+func (s *ModelSet) setDefault(modelID string) error {
+	m, err := s.get(modelID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m != s.Default {
+		delete(s.models, modelID)
+		done := make(chan struct{})
+		close(done)
+		s.models[s.Default.modelID] = &modelBuild{done: done, m: s.Default}
+		s.Default = m
+	}
+
+	return nil
+}
+
+func (s *ModelSet) rateLimit() RateLimitFlags {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limits == nil {
+		return RateLimitFlags{}
+	}
+	return *s.limits
+}
+
+// setRateLimit changes the rate limits of every Model of the set, and of those built later.
+func (s *ModelSet) setRateLimit(rps float64, tpm int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits = &RateLimitFlags{RPS: rps, TPM: tpm}
+	s.Default.setRateLimit(rps, tpm)
+	for _, b := range s.models {
+		// A Model still being built gets the limits when its build ends.
+		if b.m != nil {
+			b.m.setRateLimit(rps, tpm)
+		}
+	}
+}
+
+// usageReports are those of the default Model and of every Model picked.
+func (s *ModelSet) usageReports() []UsageReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := s.Default.usageReports()
+
+	ids := make([]string, 0, len(s.models))
+	for id, b := range s.models {
+		if b.m != nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		reports = append(reports, s.models[id].m.usageReports()...)
+	}
+
+	return reports
+}
+
+// modelSetKey carries the ModelSet of a run to the batch items picking their model.
+type modelSetKey struct{}
+
+func withModelSet(ctx context.Context, s *ModelSet) context.Context {
+	return context.WithValue(ctx, modelSetKey{}, s)
+}
+
+func modelSetFrom(ctx context.Context) *ModelSet {
+	s, _ := ctx.Value(modelSetKey{}).(*ModelSet)
+	return s
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+type VectorFlags struct {
+	PGVector      string
+	PGVectorTable string
+	TopChunks     int
+}
+
+func (f *VectorFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.PGVector, "pgvector", "", "postgres:// URL of a PostgreSQL database with pgvector the chunks are embedded into once, to answer -mode qa from the most relevant ones")
+	fs.StringVar(&f.PGVectorTable, "pgvector-table", "bedrock_chunks", "table of the chunks in the -pgvector database, created when missing")
+	fs.IntVar(&f.TopChunks, "top-chunks", 8, "number of chunks retrieved from the -pgvector database or the -knowledge-base to answer a question")
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PGVectorStore keeps the chunks of documents and their embeddings in PostgreSQL, so they are
+// embedded once and found again across runs. Chunks are keyed by their embedding model, source
+// and content, and searched among those of the same embedding model.
+type PGVectorStore struct {
+	conn     *pgx.Conn
+	table    string
+	embedder embeddings.Embedder
+	model    string
+}
+
+var _ vectorstores.VectorStore = &PGVectorStore{}
+
+// newPGVectorStore connects to the database and creates the table of the chunks when missing.
+func newPGVectorStore(ctx context.Context, connString, table string, embedder embeddings.Embedder, model string) (*PGVectorStore, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return nil, err
+	}
+
+	// The table is not a value, so it is the one name quoted in the statements instead of bound.
+	quoted := pgx.Identifier{table}.Sanitize()
+	index := pgx.Identifier{table + "_model_source"}.Sanitize()
+	for _, sql := range []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		`CREATE TABLE IF NOT EXISTS ` + quoted + ` (
+	id text PRIMARY KEY,
+	model text NOT NULL,
+	source text NOT NULL,
+	content text NOT NULL,
+	metadata jsonb NOT NULL,
+	embedding vector NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + quoted + ` (model, source)`,
+	} {
+		_, err = conn.Exec(ctx, sql)
+		if err != nil {
+			conn.Close(ctx)
+			return nil, err
+		}
+	}
+
+	return &PGVectorStore{conn: conn, table: quoted, embedder: embedder, model: model}, nil
+}
+
+func (s *PGVectorStore) Close() error {
+	return s.conn.Close(context.Background())
+}
+
+func (s *PGVectorStore) chunkID(source, content string) string {
+	sum := sha256.Sum256([]byte(s.model + "\x00" + source + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+func docSource(doc schema.Document) string {
+	source, _ := doc.Metadata["source"].(string)
+	return source
+}
+
+// AddDocuments embeds and stores the documents that are not stored yet.
+func (s *PGVectorStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = s.chunkID(docSource(doc), doc.PageContent)
+	}
+
+	rows, err := s.conn.Query(ctx, "SELECT id FROM "+s.table+" WHERE id = ANY($1)", ids)
+	if err != nil {
+		return err
+	}
+	storedIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	stored := map[string]bool{}
+	for _, id := range storedIDs {
+		stored[id] = true
+	}
+
+	var missing []int
+	var texts []string
+	for i, doc := range docs {
+		if !stored[ids[i]] {
+			stored[ids[i]] = true
+			missing = append(missing, i)
+			texts = append(texts, doc.PageContent)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	embedder := s.embedder
+	if opts := vectorstoreOptions(options); opts.Embedder != nil {
+		embedder = opts.Embedder
+	}
+
+	vectors, err := embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	var batch pgx.Batch
+	for j, i := range missing {
+		metadata, err := json.Marshal(docs[i].Metadata)
+		if err != nil {
+			return err
+		}
+		batch.Queue("INSERT INTO "+s.table+" (id, model, source, content, metadata, embedding) VALUES ($1, $2, $3, $4, $5::jsonb, $6::vector) ON CONFLICT (id) DO NOTHING",
+			ids[i], s.model, docSource(docs[i]), docs[i].PageContent, metadata, vectorLiteral(vectors[j]))
+	}
+
+	return s.conn.SendBatch(ctx, &batch).Close()
+}
+
+// SimilaritySearch returns the numDocuments chunks closest to query, with their cosine similarity
+// as the "score" metadata. A filter of []string only searches the chunks of those sources.
+func (s *PGVectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	opts := vectorstoreOptions(options)
+
+	embedder := s.embedder
+	if opts.Embedder != nil {
+		embedder = opts.Embedder
+	}
+
+	vector, err := embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{vectorLiteral(vector), s.model}
+	where := "model = $2"
+	if sources, ok := opts.Filters.([]string); ok && len(sources) > 0 {
+		args = append(args, sources)
+		where += fmt.Sprintf(" AND source = ANY($%d)", len(args))
+	}
+	if opts.ScoreThreshold > 0 {
+		args = append(args, float64(opts.ScoreThreshold))
+		where += fmt.Sprintf(" AND 1 - (embedding <=> $1::vector) >= $%d", len(args))
+	}
+	args = append(args, numDocuments)
+
+	rows, err := s.conn.Query(ctx, fmt.Sprintf("SELECT content, metadata, 1 - (embedding <=> $1::vector) FROM %s WHERE %s ORDER BY embedding <=> $1::vector LIMIT $%d",
+		s.table, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []schema.Document
+	for rows.Next() {
+		var content string
+		var metadata []byte
+		var score float64
+
+		err = rows.Scan(&content, &metadata, &score)
+		if err != nil {
+			return nil, err
+		}
+
+		doc := schema.Document{PageContent: content, Metadata: map[string]any{}}
+
+		err = json.Unmarshal(metadata, &doc.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		// JSON numbers decode as float64, the offsets are put back as the ints the splitter made.
+		for _, key := range []string{"start", "end"} {
+			if n, ok := doc.Metadata[key].(float64); ok {
+				doc.Metadata[key] = int(n)
+			}
+		}
+		doc.Score = float32(score)
+		doc.Metadata["score"] = score
+
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
+
+func vectorstoreOptions(options []vectorstores.Option) vectorstores.Options {
+	var opts vectorstores.Options
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return opts
+}
+
+// vectorLiteral writes a vector the way pgvector reads it, [1,2,3].
+func vectorLiteral(vector []float32) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// retrieveChunks stores the chunks of the document in the -pgvector database, embedding only the
+// new ones, and returns the -top-chunks most relevant to the question, in document order.
+func retrieveChunks(ctx context.Context, docs []schema.Document, question string, f Flags) ([]schema.Document, error) {
+	store, err := newPGVectorStore(ctx, f.PGVector, f.PGVectorTable, newEmbeddings(f.EmbeddingModel), f.EmbeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	err = store.AddDocuments(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a document, the question is asked of every stored one.
+	var sources []string
+	for _, doc := range docs {
+		if source := docSource(doc); !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+
+	var options []vectorstores.Option
+	if len(sources) > 0 {
+		options = append(options, vectorstores.WithFilters(sources))
+	}
+
+	relevant, err := store.SimilaritySearch(ctx, question, f.TopChunks, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(relevant, func(a, b schema.Document) int {
+		if c := strings.Compare(docSource(a), docSource(b)); c != 0 {
+			return c
+		}
+		start := func(d schema.Document) int { n, _ := d.Metadata["start"].(int); return n }
+		return start(a) - start(b)
+	})
+	fmt.Fprintf(os.Stderr, "retrieved %d of the stored chunks\n", len(relevant))
+
+	return relevant, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/comprehend"
+	"github.com/aws/aws-sdk-go-v2/service/comprehend/types"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// comprehendTextLimit is the largest text, in bytes, Comprehend finds the PII of in one call.
+const comprehendTextLimit = 100_000
+
+type PIIFlags struct {
+	PII           string
+	PIIComprehend bool
+}
+
+func (f *PIIFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.PII, "pii", "", "hide the emails, phone numbers and SSNs of the document from the model: redact to replace them with their type, pseudonymize to replace them with placeholders put back in the answer, empty for neither")
+	fs.BoolVar(&f.PIIComprehend, "pii-comprehend", false, "also find names, addresses and the other PII of the English document with Amazon Comprehend")
+}
+
+// redactor returns the PIIRedactor of the flags, or nil when -pii is empty.
+func (f PIIFlags) redactor() (*PIIRedactor, error) {
+	switch f.PII {
+	case "":
+		return nil, nil
+	case "redact", "pseudonymize":
+	default:
+		return nil, fmt.Errorf("unknown -pii %q, expected redact or pseudonymize", f.PII)
+	}
+
+	r := &PIIRedactor{Pseudonymize: f.PII == "pseudonymize", placeholders: map[string]string{}, counts: map[string]int{}}
+	if f.PIIComprehend {
+		cfg := loadAWSConfig()
+		r.comprehend = &cfg
+	}
+
+	return r, nil
+}
+
+// piiPatterns find the PII of their Type. Names need -pii-comprehend.
+var piiPatterns = []struct {
+	Type    string
+	Pattern *regexp.Regexp
+}{
+	{"EMAIL", regexp.MustCompile(emailPattern)},
+	{"SSN", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{"PHONE", regexp.MustCompile(phonePattern)},
+}
+
+// PIIRedactor replaces the PII of documents before they are sent to the model. Pseudonymized PII is
+// replaced with a numbered placeholder per value, such as [EMAIL_1], that restore puts back.
+type PIIRedactor struct {
+	Pseudonymize bool
+	comprehend   *aws.Config
+
+	mu           sync.Mutex
+	placeholders map[string]string
+	counts       map[string]int
+}
+
+// piiSpan is the PII of a type between two byte offsets of a text.
+type piiSpan struct {
+	start, end int
+	kind       string
+}
+
+func (r *PIIRedactor) redactDocs(ctx context.Context, docs []schema.Document) ([]schema.Document, error) {
+	redacted := make([]schema.Document, len(docs))
+	for i, doc := range docs {
+		text, err := r.redact(ctx, doc.PageContent)
+		if err != nil {
+			return nil, err
+		}
+		redacted[i] = doc
+		redacted[i].PageContent = text
+	}
+
+	return redacted, nil
+}
+
+func (r *PIIRedactor) redact(ctx context.Context, text string) (string, error) {
+	var spans []piiSpan
+	for _, p := range piiPatterns {
+		for _, loc := range p.Pattern.FindAllStringIndex(text, -1) {
+			spans = append(spans, piiSpan{loc[0], loc[1], p.Type})
+		}
+	}
+	if r.comprehend != nil {
+		found, err := detectPII(ctx, *r.comprehend, text)
+		if err != nil {
+			return "", err
+		}
+		spans = append(spans, found...)
+	}
+
+	// Of overlapping spans, the first and then the longest is kept.
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span.start < last {
+			continue
+		}
+		b.WriteString(text[last:span.start])
+		b.WriteString(r.placeholder(span.kind, text[span.start:span.end]))
+		last = span.end
+	}
+	b.WriteString(text[last:])
+
+	return b.String(), nil
+}
+
+// placeholder returns what value of type kind is replaced with, the same every time it appears.
+func (r *PIIRedactor) placeholder(kind, value string) string {
+	if !r.Pseudonymize {
+		return "[" + kind + "]"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+	r.counts[kind]++
+	placeholder := fmt.Sprintf("[%s_%d]", kind, r.counts[kind])
+	r.placeholders[value] = placeholder
+
+	return placeholder
+}
+
+// restore puts the pseudonymized values back in place of their placeholders in text.
+func (r *PIIRedactor) restore(text string) string {
+	if r == nil || !r.Pseudonymize {
+		return text
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pairs := make([]string, 0, 2*len(r.placeholders))
+	for value, placeholder := range r.placeholders {
+		pairs = append(pairs, placeholder, value)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// restoreCitations puts the pseudonymized values back in the excerpts of cited.
+func restoreCitations(r *PIIRedactor, cited []Citation) []Citation {
+	for i := range cited {
+		cited[i].Excerpt = r.restore(cited[i].Excerpt)
+	}
+
+	return cited
+}
+
+// detectPII finds the PII of text with Amazon Comprehend, in pieces it accepts.
+func detectPII(ctx context.Context, cfg aws.Config, text string) ([]piiSpan, error) {
+	client := comprehend.NewFromConfig(cfg)
+
+	var spans []piiSpan
+	for offset := 0; offset < len(text); {
+		end := min(offset+comprehendTextLimit, len(text))
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		piece := text[offset:end]
+
+		out, err := client.DetectPiiEntities(ctx, &comprehend.DetectPiiEntitiesInput{Text: aws.String(piece), LanguageCode: types.LanguageCodeEn})
+		if err != nil {
+			return nil, err
+		}
+
+		// Comprehend gives offsets in characters, the spans are in bytes.
+		runeOffsets := make([]int, 0, len(piece)+1)
+		for i := range piece {
+			runeOffsets = append(runeOffsets, i)
+		}
+		runeOffsets = append(runeOffsets, len(piece))
+		for _, e := range out.Entities {
+			first, last := int(aws.ToInt32(e.BeginOffset)), int(aws.ToInt32(e.EndOffset))
+			if first < 0 || last >= len(runeOffsets) || first >= last {
+				continue
+			}
+			spans = append(spans, piiSpan{offset + runeOffsets[first], offset + runeOffsets[last], string(e.Type)})
+		}
+
+		offset = end
+	}
+
+	return spans, nil
+}
+
+// redactorKey carries the PIIRedactor of a run to where the answers are printed.
+type redactorKey struct{}
+
+func withRedactor(ctx context.Context, r *PIIRedactor) context.Context {
+	if r == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, redactorKey{}, r)
+}
+
+func redactorFrom(ctx context.Context) *PIIRedactor {
+	r, _ := ctx.Value(redactorKey{}).(*PIIRedactor)
+	return r
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const avoidInstructionFormat = "\n\nA previous answer could not be published, as it broke the content policy: %s. Write one that follows it."
+
+// policyAttempts is how many times a summary violating the content policy is regenerated.
+const policyAttempts = 2
+
+const moderationTemplate = `You moderate posts before they are published. A post must not contain profanity, slurs, harassment, hate, sexual content, threats, or instructions for violence or crime, even quoted from the article it summarizes.
+
+Post:
+
+%s
+
+%s`
+
+var moderationSchema = &JSONSchema{
+	Type: "object",
+	Properties: map[string]*JSONSchema{
+		"allowed": {Type: "boolean", Description: "whether the post may be published"},
+		"reason":  {Type: "string", Description: "what in the post breaks which rule, empty when it is allowed"},
+	},
+	Required: []string{"allowed", "reason"},
+}
+
+type PolicyFlags struct {
+	Blocklist    string
+	Moderate     bool
+	PolicyAction string
+}
+
+func (f *PolicyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Blocklist, "blocklist", "", "file of words and phrases, one per line, a summary must not contain to be published")
+	fs.BoolVar(&f.Moderate, "moderate", false, "also have -model check each summary against a content policy before it is published")
+	fs.StringVar(&f.PolicyAction, "policy-action", "regenerate", "what is done with a summary breaking the -blocklist or -moderate policy: regenerate it, or reject it; either way it is never published")
+}
+
+// policy returns the ContentPolicy of the flags, moderated by llm, or nil when there is none.
+func (f PolicyFlags) policy(llm llms.LLM) (*ContentPolicy, error) {
+	if f.Blocklist == "" && !f.Moderate {
+		return nil, nil
+	}
+
+	p := &ContentPolicy{checked: map[string]string{}}
+	switch f.PolicyAction {
+	case "regenerate":
+		p.Regenerate = true
+	case "reject":
+	default:
+		return nil, fmt.Errorf("unknown -policy-action %q, expected regenerate or reject", f.PolicyAction)
+	}
+	if f.Moderate {
+		p.Moderator = llm
+	}
+
+	if f.Blocklist != "" {
+		terms, err := loadBlocklist(f.Blocklist)
+		if err != nil {
+			return nil, err
+		}
+		if len(terms) > 0 {
+			p.blocked = regexp.MustCompile(`(?i)\b(?:` + strings.Join(terms, "|") + `)\b`)
+		}
+	}
+
+	return p, nil
+}
+
+// guard keeps the publishers from publishing what breaks policy, when there is one.
+func guard(publishers []Publisher, policy *ContentPolicy) []Publisher {
+	if policy == nil {
+		return publishers
+	}
+
+	guarded := make([]Publisher, len(publishers))
+	for i, p := range publishers {
+		guarded[i] = policyPublisher{Publisher: p, policy: policy}
+	}
+
+	return guarded
+}
+
+// loadBlocklist reads the terms of a blocklist file, quoted for a regexp. Empty lines and lines
+// starting with # are skipped.
+func loadBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, regexp.QuoteMeta(line))
+	}
+
+	return terms, scanner.Err()
+}
+
+// avoidInstruction asks the model not to break the policy again for reason.
+func avoidInstruction(reason string) string {
+	return fmt.Sprintf(avoidInstructionFormat, reason)
+}
+
+// PolicyViolationError is returned for a text breaking the content policy.
+type PolicyViolationError struct {
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return "withheld by the content policy: " + e.Reason
+}
+
+// ContentPolicy checks texts against a blocklist and, when it has a Moderator, a moderation prompt.
+type ContentPolicy struct {
+	Moderator llms.LLM
+	// Regenerate asks for a new summary when one breaks the policy, instead of rejecting it.
+	Regenerate bool
+	blocked    *regexp.Regexp
+
+	mu sync.Mutex
+	// checked are the reasons of the texts already checked, so a text is moderated only once.
+	checked map[string]string
+}
+
+// Check returns why text breaks the policy, or an empty reason when it doesn't.
+func (p *ContentPolicy) Check(ctx context.Context, text string) (string, error) {
+	p.mu.Lock()
+	reason, ok := p.checked[text]
+	p.mu.Unlock()
+	if ok {
+		return reason, nil
+	}
+
+	if p.blocked != nil {
+		if term := p.blocked.FindString(text); term != "" {
+			reason = fmt.Sprintf("contains the blocked term %q", term)
+		}
+	}
+
+	if reason == "" && p.Moderator != nil {
+		parser := JSONParser{Schema: moderationSchema}
+		options := []llms.CallOption{llms.WithMaxTokens(200), llms.WithTemperature(0)}
+
+		answer, err := p.Moderator.Call(ctx, fmt.Sprintf(moderationTemplate, text, parser.GetFormatInstructions()), options...)
+		if err != nil {
+			return "", err
+		}
+		v, err := parser.parseWithRepair(ctx, p.Moderator, answer, options...)
+		if err != nil {
+			return "", fmt.Errorf("moderation: %w", err)
+		}
+		verdict := v.(map[string]any)
+		if allowed, _ := verdict["allowed"].(bool); !allowed {
+			reason, _ = verdict["reason"].(string)
+			if reason == "" {
+				reason = "rejected by moderation"
+			}
+		}
+	}
+
+	p.mu.Lock()
+	p.checked[text] = reason
+	p.mu.Unlock()
+
+	return reason, nil
+}
+
+// enforce returns text when it follows the policy, or there is none. Otherwise, when the policy
+// regenerates, it returns what regenerate writes once told what to avoid, and else a
+// PolicyViolationError.
+func (p *ContentPolicy) enforce(ctx context.Context, text string, regenerate func(avoid string) (string, error)) (string, error) {
+	if p == nil {
+		return text, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		reason, err := p.Check(ctx, text)
+		if err != nil {
+			return "", err
+		}
+		if reason == "" {
+			return text, nil
+		}
+		if !p.Regenerate || attempt == policyAttempts {
+			return "", &PolicyViolationError{Reason: reason}
+		}
+
+		fmt.Fprintln(os.Stderr, "regenerating the summary, it was", (&PolicyViolationError{Reason: reason}).Error())
+		text, err = regenerate(reason)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// policyPublisher refuses to publish posts breaking its policy.
+type policyPublisher struct {
+	Publisher
+	policy *ContentPolicy
+}
+
+func (p policyPublisher) Publish(ctx context.Context, post Post) error {
+	for _, text := range append([]string{post.Text, post.Short}, post.Thread...) {
+		if text == "" {
+			continue
+		}
+		reason, err := p.policy.Check(ctx, text)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return &PolicyViolationError{Reason: reason}
+		}
+	}
+
+	return p.Publisher.Publish(ctx, post)
+}
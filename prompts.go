@@ -0,0 +1,207 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultTemplate = "summary"
+
+//go:embed templates/*.txt
+var templatesFS embed.FS
+
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// templateOverrides are the prompt templates set by the admin endpoints of the server, in place of
+// the embedded templates and the files of the same name.
+var templateOverrides = struct {
+	sync.RWMutex
+	templates map[string]string
+}{templates: map[string]string{}}
+
+// defaultVariables are used for any template variable not given with -var.
+var defaultVariables = map[string]string{
+	"word_limit":    "150",
+	"tone":          "neutral",
+	"hashtag_count": "3",
+	"bullet_count":  "5",
+}
+
+// Style is a prompt profile for a kind of post: a template and the defaults of its variables.
+type Style struct {
+	Template  string
+	Variables map[string]string
+}
+
+// styles are the profiles of -style by name.
+var styles = map[string]Style{
+	"twitter": {Template: "summary"},
+	"linkedin": {Template: "linkedin", Variables: map[string]string{
+		"word_limit":    "250",
+		"tone":          "professional",
+		"hashtag_count": "5",
+	}},
+}
+
+func styleNames() []string {
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Variables collects repeated -var name=value flags.
+type Variables map[string]string
+
+func (v Variables) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (v Variables) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v[name] = value
+
+	return nil
+}
+
+type PromptFlags struct {
+	Prompt    string
+	Template  string
+	Variables Variables
+	Lang      string
+	Style     string
+}
+
+func (f *PromptFlags) register(fs *flag.FlagSet) {
+	f.Variables = Variables{}
+	fs.StringVar(&f.Prompt, "prompt", "", "question asked about the article, overrides -template")
+	fs.StringVar(&f.Template, "template", defaultTemplate, "name of a built-in prompt template (summary, tldr, bullets, linkedin, dataset) or path of a template file")
+	fs.Var(f.Variables, "var", "template variable as name=value, may be repeated")
+	fs.StringVar(&f.Style, "style", "", "kind of post written, overriding -template: "+strings.Join(styleNames(), ", ")+", whose variables -var still sets")
+	fs.StringVar(&f.Lang, "lang", "auto", "language of the summary and hashtags, as an ISO 639-1 code or a name, auto for the language of the document")
+}
+
+// question returns the prompt given with -prompt or, failing that, the rendered template.
+func (f PromptFlags) question() (string, error) {
+	if f.Prompt != "" {
+		return f.Prompt, nil
+	}
+
+	name, variables, err := f.template()
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := readTemplate(name)
+	if err != nil {
+		return "", err
+	}
+
+	return fillTemplate(name, tmpl, variables)
+}
+
+// template returns the template and the variables of the -style, or else -template and -var.
+func (f PromptFlags) template() (string, map[string]string, error) {
+	if f.Style == "" {
+		return f.Template, f.Variables, nil
+	}
+
+	style, ok := styles[f.Style]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown -style %q, expected %s", f.Style, strings.Join(styleNames(), ", "))
+	}
+
+	variables := map[string]string{}
+	for name, value := range style.Variables {
+		variables[name] = value
+	}
+	for name, value := range f.Variables {
+		variables[name] = value
+	}
+
+	return style.Template, variables, nil
+}
+
+// loadTemplate returns the template set by the admin endpoints or the embedded one of that name.
+// The requests of the server and of Lambda only get these, so their clients can't read the files
+// of the host.
+func loadTemplate(name string) (string, error) {
+	templateOverrides.RLock()
+	tmpl, ok := templateOverrides.templates[name]
+	templateOverrides.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	data, err := templatesFS.ReadFile("templates/" + name + ".txt")
+	if err != nil {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readTemplate is loadTemplate falling back to the file at path name, for the -template of the
+// command line.
+func readTemplate(name string) (string, error) {
+	tmpl, err := loadTemplate(name)
+	if err == nil {
+		return tmpl, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("unknown prompt template %q", name)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// renderTemplate fills the template loadTemplate returns, for the requests of the server.
+func renderTemplate(name string, variables map[string]string) (string, error) {
+	tmpl, err := loadTemplate(name)
+	if err != nil {
+		return "", err
+	}
+
+	return fillTemplate(name, tmpl, variables)
+}
+
+// fillTemplate replaces the placeholders of tmpl, the template called name, with the variables.
+func fillTemplate(name, tmpl string, variables map[string]string) (string, error) {
+	var missing []string
+
+	out := placeholderPattern.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		key := placeholder[1 : len(placeholder)-1]
+		if value, ok := variables[key]; ok {
+			return value
+		}
+		if value, ok := defaultVariables[key]; ok {
+			return value
+		}
+		missing = append(missing, key)
+		return placeholder
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("prompt template %q is missing variables %s", name, strings.Join(missing, ", "))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	err := os.WriteFile(path, []byte("Summarize in {word_limit} words."), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server only renders the embedded templates and those the admin endpoints set.
+	_, err = renderTemplate(path, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown prompt template") {
+		t.Fatalf("got error %v rendering a file for the server, want an unknown template", err)
+	}
+	_, err = templateHashtagCount(path, nil)
+	if err == nil {
+		t.Fatal("counted the hashtags of a file for the server, want an error")
+	}
+	_, err = renderTemplate(defaultTemplate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The command line reads the -template file.
+	question, err := PromptFlags{Template: path}.question()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if question != "Summarize in 150 words." {
+		t.Errorf("got question %q, want the rendered file", question)
+	}
+}
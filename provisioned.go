@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+)
+
+// WithBaseModel names the foundation model behind a provisioned throughput or custom model ARN,
+// which decides the payload format, context window and price.
+func WithBaseModel(modelID string) ModelOption {
+	return func(m *Model) {
+		m.baseModel = modelID
+	}
+}
+
+// isProvisioned reports whether modelID is the ARN of a provisioned throughput, which is billed
+// by the hour rather than by the token.
+func isProvisioned(modelID string) bool {
+	return strings.HasPrefix(modelID, "arn:") && strings.Contains(modelID, ":provisioned-model/")
+}
+
+// arnRegion returns the region of a model ARN, which it must be invoked in, or "" for a model ID.
+func arnRegion(modelID string) string {
+	parts := strings.SplitN(modelID, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+
+	return parts[3]
+}
+
+// baseModelUnknown reports whether the foundation model of modelID cannot be told from it, and is
+// asked to Bedrock by lookupBaseModel.
+func baseModelUnknown(modelID string) bool {
+	return isProvisioned(modelID) || isApplicationProfile(modelID) || isPromptRouter(modelID)
+}
+
+// lookupBaseModel asks Bedrock which foundation model a provisioned throughput, application
+// inference profile or prompt router serves.
+func lookupBaseModel(ctx context.Context, provisionedARN string) (string, error) {
+	switch {
+	case isApplicationProfile(provisionedARN):
+		return lookupProfileModel(ctx, provisionedARN)
+	case isPromptRouter(provisionedARN):
+		return lookupRouterModel(ctx, provisionedARN)
+	}
+
+	cfg := loadAWSConfig()
+	if region := arnRegion(provisionedARN); region != "" {
+		cfg.Region = region
+	}
+
+	throughput, err := bedrock.NewFromConfig(cfg).GetProvisionedModelThroughput(ctx, &bedrock.GetProvisionedModelThroughputInput{
+		ProvisionedModelId: aws.String(provisionedARN),
+	})
+	if err != nil {
+		return "", err
+	}
+	if aws.ToString(throughput.FoundationModelArn) == "" {
+		return "", fmt.Errorf("%s has no foundation model", provisionedARN)
+	}
+
+	return baseModelID(aws.ToString(throughput.FoundationModelArn)), nil
+}
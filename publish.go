@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// discordLimit is the longest message a Discord webhook accepts.
+const discordLimit = 2000
+
+// Post is a summary ready to be published.
+type Post struct {
+	// Title names what was summarized, it is the subject of emails.
+	Title string
+	// Link is the summarized source.
+	Link string
+	Text string
+	// Short is the -char-limit version of Text, if one was made.
+	Short string
+	// Thread is the -thread version of Text, posted to X instead of Short when it was made.
+	Thread []string
+}
+
+func (p Post) short() string {
+	if p.Short != "" {
+		return p.Short
+	}
+
+	return p.Text
+}
+
+// Publisher delivers a Post to a channel.
+type Publisher interface {
+	Publish(ctx context.Context, post Post) error
+}
+
+// newPublishers returns the publishers named in a comma separated list, configured from the environment.
+func newPublishers(names string, dryRun bool) ([]Publisher, error) {
+	var publishers []Publisher
+
+	for _, name := range strings.Split(names, ",") {
+		var p Publisher
+
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "x":
+			p = newXPublisher()
+		case "slack":
+			p = &SlackPublisher{WebhookURL: os.Getenv("SLACK_WEBHOOK_URL")}
+		case "discord":
+			p = &DiscordPublisher{WebhookURL: os.Getenv("DISCORD_WEBHOOK_URL")}
+		case "email":
+			p = newEmailPublisher()
+		default:
+			return nil, fmt.Errorf("unknown publisher %q", name)
+		}
+
+		if dryRun {
+			p = dryRunPublisher{name: strings.TrimSpace(name)}
+		}
+		publishers = append(publishers, p)
+	}
+
+	return publishers, nil
+}
+
+// publishResults publishes the summaries of a batch, keeping any error in the result it belongs to.
+// The sources the Checkpoints of ctx have published already are not published again.
+func publishResults(ctx context.Context, publishers []Publisher, results []BatchResult) {
+	checkpoints := checkpointsFrom(ctx)
+	for i, result := range results {
+		if result.Summary == "" {
+			continue
+		}
+		if checkpoint, ok := checkpoints.get(result.URL); ok && checkpoint.reached("published") {
+			continue
+		}
+
+		err := publish(ctx, publishers, Post{Title: result.Title, Link: result.URL, Text: result.Summary, Short: result.Short})
+		if err != nil {
+			results[i].Error = strings.TrimPrefix(result.Error+"; ", "; ") + err.Error()
+		} else if len(publishers) > 0 {
+			checkpoints.mark(ctx, result.URL, "published", 0, nil)
+		}
+	}
+}
+
+// publish sends post to every publisher, returning all their errors.
+func publish(ctx context.Context, publishers []Publisher, post Post) error {
+	var errs []error
+	for _, p := range publishers {
+		errs = append(errs, p.Publish(ctx, post))
+	}
+
+	return errors.Join(errs...)
+}
+
+type dryRunPublisher struct {
+	name string
+}
+
+func (p dryRunPublisher) Publish(ctx context.Context, post Post) error {
+	text := post.Text
+	if p.name == "x" {
+		texts, err := xPosts(post)
+		if err != nil {
+			return err
+		}
+		text = strings.Join(texts, "\n---\n")
+	}
+
+	fmt.Printf("dry run, would publish to %s:\n%s\n", p.name, text)
+
+	return nil
+}
+
+// postJSON sends v to a webhook, failing on any status but 2xx.
+func postJSON(ctx context.Context, link string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, link, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+func withLink(post Post) string {
+	if post.Link == "" {
+		return post.Text
+	}
+
+	return post.Text + "\n\n" + post.Link
+}
+
+// SlackPublisher posts to a channel through an incoming webhook.
+type SlackPublisher struct {
+	WebhookURL string
+}
+
+func (p *SlackPublisher) Publish(ctx context.Context, post Post) error {
+	if p.WebhookURL == "" {
+		return errors.New("SLACK_WEBHOOK_URL is not set")
+	}
+
+	return postJSON(ctx, p.WebhookURL, map[string]string{"text": withLink(post)})
+}
+
+// DiscordPublisher posts to a channel through a webhook.
+type DiscordPublisher struct {
+	WebhookURL string
+}
+
+func (p *DiscordPublisher) Publish(ctx context.Context, post Post) error {
+	if p.WebhookURL == "" {
+		return errors.New("DISCORD_WEBHOOK_URL is not set")
+	}
+
+	content := withLink(post)
+	if utf8.RuneCountInString(content) > discordLimit {
+		content = string([]rune(content)[:discordLimit-1]) + "…"
+	}
+
+	return postJSON(ctx, p.WebhookURL, map[string]string{"content": content})
+}
+
+// EmailPublisher mails posts through an SMTP server when SMTP_HOST is set, and through Amazon SES otherwise.
+type EmailPublisher struct {
+	From     string
+	To       []string
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+func newEmailPublisher() *EmailPublisher {
+	p := &EmailPublisher{
+		From:     os.Getenv("EMAIL_FROM"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+	if to := os.Getenv("EMAIL_TO"); to != "" {
+		p.To = strings.Split(to, ",")
+	}
+	if p.Port == "" {
+		p.Port = "587"
+	}
+
+	return p
+}
+
+func (p *EmailPublisher) Publish(ctx context.Context, post Post) error {
+	if p.From == "" || len(p.To) == 0 {
+		return errors.New("EMAIL_FROM and EMAIL_TO must be set")
+	}
+
+	subject := post.Title
+	if subject == "" {
+		subject = "Summary"
+	}
+
+	if p.Host == "" {
+		return p.sendSES(ctx, subject, withLink(post))
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		p.From, strings.Join(p.To, ", "), subject, strings.ReplaceAll(withLink(post), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if p.Username != "" {
+		auth = smtp.PlainAuth("", p.Username, p.Password, p.Host)
+	}
+
+	return smtp.SendMail(p.Host+":"+p.Port, auth, p.From, p.To, msg.Bytes())
+}
+
+// sendSES sends the email with the SES v2 SendEmail API.
+func (p *EmailPublisher) sendSES(ctx context.Context, subject, text string) error {
+	_, err := sesv2.NewFromConfig(loadAWSConfig()).SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(p.From),
+		Destination:      &types.Destination{ToAddresses: p.To},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(subject), Charset: aws.String("UTF-8")},
+				Body:    &types.Body{Text: &types.Content{Data: aws.String(text), Charset: aws.String("UTF-8")}},
+			},
+		},
+	})
+	return err
+}
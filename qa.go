@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/prompts"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// noAnswer is the reply asked for when the documents don't answer the question.
+const noAnswer = "I don't know."
+
+const qaTemplate = `Answer the question using only the numbered sources below. After each statement, cite the sources it comes from as [1], [2] and so on. If the sources don't contain the answer, reply exactly "` + noAnswer + `" and nothing else.
+
+Sources:
+
+{{.context}}
+
+Question: {{.question}}
+
+Answer:`
+
+// Answer is the reply to a question about the documents.
+type Answer struct {
+	Question string `json:"question"`
+	Text     string `json:"answer"`
+	// Known is false when the documents don't answer the question.
+	Known     bool       `json:"known"`
+	Citations []Citation `json:"citations"`
+	// Web is true when the answer was looked up with -web-search, the documents not answering.
+	Web bool `json:"web,omitempty"`
+}
+
+// answerQuestion answers question from docs only, citing the chunks the answer comes from.
+func answerQuestion(ctx context.Context, large *Model, docs []schema.Document, question, source string, options ...chains.ChainCallOption) (Answer, error) {
+	chain := chains.NewStuffDocuments(chains.NewLLMChain(large, prompts.NewPromptTemplate(qaTemplate, []string{"context", "question"})))
+
+	result, err := chains.Call(ctx, chain, map[string]any{
+		"input_documents": numberDocs(docs),
+		"question":        question,
+	}, options...)
+	if err != nil {
+		return Answer{}, err
+	}
+
+	text := strings.TrimSpace(result["text"].(string))
+	answer := Answer{Question: question, Text: text, Known: !strings.HasPrefix(text, strings.TrimSuffix(noAnswer, "."))}
+	if answer.Known {
+		answer.Citations = citations(text, docs, source)
+	} else {
+		answer.Citations = []Citation{}
+	}
+
+	return answer, nil
+}
+
+// runQA answers -question about the documents, as text or, with -json, as an Answer.
+func runQA(ctx context.Context, large *Model, docs []schema.Document, f Flags) {
+	if f.Question == "" {
+		log.Fatal("-mode qa needs a -question")
+	}
+
+	var search tools.Tool
+	if f.WebSearch != "" {
+		var err error
+		search, err = newSearchTool(f.WebSearch, f.WebSearchResults)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	answer, err := answerQuestion(ctx, large, docs, f.Question, f.URL, chains.WithMaxTokens(f.MaxTokens), chains.WithTemperature(f.Temperature))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A page may be too old or too narrow for the question, which is then looked up on the web.
+	if !answer.Known && search != nil {
+		fmt.Fprintln(os.Stderr, "the document doesn't answer the question, searching with", search.Name())
+
+		text, err := searchWeb(ctx, large, search, f.Question, f.MaxTokens, f.Temperature)
+		if err != nil {
+			log.Fatal(err)
+		}
+		answer = Answer{Question: f.Question, Text: text, Known: text != "", Citations: []Citation{}, Web: true}
+	}
+
+	redactor := redactorFrom(ctx)
+	answer.Text = redactor.restore(answer.Text)
+	answer.Citations = restoreCitations(redactor, answer.Citations)
+
+	if f.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(answer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Println(answer.Text)
+	printCitations(answer.Citations)
+}
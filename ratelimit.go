@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+)
+
+type RateLimitFlags struct {
+	RPS float64
+	TPM int
+}
+
+func (f *RateLimitFlags) register(fs *flag.FlagSet) {
+	fs.Float64Var(&f.RPS, "rps", 0, "maximum Bedrock requests per second of each model, across all concurrent calls, 0 for no limit")
+	fs.IntVar(&f.TPM, "tpm", 0, "maximum input and output tokens per minute of each model, across all concurrent calls, 0 for no limit")
+}
+
+// bucket is a token bucket filling at rate per second up to burst. Its level goes below zero
+// when more is taken than it holds, which the caller waits out.
+type bucket struct {
+	rate  float64
+	burst float64
+	level float64
+	last  time.Time
+}
+
+// take removes n from the bucket and returns how long until its level is back to zero.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.level = min(b.burst, b.level+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.level -= n
+
+	if b.level >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.level / b.rate * float64(time.Second))
+}
+
+// RateLimiter keeps the calls of a Model under the requests per second and tokens per minute
+// quotas of the account, however many goroutines call it.
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests bucket
+	tokens   bucket
+}
+
+func newRateLimiter(rps float64, tpm int) *RateLimiter {
+	now := time.Now()
+
+	return &RateLimiter{
+		requests: bucket{rate: rps, burst: max(rps, 1), level: max(rps, 1), last: now},
+		tokens:   bucket{rate: float64(tpm) / 60, burst: float64(tpm), level: float64(tpm), last: now},
+	}
+}
+
+// WithRateLimit limits the Model to rps requests per second and tpm tokens per minute, 0 for no
+// limit, which setRateLimit changes later on. Each Model, fallbacks included, has its own limits as
+// Bedrock quotas are per model.
+func WithRateLimit(rps float64, tpm int) ModelOption {
+	return func(m *Model) {
+		m.limiter = newRateLimiter(rps, tpm)
+	}
+}
+
+// setRateLimit changes the limits of the Model, its routed model and its fallbacks, when they were
+// created WithRateLimit.
+func (m *Model) setRateLimit(rps float64, tpm int) {
+	for _, model := range append([]*Model{m, m.router}, m.fallbacks...) {
+		if model != nil && model.limiter != nil {
+			model.limiter.set(rps, tpm)
+		}
+	}
+}
+
+// set changes the rates of the limiter. A quota that had no limit starts full.
+func (l *RateLimiter) set(rps float64, tpm int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.requests.rate <= 0 {
+		l.requests.level, l.requests.last = max(rps, 1), now
+	}
+	if l.tokens.rate <= 0 {
+		l.tokens.level, l.tokens.last = float64(tpm), now
+	}
+	l.requests.rate, l.requests.burst = rps, max(rps, 1)
+	l.tokens.rate, l.tokens.burst = float64(tpm)/60, float64(tpm)
+}
+
+// Wait blocks until a request of tokens tokens fits in the quotas, and takes them.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	l.mu.Lock()
+	now := time.Now()
+	wait := max(l.requests.take(now, 1), l.tokens.take(now, float64(tokens)))
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// The request is not sent, so it gives back what it took.
+		l.mu.Lock()
+		l.requests.level++
+		l.tokens.level += float64(tokens)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Settle corrects the tokens taken by Wait, an estimate, with those the request actually used.
+func (l *RateLimiter) Settle(estimated, used int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens.rate > 0 {
+		l.tokens.level = min(l.tokens.burst, l.tokens.level+float64(estimated-used))
+	}
+}
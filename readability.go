@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const boilerplateSelector = "script, style, noscript, iframe, svg, form, nav, header, footer, aside, button"
+
+var boilerplatePattern = regexp.MustCompile(`(?i)cookie|consent|banner|navbar|menu|footer|sidebar|subscribe|newsletter|promo|advert|share|social|related|comment`)
+
+// extractArticle returns the main text of an HTML page, leaving out navigation, footers, cookie banners and the like.
+func extractArticle(r io.Reader) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return "", err
+	}
+
+	doc.Find(boilerplateSelector).Remove()
+	doc.Find("[class], [id], [role]").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "article" || goquery.NodeName(s) == "main" {
+			return
+		}
+		attrs := s.AttrOr("class", "") + " " + s.AttrOr("id", "") + " " + s.AttrOr("role", "")
+		if boilerplatePattern.MatchString(attrs) {
+			s.Remove()
+		}
+	})
+
+	content := doc.Find("article").First()
+	if content.Length() == 0 {
+		content = doc.Find("main, [role=main]").First()
+	}
+	if content.Length() == 0 {
+		content = densestBlock(doc)
+	}
+
+	return collapseWhitespace(content), nil
+}
+
+// densestBlock picks the element whose direct paragraphs hold the most text.
+func densestBlock(doc *goquery.Document) *goquery.Selection {
+	best := doc.Find("body")
+	bestScore := 0
+
+	doc.Find("p").Each(func(_ int, p *goquery.Selection) {
+		parent := p.Parent()
+		score := 0
+		parent.ChildrenFiltered("p").Each(func(_ int, sibling *goquery.Selection) {
+			score += len(strings.TrimSpace(sibling.Text()))
+		})
+		if score > bestScore {
+			best, bestScore = parent, score
+		}
+	})
+
+	return best
+}
+
+func collapseWhitespace(s *goquery.Selection) string {
+	var blocks []string
+
+	s.Find("h1, h2, h3, h4, h5, h6, p, li, pre, blockquote").Each(func(_ int, block *goquery.Selection) {
+		if block.ParentsFiltered("li, blockquote").Length() > 0 {
+			return
+		}
+		text := strings.Join(strings.Fields(block.Text()), " ")
+		if text == "" {
+			return
+		}
+		// Headings are kept as markdown so the chunks split from the text can name their section.
+		if name := goquery.NodeName(block); len(name) == 2 && name[0] == 'h' {
+			text = strings.Repeat("#", int(name[1]-'0')) + " " + text
+		}
+		blocks = append(blocks, text)
+	})
+
+	if len(blocks) == 0 {
+		return strings.Join(strings.Fields(s.Text()), " ")
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
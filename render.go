@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// renderThreshold is the length of text under which -render auto takes a page for the empty shell
+// of a page rendered by JavaScript.
+const renderThreshold = 500
+
+// browsers are the names a headless Chrome or Chromium is looked up with, when -browser is not given.
+var browsers = []string{
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"chrome",
+	"headless_shell",
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	"/Applications/Chromium.app/Contents/MacOS/Chromium",
+}
+
+func findBrowser(browser string) (string, error) {
+	if browser != "" {
+		return exec.LookPath(browser)
+	}
+
+	for _, name := range browsers {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("no Chrome or Chromium found to render the page, install one or give its path with -browser")
+}
+
+// renderPage runs the page of link in a headless browser and returns its DOM once the scripts
+// have run. The -header, -cookie and credentials flags are not sent by the browser.
+func renderPage(ctx context.Context, link string, browser string) ([]byte, error) {
+	path, err := findBrowser(browser)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetchFlags.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetchFlags.FetchTimeout)
+		defer cancel()
+	}
+
+	args := []string{
+		"--headless=new",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--user-agent=" + fetchFlags.UserAgent,
+		// Lets the scripts of the page run for up to 10s of page time before the DOM is dumped.
+		"--virtual-time-budget=10000",
+		"--dump-dom",
+	}
+	if transportFlags.Proxy != "" {
+		args = append(args, "--proxy-server="+transportFlags.Proxy)
+	}
+	// Chrome refuses to run as root with its sandbox, as in most containers.
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, link)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+
+	dom, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("rendering %s: %w", link, ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s: %w: %s", link, err, strings.TrimSpace(stderr.String()))
+	}
+	if fetchFlags.MaxBodySize > 0 && int64(len(dom)) > fetchFlags.MaxBodySize {
+		return nil, fmt.Errorf("rendering %s: %w", link, errBodyTooLarge{fetchFlags.MaxBodySize})
+	}
+
+	return dom, nil
+}
+
+// getRenderedDocs loads the page of link as a headless browser renders it.
+func getRenderedDocs(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "rendering", link)
+
+	dom, err := renderPage(ctx, link, l.Browser)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadDocs(ctx, bytes.NewReader(dom), "html", l)
+}
+
+// textLength is the length of the text of docs, without surrounding spaces.
+func textLength(docs []schema.Document) int {
+	n := 0
+	for _, doc := range docs {
+		n += len(strings.TrimSpace(doc.PageContent))
+	}
+
+	return n
+}
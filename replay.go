@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Cassette holds the responses recorded in an -audit log, which the Models created WithReplay
+// answer with instead of invoking Bedrock, so that a pipeline runs again offline and gives the
+// same results.
+type Cassette struct {
+	path string
+	// redact makes the prompts look like the recorded ones, redacted by -audit-redact.
+	redact Auditor
+
+	mu sync.Mutex
+	// Each key holds the responses to a prompt in the order they were recorded. They are replayed
+	// in that order, the last one answering again once the others are used up.
+	byModel  map[string][]AuditRecord
+	byPrompt map[string][]AuditRecord
+}
+
+// loadCassette reads the successful invocations of the audit log at path.
+func loadCassette(path string, redactors []Redactor) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c := &Cassette{
+		path:     path,
+		redact:   Auditor{Redactors: redactors},
+		byModel:  map[string][]AuditRecord{},
+		byPrompt: map[string][]AuditRecord{},
+	}
+
+	dec := json.NewDecoder(file)
+	for {
+		var record AuditRecord
+
+		err = dec.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if record.Error != "" {
+			continue
+		}
+
+		modelKey := record.ModelID + "\x00" + record.System + "\x00" + record.Prompt
+		c.byModel[modelKey] = append(c.byModel[modelKey], record)
+		promptKey := record.System + "\x00" + record.Prompt
+		c.byPrompt[promptKey] = append(c.byPrompt[promptKey], record)
+	}
+
+	return c, nil
+}
+
+// response returns the next recorded response of modelID to the system prompt and prompt, or
+// that of another model to them when modelID never answered them.
+func (c *Cassette) response(modelID, system, prompt string) (Response, error) {
+	system, prompt = c.redact.redact(system), c.redact.redact(prompt)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records, key := c.byModel, modelID+"\x00"+system+"\x00"+prompt
+	if len(records[key]) == 0 {
+		records, key = c.byPrompt, system+"\x00"+prompt
+	}
+	if len(records[key]) == 0 {
+		return Response{}, fmt.Errorf("%s: no response to the prompt is recorded in %s, record one with -audit and the same -audit-redact", modelID, c.path)
+	}
+
+	record := records[key][0]
+	if len(records[key]) > 1 {
+		records[key] = records[key][1:]
+	}
+
+	return Response{
+		Completion: record.Response,
+		StopReason: record.StopReason,
+		Usage:      Usage{InputTokens: record.InputTokens, OutputTokens: record.OutputTokens},
+	}, nil
+}
+
+// WithReplay makes the Model answer with the responses of cassette instead of invoking Bedrock.
+func WithReplay(cassette *Cassette) ModelOption {
+	return func(m *Model) {
+		m.replay = cassette
+	}
+}
+
+// replayResponse answers prompt from the cassette of the Model, streaming the whole completion as
+// a single chunk.
+func (m *Model) replayResponse(ctx context.Context, prompt string, opts *llms.CallOptions) (*llms.Generation, error) {
+	resp, err := m.replay.response(m.modelID, m.system, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.StreamingFunc != nil && resp.Completion != "" {
+		err = opts.StreamingFunc(ctx, []byte(resp.Completion))
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.usage.add(resp.Usage)
+
+	return resp.generation(), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cassetteLog = `{"id":"1","model_id":"anthropic.claude-v2","system":"Be brief.","prompt":"Summarize A.","response":"A, first.","stop_reason":"stop_sequence","input_tokens":10,"output_tokens":2}
+{"id":"2","model_id":"anthropic.claude-v2","system":"Be brief.","prompt":"Summarize A.","response":"A, second.","input_tokens":10,"output_tokens":3}
+{"id":"3","model_id":"amazon.titan-text-express-v1","prompt":"Summarize B.","response":"B by Titan."}
+{"id":"4","model_id":"anthropic.claude-v2","prompt":"Summarize C.","error":"throttled by Bedrock"}
+{"id":"5","model_id":"anthropic.claude-v2","prompt":"Call [EMAIL] back.","response":"Done."}
+`
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	err := os.WriteFile(path, []byte(cassetteLog), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCassette(path, []Redactor{patternRedactor(`[\w.]+@[\w.]+`, "[EMAIL]")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The calls are made in order, against the same cassette.
+	calls := []struct {
+		name    string
+		modelID string
+		system  string
+		prompt  string
+		want    Response
+		// err is a part of the error message, empty when a response is replayed.
+		err string
+	}{
+		{
+			name:    "first recording",
+			modelID: "anthropic.claude-v2", system: "Be brief.", prompt: "Summarize A.",
+			want: Response{Completion: "A, first.", StopReason: "stop_sequence", Usage: Usage{InputTokens: 10, OutputTokens: 2}},
+		},
+		{
+			name:    "second recording",
+			modelID: "anthropic.claude-v2", system: "Be brief.", prompt: "Summarize A.",
+			want: Response{Completion: "A, second.", Usage: Usage{InputTokens: 10, OutputTokens: 3}},
+		},
+		{
+			name:    "last recording again",
+			modelID: "anthropic.claude-v2", system: "Be brief.", prompt: "Summarize A.",
+			want: Response{Completion: "A, second.", Usage: Usage{InputTokens: 10, OutputTokens: 3}},
+		},
+		{
+			name:    "another model",
+			modelID: "anthropic.claude-v2", prompt: "Summarize B.",
+			want: Response{Completion: "B by Titan."},
+		},
+		{
+			name:    "redacted prompt",
+			modelID: "anthropic.claude-v2", prompt: "Call jane@example.com back.",
+			want: Response{Completion: "Done."},
+		},
+		{
+			name:    "failed recording",
+			modelID: "anthropic.claude-v2", prompt: "Summarize C.",
+			err: "no response to the prompt is recorded",
+		},
+		{
+			name:    "other system prompt",
+			modelID: "anthropic.claude-v2", system: "Be thorough.", prompt: "Summarize A.",
+			err: "no response to the prompt is recorded",
+		},
+	}
+
+	for _, call := range calls {
+		resp, err := c.response(call.modelID, call.system, call.prompt)
+		if call.err != "" {
+			if err == nil || !strings.Contains(err.Error(), call.err) {
+				t.Fatalf("%s: got error %v, want one with %q", call.name, err, call.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", call.name, err)
+		}
+		if resp.Completion != call.want.Completion || resp.StopReason != call.want.StopReason || resp.Usage != call.want.Usage {
+			t.Errorf("%s: got %+v, want %+v", call.name, resp, call.want)
+		}
+	}
+}
+
+func TestLoadCassetteErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	err := os.WriteFile(path, []byte(`{"id":"1","prompt":`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loadCassette(path, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("got %v, want an error of %s", err, path)
+	}
+
+	_, err = loadCassette(filepath.Join(t.TempDir(), "missing.jsonl"), nil)
+	if !os.IsNotExist(err) {
+		t.Errorf("got %v, want a missing file", err)
+	}
+}
+
+func TestWithReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	err := os.WriteFile(path, []byte(cassetteLog), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := loadCassette(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &FakeInvoker{}
+	m, err := buildLargeLanguageModel("amazon.titan-text-express-v1", WithInvoker(fake), WithReplay(cassette))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion, err := m.Call(context.Background(), "Summarize B.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion != "B by Titan." {
+		t.Errorf("got %q, want the recorded response", completion)
+	}
+	if len(fake.Requests) != 0 {
+		t.Errorf("Bedrock was called %d times while replaying", len(fake.Requests))
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+)
+
+type RouterFlags struct {
+	Route       string
+	RouteTokens int
+}
+
+func (f *RouterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Route, "route", "", "stronger Bedrock model the prompts over -route-tokens tokens, or that ask for reasoning, are sent to, -model answering the short and simple ones")
+	fs.IntVar(&f.RouteTokens, "route-tokens", 2000, "prompt tokens above which -route answers instead of -model")
+}
+
+// WithRouter sends the prompts of more than maxTokens tokens, or that look complex, to the model
+// strongID, created with the other options of the Model, which answers the others itself. An empty
+// strongID routes nothing.
+func WithRouter(strongID string, maxTokens int) ModelOption {
+	return func(m *Model) {
+		m.routeID = strongID
+		m.routeTokens = maxTokens
+	}
+}
+
+// complexMarkers are phrases of the prompts a small model tends to answer poorly.
+var complexMarkers = []string{
+	"step by step", "explain why", "explain how", "analyze", "analyse", "compare", "contrast",
+	"trade-off", "tradeoff", "pros and cons", "prove", "derive", "reason about", "critique",
+	"evaluate", "implications", "root cause", "```",
+}
+
+// complexPrompt tells, without calling a model, whether prompt asks for reasoning rather than a
+// lookup or a rewrite: it names more than one of the complexMarkers, or asks several questions.
+func complexPrompt(prompt string) bool {
+	lower := strings.ToLower(prompt)
+
+	score := 0
+	for _, marker := range complexMarkers {
+		if strings.Contains(lower, marker) {
+			score++
+		}
+	}
+	if strings.Count(prompt, "?") >= 3 {
+		score++
+	}
+
+	return score >= 2
+}
+
+// route returns the model to answer prompt with: the Model itself, or its WithRouter model.
+func (m *Model) route(prompt string) *Model {
+	if m.router == nil {
+		return m
+	}
+	if m.GetNumTokens(prompt) > m.routeTokens || complexPrompt(prompt) {
+		return m.router
+	}
+
+	return m
+}
+
+// isPromptRouter reports whether modelID is the ARN of a Bedrock intelligent prompt router, which
+// picks one of its models for each prompt itself.
+func isPromptRouter(modelID string) bool {
+	return strings.HasPrefix(modelID, "arn:") &&
+		(strings.Contains(modelID, ":default-prompt-router/") || strings.Contains(modelID, ":prompt-router/"))
+}
+
+// lookupRouterModel asks Bedrock for the fallback model of a prompt router, whose payload format
+// its other models share.
+func lookupRouterModel(ctx context.Context, routerARN string) (string, error) {
+	cfg := loadAWSConfig()
+	if region := arnRegion(routerARN); region != "" {
+		cfg.Region = region
+	}
+
+	router, err := bedrock.NewFromConfig(cfg).GetPromptRouter(ctx, &bedrock.GetPromptRouterInput{PromptRouterArn: aws.String(routerARN)})
+	if err != nil {
+		return "", err
+	}
+	if router.FallbackModel != nil && aws.ToString(router.FallbackModel.ModelArn) != "" {
+		return baseModelID(aws.ToString(router.FallbackModel.ModelArn)), nil
+	}
+	if len(router.Models) == 0 {
+		return "", fmt.Errorf("%s has no model", routerARN)
+	}
+
+	return baseModelID(aws.ToString(router.Models[0].ModelArn)), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tmc/langchaingo/schema"
+)
+
+func parseS3URI(uri string) (bucket, key string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URI %q", uri)
+	}
+
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func listS3Keys(ctx context.Context, client *s3.Client, bucket, prefix string) ([]string, error) {
+	var keys []string
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if key == prefix {
+				return []string{key}, nil
+			}
+			if !strings.HasSuffix(key, "/") {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func getDocsFromS3(ctx context.Context, uri string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading data from", uri)
+
+	cfg := loadAWSConfig()
+	client := s3.NewFromConfig(cfg)
+
+	bucket, prefix, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := listS3Keys(ctx, client, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []schema.Document
+
+	for _, key := range keys {
+		format := l.Format
+		if format == "auto" {
+			format = formatFromExtension(key)
+		}
+
+		object, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, err
+		}
+
+		if format == "" {
+			format = formatFromContentType(aws.ToString(object.ContentType))
+		}
+
+		var loaded []schema.Document
+		if format == "audio" {
+			// Transcribe reads the object where it is, rather than an upload of it.
+			object.Body.Close()
+			var doc schema.Document
+			doc, err = transcribeS3(ctx, cfg, "s3://"+bucket+"/"+key, l)
+			loaded = []schema.Document{doc}
+		} else {
+			loaded, err = loadDocs(ctx, object.Body, format, l)
+			object.Body.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, key, err)
+		}
+
+		for i := range loaded {
+			if loaded[i].Metadata == nil {
+				loaded[i].Metadata = map[string]any{}
+			}
+			loaded[i].Metadata["source"] = "s3://" + bucket + "/" + key
+		}
+
+		docs = append(docs, loaded...)
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no objects found at %s", uri)
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded data from", uri)
+
+	return docs, nil
+}
+
+// uploadS3 uploads data under the s3://bucket/prefix dest, named by its hash, for the AWS services
+// that only read S3 objects. It returns the URI of the object and a func deleting it.
+func uploadS3(ctx context.Context, cfg aws.Config, dest string, data []byte) (string, func(), error) {
+	bucket, prefix, err := parseS3URI(strings.TrimSuffix(dest, "/") + "/")
+	if err != nil {
+		return "", nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	key := strings.TrimPrefix(prefix+hex.EncodeToString(sum[:]), "/")
+	uri := "s3://" + bucket + "/" + key
+
+	fmt.Fprintln(os.Stderr, "uploading to", uri)
+
+	client := s3.NewFromConfig(cfg)
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(data)})
+	if err != nil {
+		return "", nil, err
+	}
+
+	remove := func() {
+		_, err := client.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "deleting", uri+":", err)
+		}
+	}
+
+	return uri, remove, nil
+}
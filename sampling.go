@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+type SamplingFlags struct {
+	Sampling
+}
+
+func (f *SamplingFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.Seed, "seed", 0, "seed of the sampling, for reproducible outputs where the model takes one, 0 for none")
+	fs.Float64Var(&f.TopP, "top-p", 0, "cumulative probability of the tokens sampled from, 0 for the model default")
+	fs.IntVar(&f.TopK, "top-k", 0, "number of most likely tokens sampled from, 0 for the model default")
+	fs.Float64Var(&f.RepetitionPenalty, "repetition-penalty", 0, "penalty of repeated tokens, 0 for the model default")
+	fs.Float64Var(&f.FrequencyPenalty, "frequency-penalty", 0, "penalty of tokens by how often they already appear, 0 for the model default")
+	fs.Float64Var(&f.PresencePenalty, "presence-penalty", 0, "penalty of tokens that already appear, 0 for the model default")
+	fs.Float64Var(&f.MinP, "min-p", 0, "minimum probability of a sampled token relative to the most likely one, 0 for the model default")
+}
+
+// Sampling are the sampling controls of every call that doesn't set its own. Zero values leave the
+// model defaults.
+type Sampling struct {
+	Seed              int
+	TopP              float64
+	TopK              int
+	RepetitionPenalty float64
+	FrequencyPenalty  float64
+	PresencePenalty   float64
+	// MinP has no llms.CallOptions field, so it is the same for every call.
+	MinP float64
+}
+
+// WithSampling sets the sampling controls of every call that doesn't set its own.
+func WithSampling(s Sampling) ModelOption {
+	return func(m *Model) {
+		m.sampling = s
+	}
+}
+
+// apply fills the options a call left unset.
+func (s Sampling) apply(opts *llms.CallOptions) {
+	if opts.Seed == 0 {
+		opts.Seed = s.Seed
+	}
+	if opts.TopP == 0 {
+		opts.TopP = s.TopP
+	}
+	if opts.TopK == 0 {
+		opts.TopK = s.TopK
+	}
+	if opts.RepetitionPenalty == 0 {
+		opts.RepetitionPenalty = s.RepetitionPenalty
+	}
+	if opts.FrequencyPenalty == 0 {
+		opts.FrequencyPenalty = s.FrequencyPenalty
+	}
+	if opts.PresencePenalty == 0 {
+		opts.PresencePenalty = s.PresencePenalty
+	}
+}
+
+// unsupported names the controls set in s that the payload of codec has no field for. The Converse
+// API passes them all on to the model, which rejects those it doesn't know.
+func (s Sampling) unsupported(codec Codec) []string {
+	set := map[string]bool{
+		"-seed":               s.Seed != 0,
+		"-repetition-penalty": s.RepetitionPenalty != 0,
+		"-frequency-penalty":  s.FrequencyPenalty != 0,
+		"-presence-penalty":   s.PresencePenalty != 0,
+		"-min-p":              s.MinP != 0,
+	}
+
+	switch codec.(type) {
+	case ConverseCodec:
+		return nil
+	case CohereCodec:
+		set["-seed"], set["-frequency-penalty"], set["-presence-penalty"] = false, false, false
+	}
+
+	var names []string
+	for _, name := range []string{"-seed", "-repetition-penalty", "-frequency-penalty", "-presence-penalty", "-min-p"} {
+		if set[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// warnUnsupportedSampling tells that the model ignores some of its sampling controls, which makes
+// its outputs less reproducible than asked for.
+func (m *Model) warnUnsupportedSampling() {
+	if names := m.sampling.unsupported(m.codec); len(names) > 0 {
+		log.Printf("warning: the %s payload has no field for %s, call it with -converse to pass them on", m.modelID, strings.Join(names, ", "))
+	}
+}
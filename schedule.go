@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Job summarizes sources on a cron schedule. Every field but Name, Schedule and the sources
+// overrides the command line flag of the same name when set.
+type Job struct {
+	Name      string            `json:"name"`
+	Schedule  string            `json:"schedule"`
+	URLs      []string          `json:"urls"`
+	Feed      string            `json:"feed"`
+	FeedLimit int               `json:"feed_limit"`
+	Publish   string            `json:"publish"`
+	Model     string            `json:"model"`
+	Prompt    string            `json:"prompt"`
+	Template  string            `json:"template"`
+	Style     string            `json:"style"`
+	Variables map[string]string `json:"variables"`
+	Lang      string            `json:"lang"`
+	MaxTokens int               `json:"max_tokens"`
+	CharLimit int               `json:"char_limit"`
+	Report    string            `json:"report"`
+}
+
+type ScheduleConfig struct {
+	Jobs []Job `json:"jobs"`
+}
+
+func loadScheduleConfig(path string) (ScheduleConfig, error) {
+	var config ScheduleConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i, job := range config.Jobs {
+		if job.Name == "" {
+			config.Jobs[i].Name = fmt.Sprintf("job %d", i+1)
+		}
+		if len(job.URLs) == 0 && job.Feed == "" {
+			return config, fmt.Errorf("%s: %s has neither urls nor a feed", path, config.Jobs[i].Name)
+		}
+		_, err = cron.ParseStandard(job.Schedule)
+		if err != nil {
+			return config, fmt.Errorf("%s: %s: %w", path, config.Jobs[i].Name, err)
+		}
+	}
+
+	return config, nil
+}
+
+// jobFlags applies the overrides of job to the command line flags.
+func jobFlags(f Flags, job Job) (Flags, error) {
+	if job.Publish != "" {
+		f.Publish = job.Publish
+	}
+	if job.Model != "" {
+		f.Model = job.Model
+	}
+	if job.Template != "" {
+		f.Template = job.Template
+	}
+	if job.Style != "" {
+		f.Style = job.Style
+	}
+	if job.Prompt != "" {
+		f.Prompt = job.Prompt
+	}
+	if job.Lang != "" {
+		f.Lang = job.Lang
+	}
+	if job.MaxTokens != 0 {
+		f.MaxTokens = job.MaxTokens
+	}
+	if job.CharLimit != 0 {
+		f.CharLimit = job.CharLimit
+	}
+	if job.FeedLimit != 0 {
+		f.FeedLimit = job.FeedLimit
+	}
+
+	f.Variables = maps.Clone(f.Variables)
+	maps.Copy(f.Variables, job.Variables)
+
+	question, err := f.PromptFlags.question()
+	if err != nil {
+		return f, err
+	}
+	f.hashtags, err = f.PromptFlags.hashtagCount()
+	if err != nil {
+		return f, err
+	}
+	f.Prompt = question
+
+	return f, nil
+}
+
+// runJob summarizes and publishes the sources of job once.
+func runJob(ctx context.Context, f Flags, job Job) error {
+	f, err := jobFlags(f, job)
+	if err != nil {
+		return err
+	}
+
+	publishers, err := newPublishers(f.Publish, f.DryRun)
+	if err != nil {
+		return err
+	}
+
+	sources := append([]string(nil), job.URLs...)
+	titles := make([]string, len(sources))
+
+	if job.Feed != "" {
+		entries, err := getFeedEntries(job.Feed, f.FeedLimit)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			sources = append(sources, entry.Link)
+			titles = append(titles, entry.Title)
+		}
+	}
+
+	large := newModel(f)
+	defer func() {
+		err := large.Auditor.Close()
+		if err != nil {
+			log.Println("closing the audit log:", err)
+		}
+	}()
+	policy, err := f.PolicyFlags.policy(large)
+	if err != nil {
+		return err
+	}
+	publishers = guard(publishers, policy)
+
+	results := summarizeBatch(ctx, large, sources, f.Workers, f)
+	for i := range results {
+		results[i].Title = titles[i]
+	}
+	publishResults(ctx, publishers, results)
+
+	writeBatchReport(results, job.Report)
+	printUsage(os.Stderr, large.usageReports()...)
+
+	return nil
+}
+
+// runSchedule runs the jobs of the -schedule config file at their times until the process is stopped.
+// A job never overlaps with itself, a run that is still going when the next one is due skips it.
+// On SIGTERM or SIGINT no job starts anymore, and those running are given -grace-period to finish.
+func runSchedule(f Flags) {
+	config, err := loadScheduleConfig(f.Schedule)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The metrics are served until the running jobs are over, for a last scrape.
+	var metrics *http.Server
+	if f.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metricsHandler())
+		metrics = &http.Server{Addr: f.MetricsAddr, Handler: mux}
+		go func() {
+			err := metrics.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	stopping, stop := shutdownSignals()
+	defer stop()
+
+	// The runs are canceled at the end of the grace period.
+	base, abort := context.WithCancel(context.Background())
+	defer abort()
+
+	var wg sync.WaitGroup
+	for _, job := range config.Jobs {
+		schedule, err := cron.ParseStandard(job.Schedule)
+		if err != nil {
+			log.Fatalf("%s: %v", job.Name, err)
+		}
+
+		wg.Add(1)
+		go func(job Job, schedule cron.Schedule) {
+			defer wg.Done()
+
+			for {
+				next := schedule.Next(time.Now())
+				if next.IsZero() {
+					log.Printf("%s: schedule %q never runs again", job.Name, job.Schedule)
+					return
+				}
+
+				log.Printf("%s: next run at %s", job.Name, next.Format(time.RFC3339))
+				select {
+				case <-stopping.Done():
+					return
+				case <-time.After(time.Until(next)):
+				}
+
+				log.Printf("%s: running", job.Name)
+				err := runJob(base, f, job)
+				if err != nil {
+					log.Printf("%s: %v", job.Name, err)
+				}
+			}
+		}(job, schedule)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-stopping.Done():
+		log.Printf("shutting down, waiting up to %s for the running jobs", f.GracePeriod)
+		drain(done, f.GracePeriod, abort)
+	}
+
+	if metrics != nil {
+		_ = metrics.Shutdown(context.Background())
+	}
+}
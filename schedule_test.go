@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadScheduleConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// err is a part of the error message, empty when the config is valid.
+		err   string
+		names []string
+	}{
+		{
+			name:   "cron expressions",
+			config: `{"jobs": [{"name": "news", "schedule": "0 7 * * 1-5", "feed": "https://example.com/feed"}, {"schedule": "*/15 * * * *", "urls": ["https://example.com"]}]}`,
+			names:  []string{"news", "job 2"},
+		},
+		{
+			name:   "descriptors",
+			config: `{"jobs": [{"schedule": "@daily", "feed": "https://example.com/feed"}, {"schedule": "@every 1h30m", "feed": "https://example.com/feed"}]}`,
+			names:  []string{"job 1", "job 2"},
+		},
+		{
+			name:   "time zone",
+			config: `{"jobs": [{"schedule": "CRON_TZ=Europe/Paris 30 8 * * *", "feed": "https://example.com/feed"}]}`,
+			names:  []string{"job 1"},
+		},
+		{
+			name:   "too many fields",
+			config: `{"jobs": [{"name": "news", "schedule": "0 0 7 * * 1-5", "feed": "https://example.com/feed"}]}`,
+			err:    "news: expected exactly 5 fields",
+		},
+		{
+			name:   "out of range",
+			config: `{"jobs": [{"name": "news", "schedule": "0 25 * * *", "feed": "https://example.com/feed"}]}`,
+			err:    "news: end of range (25) above maximum (23)",
+		},
+		{
+			name:   "empty schedule",
+			config: `{"jobs": [{"name": "news", "feed": "https://example.com/feed"}]}`,
+			err:    "news: empty spec string",
+		},
+		{
+			name:   "no sources",
+			config: `{"jobs": [{"name": "news", "schedule": "@daily"}]}`,
+			err:    "news has neither urls nor a feed",
+		},
+		{
+			name:   "invalid JSON",
+			config: `{"jobs": [}`,
+			err:    "invalid character",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schedule.json")
+			err := os.WriteFile(path, []byte(tt.config), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := loadScheduleConfig(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one with %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, job := range config.Jobs {
+				names = append(names, job.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("got jobs %q, want %q", names, tt.names)
+			}
+		})
+	}
+}
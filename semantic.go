@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+// sentenceEnd matches the end of a sentence or paragraph, which a semantic chunk may end at.
+var sentenceEnd = regexp.MustCompile(`[.!?]["')\]]*\s+|\n\s*\n`)
+
+// SemanticSplitter breaks a text between the sentences where the topic changes, found as the
+// largest distances between the embeddings of consecutive groups of sentences.
+type SemanticSplitter struct {
+	Embedder embeddings.Embedder
+	// Percentile of the distances between sentences above which a text is broken.
+	Percentile float64
+	// Window is the number of sentences on each side of a sentence embedded along with it, to
+	// smooth out short sentences.
+	Window int
+	// ChunkSize caps the characters of a chunk, which is broken at the largest distance within it
+	// when a topic runs longer.
+	ChunkSize int
+}
+
+// sentenceSpans returns the byte ranges of the sentences of text, their trailing space included.
+func sentenceSpans(text string) [][2]int {
+	var spans [][2]int
+
+	start := 0
+	for _, end := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if strings.TrimSpace(text[start:end[1]]) != "" {
+			spans = append(spans, [2]int{start, end[1]})
+		}
+		start = end[1]
+	}
+	if strings.TrimSpace(text[start:]) != "" {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+func (s SemanticSplitter) SplitText(text string) ([]string, error) {
+	spans := sentenceSpans(text)
+	if len(spans) < 2 {
+		return []string{strings.TrimSpace(text)}, nil
+	}
+
+	windows := make([]string, len(spans))
+	for i := range spans {
+		first, last := max(i-s.Window, 0), min(i+s.Window, len(spans)-1)
+		windows[i] = text[spans[first][0]:spans[last][1]]
+	}
+
+	vectors, err := s.Embedder.EmbedDocuments(context.Background(), windows)
+	if err != nil {
+		return nil, err
+	}
+
+	// distances[i] is between sentence i and sentence i+1.
+	distances := make([]float64, len(spans)-1)
+	for i := range distances {
+		distances[i] = 1 - cosineSimilarity(vectors[i], vectors[i+1])
+	}
+	threshold := percentile(distances, s.Percentile)
+
+	var breaks []int
+	for i, d := range distances {
+		if d > threshold {
+			breaks = append(breaks, i+1)
+		}
+	}
+	breaks = append(breaks, len(spans))
+
+	var chunks []string
+	first := 0
+	for _, end := range breaks {
+		for _, group := range s.capSize(spans, distances, first, end) {
+			chunks = append(chunks, strings.TrimSpace(text[spans[group[0]][0]:spans[group[1]-1][1]]))
+		}
+		first = end
+	}
+
+	return chunks, nil
+}
+
+// capSize splits the sentences first to end, as long as they are longer than ChunkSize, at their
+// largest distance.
+func (s SemanticSplitter) capSize(spans [][2]int, distances []float64, first, end int) [][2]int {
+	if end-first < 2 || s.ChunkSize <= 0 || spans[end-1][1]-spans[first][0] <= s.ChunkSize {
+		return [][2]int{{first, end}}
+	}
+
+	at := first + 1
+	for i := first + 1; i < end; i++ {
+		if distances[i-1] > distances[at-1] {
+			at = i
+		}
+	}
+
+	return append(s.capSize(spans, distances, first, at), s.capSize(spans, distances, at, end)...)
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := 0; i < min(len(a), len(b)); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+
+	return dot / math.Sqrt(na*nb)
+}
+
+// percentile returns the p-th percentile of values, by nearest rank.
+func percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
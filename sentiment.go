@@ -0,0 +1,19 @@
+package main
+
+const sentimentPrompt = "Classify the sentiment and the tone of the document towards its main subject, as a press officer triaging coverage would, and explain why in one or two sentences quoting the document where it helps."
+
+var sentimentSchema = &JSONSchema{
+	Type: "object",
+	Properties: map[string]*JSONSchema{
+		"subject":   {Type: "string", Description: "what or who the document is mainly about"},
+		"sentiment": {Type: "string", Enum: []any{"positive", "negative", "neutral", "mixed"}},
+		"score":     {Type: "number", Description: "from -1, entirely negative, to 1, entirely positive"},
+		"tone": {
+			Type:        "array",
+			Description: "one to three words describing the tone, such as critical, enthusiastic, alarmist, factual or ironic",
+			Items:       &JSONSchema{Type: "string"},
+		},
+		"rationale": {Type: "string", Description: "why, in one or two sentences"},
+	},
+	Required: []string{"subject", "sentiment", "score", "tone", "rationale"},
+}
@@ -0,0 +1,16 @@
+package main
+
+const seoPrompt = "Write the metadata an editor publishes the article with: a headline, a meta description for search results, a URL slug, the Open Graph title and description shown when it is shared, and a summary of the article."
+
+var seoSchema = &JSONSchema{
+	Type: "object",
+	Properties: map[string]*JSONSchema{
+		"headline":         {Type: "string", Description: "headline of the article, in title case", MaxLength: maxLength(70)},
+		"meta_description": {Type: "string", Description: "description shown under the link in search results", MaxLength: maxLength(160)},
+		"slug":             {Type: "string", Description: "lowercase words of the headline joined by hyphens", Pattern: "^[a-z0-9]+(-[a-z0-9]+)*$", MaxLength: maxLength(60)},
+		"og_title":         {Type: "string", Description: "og:title, shown when the article is shared", MaxLength: maxLength(60)},
+		"og_description":   {Type: "string", Description: "og:description, shown when the article is shared", MaxLength: maxLength(200)},
+		"summary":          {Type: "string", Description: "summary of the article"},
+	},
+	Required: []string{"headline", "meta_description", "slug", "og_title", "og_description", "summary"},
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/memory"
+	"github.com/tmc/langchaingo/schema"
+)
+
+type SummarizeRequest struct {
+	URL       string            `json:"url"`
+	Prompt    string            `json:"prompt"`
+	Template  string            `json:"template"`
+	Variables map[string]string `json:"variables"`
+	Language  string            `json:"language"`
+	Images    []string          `json:"images"`
+	CharLimit int               `json:"char_limit"`
+	InferenceOverrides
+}
+
+// ChatRequest asks a question about the document at URL. The server keeps no conversation, the
+// previous turns come with each question.
+type ChatRequest struct {
+	URL      string     `json:"url"`
+	Question string     `json:"question"`
+	History  []ChatTurn `json:"history"`
+	InferenceOverrides
+}
+
+type ChatTurn struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+type SummarizeResponse struct {
+	Text  string `json:"text,omitempty"`
+	Short string `json:"short,omitempty"`
+	Model string `json:"model,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type server struct {
+	models   *ModelSet
+	auth     *Authenticator
+	loader   LoaderFlags
+	splitter SplitterFlags
+	// args are the command line of the serve subcommand, read again on a reload.
+	args []string
+
+	mu       sync.Mutex
+	adminKey string
+}
+
+func serve(f ServeFlags) {
+	debug = f.Debug
+	awsFlags = f.AWSFlags
+	fetchFlags = f.FetchFlags
+	transportFlags = f.TransportFlags
+
+	options := []ModelOption{WithGuardrail(f.GuardrailID, f.GuardrailVersion), WithSystemPrompt(f.System), WithBaseModel(f.BaseModel), WithInferenceProfile(f.InferenceProfile), WithFallbacks(modelList(f.Fallback)...), WithRouter(f.Route, f.RouteTokens), WithSampling(f.Sampling), WithRateLimit(f.RPS, f.TPM), WithCircuitBreaker(f.CircuitFailures, f.CircuitCooldown)}
+	if f.Converse {
+		options = append(options, WithConverse())
+	}
+	cassette, err := f.AuditFlags.cassette()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cassette != nil {
+		options = append(options, WithReplay(cassette))
+	}
+
+	cache := f.CacheFlags.cache()
+	auditor, err := f.AuditFlags.auditor()
+	if err != nil {
+		log.Fatal(err)
+	}
+	build := func(modelID string) (*Model, error) {
+		m, err := buildLargeLanguageModel(modelID, options...)
+		if err != nil {
+			return nil, err
+		}
+		m.Timeout = f.Timeout
+		m.Cache = cache
+		m.Auditor = auditor
+		if f.Verbose {
+			m.CallbacksHandler = newLogHandler(os.Stderr)
+		}
+		return m, nil
+	}
+	large, err := build(f.Model)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The base model of -base-model, the -inference-profile and the -route are those of -model alone.
+	allowed := modelList(f.Models)
+	s := &server{models: newModelSet(large, allowed, build), loader: f.LoaderFlags, splitter: f.SplitterFlags, args: os.Args[2:], adminKey: f.AdminKey}
+	options = append(options, WithBaseModel(""), WithInferenceProfile(""), WithRouter("", 0))
+	for _, id := range allowed {
+		_, err = s.models.get(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	s.models.setRateLimit(f.RPS, f.TPM)
+
+	s.auth, err = newAuthenticator(f.AuthFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go s.reloadOnHangup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/summarize", s.auth.middleware(s.handleSummarize))
+	mux.HandleFunc("/chat", s.auth.middleware(s.handleChat))
+	mux.HandleFunc("/admin/", s.handleAdmin)
+	mux.Handle("/metrics", metricsHandler())
+
+	// The requests run in base, canceled at the end of the grace period of a shutdown so that
+	// the Bedrock calls still going give up.
+	base, abort := context.WithCancel(context.Background())
+	defer abort()
+	srv := &http.Server{Addr: f.Addr, Handler: mux, BaseContext: func(net.Listener) context.Context { return base }}
+
+	stopping, stop := shutdownSignals()
+	defer stop()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-stopping.Done()
+		log.Printf("shutting down, waiting up to %s for the requests in flight", f.GracePeriod)
+
+		// Shutdown stops accepting requests and returns once those in flight are answered.
+		done := make(chan struct{})
+		go func() {
+			_ = srv.Shutdown(context.Background())
+			close(done)
+		}()
+		drain(done, f.GracePeriod, func() {
+			abort()
+			srv.Close()
+		})
+	}()
+
+	log.Println("listening on", f.Addr)
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-drained
+
+	err = auditor.Close()
+	if err != nil {
+		log.Println("closing the audit log:", err)
+	}
+	printUsage(os.Stderr, s.models.usageReports()...)
+}
+
+func (s *server) handleSummarize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, SummarizeResponse{Error: "method not allowed"})
+		return
+	}
+
+	var req SummarizeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+		return
+	}
+
+	stream := newEventStream(w, r)
+
+	ctx, span := startSpan(contextWithRemoteParent(r.Context(), r.Header.Get("Traceparent")), "POST /summarize", spanKindServer, "url", req.URL)
+	start := time.Now()
+	status, resp := s.summarize(ctx, req, stream.tokens())
+	summarizeSeconds.WithLabelValues(outcome(status < http.StatusBadRequest)).Observe(time.Since(start).Seconds())
+	span.SetAttributes("http.response.status_code", status)
+	if resp.Error != "" && status >= http.StatusBadRequest {
+		span.End(errors.New(resp.Error))
+	} else {
+		span.End(nil)
+	}
+
+	stream.finish(w, status, resp)
+}
+
+func (s *server) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, SummarizeResponse{Error: "method not allowed"})
+		return
+	}
+
+	var req ChatRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SummarizeResponse{Error: err.Error()})
+		return
+	}
+
+	stream := newEventStream(w, r)
+
+	ctx, span := startSpan(contextWithRemoteParent(r.Context(), r.Header.Get("Traceparent")), "POST /chat", spanKindServer, "url", req.URL)
+	status, resp := s.chat(ctx, req, stream.tokens())
+	span.SetAttributes("http.response.status_code", status)
+	if status >= http.StatusBadRequest {
+		span.End(errors.New(resp.Error))
+	} else {
+		span.End(nil)
+	}
+
+	stream.finish(w, status, resp)
+}
+
+// chat answers a ChatRequest with the HTTP status that best describes the outcome.
+func (s *server) chat(ctx context.Context, req ChatRequest, streamingFunc func(context.Context, []byte) error) (int, SummarizeResponse) {
+	if req.URL == "" || req.Question == "" {
+		return http.StatusBadRequest, SummarizeResponse{Error: "url and question are required"}
+	}
+	err := req.InferenceOverrides.validate()
+	if err != nil {
+		return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+	}
+	llm := s.models.defaultModel()
+	if req.Model != "" {
+		llm, err = s.models.get(req.Model)
+		if err != nil {
+			return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+		}
+	}
+	temperature := 0.1
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = 500
+	}
+
+	docs, err := loadDocuments(ctx, req.URL, getWebDocs, s.loader, s.splitter)
+	if err != nil {
+		return http.StatusBadGateway, SummarizeResponse{Error: err.Error()}
+	}
+	docs = fitDocuments(llm, docs, llm.DocumentBudget(req.MaxTokens))
+
+	history := memory.NewChatMessageHistory()
+	for _, turn := range req.History {
+		history.AddUserMessage(ctx, turn.Question)
+		history.AddAIMessage(ctx, turn.Answer)
+	}
+	mem := memory.NewConversationBuffer(memory.WithChatHistory(history), memory.WithInputKey("question"), memory.WithOutputKey("text"))
+
+	options := []chains.ChainCallOption{chains.WithMaxTokens(req.MaxTokens), chains.WithTemperature(temperature), chains.WithTopP(req.TopP), chains.WithTopK(req.TopK)}
+	if streamingFunc != nil {
+		options = append(options, chains.WithStreamingFunc(streamingFunc))
+	}
+
+	answerCtx, answer := withAnswerRecord(ctx)
+	out, err := chains.Call(answerCtx, newChatChain(llm, mem), map[string]any{
+		"context":  chatDocument(docs),
+		"question": req.Question,
+	}, options...)
+	if err != nil {
+		return errorStatus(err), SummarizeResponse{Error: err.Error()}
+	}
+
+	text, _ := out["text"].(string)
+	return http.StatusOK, SummarizeResponse{Text: strings.TrimSpace(text), Model: answer.ModelID()}
+}
+
+// summarize answers a SummarizeRequest with the HTTP status that best describes the outcome. The
+// summary is streamed to streamingFunc as it is generated when it is not nil.
+func (s *server) summarize(ctx context.Context, req SummarizeRequest, streamingFunc func(context.Context, []byte) error) (int, SummarizeResponse) {
+	var err error
+
+	if req.URL == "" && len(req.Images) == 0 {
+		return http.StatusBadRequest, SummarizeResponse{Error: "url or images is required"}
+	}
+	for _, image := range req.Images {
+		if !strings.HasPrefix(image, "http://") && !strings.HasPrefix(image, "https://") {
+			return http.StatusBadRequest, SummarizeResponse{Error: "images must be links"}
+		}
+	}
+	if req.Template == "" {
+		req.Template = defaultTemplate
+	}
+	err = req.InferenceOverrides.validate()
+	if err != nil {
+		return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+	}
+	llm := s.models.defaultModel()
+	if req.Model != "" {
+		llm, err = s.models.get(req.Model)
+		if err != nil {
+			return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+		}
+	}
+	temperature := 0.1
+	if req.Temperature != nil {
+		temperature = *req.Temperature
+	}
+
+	var hashtags int
+	if req.Prompt == "" {
+		hashtags, err = templateHashtagCount(req.Template, req.Variables)
+		if err != nil {
+			return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+		}
+		req.Prompt, err = renderTemplate(req.Template, req.Variables)
+		if err != nil {
+			return http.StatusBadRequest, SummarizeResponse{Error: err.Error()}
+		}
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = 500
+	}
+	if req.Language == "" {
+		req.Language = "auto"
+	}
+
+	images, err := loadImages(req.Images)
+	if err != nil {
+		return http.StatusBadGateway, SummarizeResponse{Error: err.Error()}
+	}
+	ctx = withImages(ctx, images)
+
+	var docs []schema.Document
+	if req.URL != "" {
+		docs, err = loadDocuments(ctx, req.URL, getWebDocs, s.loader, s.splitter)
+		if err != nil {
+			return http.StatusBadGateway, SummarizeResponse{Error: err.Error()}
+		}
+
+		docs = fitDocuments(llm, docs, llm.DocumentBudget(req.MaxTokens))
+	}
+
+	var mismatch *LanguageMismatchError
+
+	answerCtx, answer := withAnswerRecord(ctx)
+	options := []chains.ChainCallOption{chains.WithMaxTokens(req.MaxTokens), chains.WithTemperature(temperature), chains.WithTopP(req.TopP), chains.WithTopK(req.TopK)}
+	if streamingFunc != nil {
+		options = append(options, chains.WithStreamingFunc(streamingFunc))
+	}
+	text, err := summarizeIn(answerCtx, llm, docs, req.Prompt, req.Language, options...)
+	if err != nil && !errors.As(err, &mismatch) {
+		return errorStatus(err), SummarizeResponse{Error: err.Error()}
+	}
+	langErr := err
+
+	if hashtags > 0 {
+		text, err = fixHashtags(ctx, llm, text, hashtags)
+		if err != nil {
+			return errorStatus(err), SummarizeResponse{Error: err.Error()}
+		}
+	}
+
+	resp := SummarizeResponse{Text: text, Model: answer.ModelID()}
+	if req.CharLimit > 0 {
+		resp.Short, err = fitCharLimit(ctx, llm, text, req.CharLimit, hashtags)
+		if err != nil {
+			return errorStatus(err), SummarizeResponse{Error: err.Error()}
+		}
+	}
+	if langErr != nil {
+		resp.Error = langErr.Error()
+	}
+
+	return http.StatusOK, resp
+}
+
+// errorStatus is the HTTP status of a failed summary, telling clients which failures are worth retrying.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrThrottled):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrContextTooLong):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrContentFiltered):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrModelNotFound), errors.Is(err, ErrAccessDenied):
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
+
+// eventStream answers a request that accepts text/event-stream with server-sent events: a token
+// event for each chunk of the answer as it is generated, then a done event of the whole response,
+// or an error event of it when the request fails once the stream has started. A request failing
+// before its first event is answered with JSON and its status as usual.
+type eventStream struct {
+	w       http.ResponseWriter
+	mu      sync.Mutex
+	started bool
+}
+
+// newEventStream returns the eventStream of r, nil when r does not accept one.
+func newEventStream(w http.ResponseWriter, r *http.Request) *eventStream {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return nil
+	}
+
+	return &eventStream{w: w}
+}
+
+func (s *eventStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		// Proxies such as nginx would otherwise hold the events back.
+		s.w.Header().Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	if err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// tokens is the streaming function sending the chunks of the answer, nil without a stream.
+func (s *eventStream) tokens() func(context.Context, []byte) error {
+	if s == nil {
+		return nil
+	}
+
+	return func(_ context.Context, chunk []byte) error {
+		return s.send("token", map[string]string{"text": string(chunk)})
+	}
+}
+
+// finish ends the stream with resp, or writes it as JSON when there is no stream to end.
+func (s *eventStream) finish(w http.ResponseWriter, status int, resp SummarizeResponse) {
+	if s == nil || (!s.started && status >= http.StatusBadRequest) {
+		writeJSON(w, status, resp)
+		return
+	}
+
+	if status >= http.StatusBadRequest {
+		event := struct {
+			SummarizeResponse
+			Status int `json:"status"`
+		}{resp, status}
+		err := s.send("error", event)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	err := s.send("done", resp)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
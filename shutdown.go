@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// abortTimeout is how long the work still going at the end of the grace period is given to stop
+// once it is canceled.
+const abortTimeout = 5 * time.Second
+
+// shutdownSignals returns a context canceled when the process is asked to stop, with a SIGTERM as
+// from ECS, Kubernetes or systemd, or a SIGINT as from Ctrl-C.
+func shutdownSignals() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+}
+
+// drain waits for done to be closed, the work in flight to be over, for up to grace. Then it
+// calls abort to cancel the work still going and waits a little more for it to stop.
+func drain(done <-chan struct{}, grace time.Duration, abort func()) {
+	select {
+	case <-done:
+		return
+	case <-time.After(grace):
+	}
+
+	log.Println("the grace period is over, canceling the work still in flight")
+	abort()
+
+	select {
+	case <-done:
+	case <-time.After(abortTimeout):
+		log.Println("exiting with work still in flight")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+type SplitterFlags struct {
+	Splitter           string
+	ChunkSize          int
+	ChunkOverlap       int
+	EmbeddingModel     string
+	SemanticPercentile float64
+	Dedup              float64
+}
+
+func (f *SplitterFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Splitter, "splitter", "recursive", "text splitter used to chunk documents: recursive, token, semantic or none")
+	fs.IntVar(&f.ChunkSize, "chunk-size", 4000, "maximum size of a chunk")
+	fs.IntVar(&f.ChunkOverlap, "chunk-overlap", 200, "overlap between consecutive chunks")
+	fs.StringVar(&f.EmbeddingModel, "embedding-model", embeddingModelID, "Bedrock Titan or Cohere embedding model the semantic splitter compares sentences with, and -dedup chunks")
+	fs.Float64Var(&f.Dedup, "dedup", 0, "drop the chunks whose embeddings are at least this cosine similar to an earlier chunk, such as 0.95, to leave out repeated boilerplate; 0 to keep them all")
+	fs.Float64Var(&f.SemanticPercentile, "semantic-percentile", 95, "percentile of the distances between sentences above which the semantic splitter starts a new chunk")
+}
+
+func (f SplitterFlags) textSplitter() (textsplitter.TextSplitter, error) {
+	switch f.Splitter {
+	case "recursive":
+		return textsplitter.NewRecursiveCharacter(
+			textsplitter.WithChunkSize(f.ChunkSize),
+			textsplitter.WithChunkOverlap(f.ChunkOverlap),
+		), nil
+	case "token":
+		return textsplitter.NewTokenSplitter(
+			textsplitter.WithChunkSize(f.ChunkSize),
+			textsplitter.WithChunkOverlap(f.ChunkOverlap),
+		), nil
+	case "semantic":
+		return SemanticSplitter{
+			Embedder:   newEmbeddings(f.EmbeddingModel),
+			Percentile: f.SemanticPercentile,
+			Window:     1,
+			ChunkSize:  f.ChunkSize,
+		}, nil
+	case "none", "":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown splitter %q", f.Splitter)
+}
+
+// splitDocs chunks docs, noting in the metadata of each chunk the heading of its section and
+// its "start" and "end" character offsets in the document, so answers can cite where they come from.
+func splitDocs(docs []schema.Document, f SplitterFlags) ([]schema.Document, error) {
+	splitter, err := f.textSplitter()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []schema.Document
+	for _, doc := range docs {
+		texts := []string{doc.PageContent}
+		if splitter != nil {
+			texts, err = splitter.SplitText(doc.PageContent)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// offset is where the last chunk started, in bytes and in characters, and section the heading in effect there.
+		offset, chars, section := 0, 0, ""
+		for _, text := range texts {
+			metadata := maps.Clone(doc.Metadata)
+			if metadata == nil {
+				metadata = map[string]any{}
+			}
+
+			// Splitters may trim the chunks, so look for each from where the last one started.
+			if i := strings.Index(doc.PageContent[offset:], text); i >= 0 {
+				start := offset + i
+				section = lastHeading(doc.PageContent[offset:start], section)
+				chars += utf8.RuneCountInString(doc.PageContent[offset:start])
+				offset = start
+
+				metadata["start"] = chars
+				metadata["end"] = chars + utf8.RuneCountInString(text)
+			}
+			if heading := chunkHeading(text, section); heading != "" {
+				metadata["heading"] = heading
+			}
+
+			chunks = append(chunks, schema.Document{PageContent: text, Metadata: metadata})
+		}
+	}
+
+	return chunks, nil
+}
+
+var headingPattern = regexp.MustCompile(`(?m)^#{1,6} +(.+)$`)
+
+// lastHeading returns the last markdown heading in text, or section if it has none.
+func lastHeading(text, section string) string {
+	if m := headingPattern.FindAllStringSubmatch(text, -1); len(m) > 0 {
+		return strings.TrimSpace(m[len(m)-1][1])
+	}
+
+	return section
+}
+
+// chunkHeading returns the heading a chunk starts with, else the section it is in, else its first heading.
+func chunkHeading(chunk, section string) string {
+	m := headingPattern.FindStringSubmatchIndex(chunk)
+	if m == nil {
+		return section
+	}
+	if m[0] == 0 || section == "" {
+		return strings.TrimSpace(chunk[m[2]:m[3]])
+	}
+
+	return section
+}
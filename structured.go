@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/outputparser"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const (
+	maxRepairAttempts = 2
+	repairFormat      = "The following output was supposed to be JSON matching this schema:\n%s\n\nOutput:\n%s\n\nIt is invalid: %s\n\nReturn only the corrected JSON."
+)
+
+// JSONSchema is the subset of JSON Schema used to describe and validate structured output.
+type JSONSchema struct {
+	Type        string                 `json:"type,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	Enum        []any                  `json:"enum,omitempty"`
+	MinItems    *int                   `json:"minItems,omitempty"`
+	MaxItems    *int                   `json:"maxItems,omitempty"`
+	MaxLength   *int                   `json:"maxLength,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+}
+
+var defaultSchema = &JSONSchema{
+	Type: "object",
+	Properties: map[string]*JSONSchema{
+		"title":    {Type: "string", Description: "title of the article"},
+		"summary":  {Type: "string", Description: "summary of the article"},
+		"hashtags": {Type: "array", Items: &JSONSchema{Type: "string"}, Description: "hashtags to publish the summary with"},
+	},
+	Required: []string{"title", "summary", "hashtags"},
+}
+
+// maxLength is the MaxLength of a string of at most n characters.
+func maxLength(n int) *int {
+	return &n
+}
+
+func loadSchema(path string) (*JSONSchema, error) {
+	if path == "" {
+		return defaultSchema, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s JSONSchema
+
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &s, nil
+}
+
+func (s *JSONSchema) validate(v any, path string) error {
+	if path == "" {
+		path = "$"
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, prop := range s.Properties {
+			value, ok := obj[name]
+			if !ok {
+				continue
+			}
+			err := prop.validate(value, path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *s.MinItems, len(arr))
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *s.MaxItems, len(arr))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+		if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", path, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("%s: pattern %q: %w", path, s.Pattern, err)
+			}
+			if !re.MatchString(str) {
+				return fmt.Errorf("%s: %q doesn't match %s", path, str, s.Pattern)
+			}
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	}
+
+	return nil
+}
+
+// JSONParser is an output parser that extracts a JSON document from a completion and validates it against a schema.
+type JSONParser struct {
+	Schema *JSONSchema
+}
+
+var _ schema.OutputParser[any] = JSONParser{}
+
+func (p JSONParser) Parse(text string) (any, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, outputparser.ParseError{Text: text, Reason: "no JSON object found"}
+	}
+
+	var v any
+
+	err := json.Unmarshal([]byte(text[start:end+1]), &v)
+	if err != nil {
+		return nil, outputparser.ParseError{Text: text, Reason: err.Error()}
+	}
+
+	err = p.Schema.validate(v, "")
+	if err != nil {
+		return nil, outputparser.ParseError{Text: text, Reason: err.Error()}
+	}
+
+	return v, nil
+}
+
+func (p JSONParser) ParseWithPrompt(text string, _ schema.PromptValue) (any, error) {
+	return p.Parse(text)
+}
+
+func (p JSONParser) GetFormatInstructions() string {
+	s, _ := json.MarshalIndent(p.Schema, "", "  ")
+	return fmt.Sprintf("Respond only with a JSON object, without any other text, that matches this JSON schema:\n%s", s)
+}
+
+func (p JSONParser) Type() string {
+	return "json_schema_parser"
+}
+
+// parseWithRepair parses text and, while the output is invalid, asks the model to repair it.
+func (p JSONParser) parseWithRepair(ctx context.Context, llm llms.LLM, text string, options ...llms.CallOption) (any, error) {
+	v, err := p.Parse(text)
+
+	for attempt := 0; err != nil && attempt < maxRepairAttempts; attempt++ {
+		s, _ := json.MarshalIndent(p.Schema, "", "  ")
+
+		text, err = llm.Call(ctx, fmt.Sprintf(repairFormat, s, text, parseReason(err)), options...)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err = p.Parse(text)
+	}
+
+	return v, err
+}
+
+func parseReason(err error) string {
+	if pe, ok := err.(outputparser.ParseError); ok {
+		return pe.Reason
+	}
+
+	return err.Error()
+}
+
+func summarizeStructured(ctx context.Context, llm *Model, docs []schema.Document, question string, s *JSONSchema, maxTokens int, temperature float64) (any, error) {
+	parser := JSONParser{Schema: s}
+
+	text, err := summarize(ctx, llm, docs, question+"\n\n"+parser.GetFormatInstructions(),
+		chains.WithMaxTokens(maxTokens), chains.WithTemperature(temperature))
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.parseWithRepair(ctx, llm, text, llms.WithMaxTokens(maxTokens), llms.WithTemperature(temperature))
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// tableRowsPerDoc is the number of sampled rows in each row document of a table.
+const tableRowsPerDoc = 25
+
+// tableDistinctLimit bounds the distinct values counted for each column.
+const tableDistinctLimit = 1000
+
+// tableDateLayouts are the layouts a column of dates is recognized by.
+var tableDateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05", "01/02/2006", "02.01.2006"}
+
+// Table is a sheet of a spreadsheet or a CSV file: its header and the rows under it.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   [][]string
+}
+
+// readCSV reads a CSV or TSV file, separated by the comma, tab or semicolon its first line has most of.
+func readCSV(r io.Reader) (Table, error) {
+	br := bufio.NewReader(r)
+	first, _ := br.Peek(4096)
+	first, _, _ = bytes.Cut(first, []byte("\n"))
+
+	cr := csv.NewReader(br)
+	cr.Comma = ','
+	for _, sep := range []rune{'\t', ';'} {
+		if bytes.Count(first, []byte(string(sep))) > bytes.Count(first, []byte(string(cr.Comma))) {
+			cr.Comma = sep
+		}
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return Table{}, err
+	}
+	if len(records) == 0 {
+		return Table{}, fmt.Errorf("the file has no rows")
+	}
+	records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+
+	return Table{Header: records[0], Rows: records[1:]}, nil
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				Text []string `xml:"t"`
+				Runs []string `xml:"r>t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX reads the sheets of an Excel workbook, the first row of each as its header. Dates are left
+// as the serial numbers Excel stores them as.
+func readXLSX(data []byte) ([]Table, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	decode := func(name string, v any) error {
+		f, err := zr.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return xml.NewDecoder(f).Decode(v)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	err = decode("xl/workbook.xml", &workbook)
+	if err != nil {
+		return nil, fmt.Errorf("not an Excel workbook: %w", err)
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	err = decode("xl/_rels/workbook.xml.rels", &rels)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	for _, rel := range rels.Relationships {
+		target := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(target, "xl/") {
+			target = path.Join("xl", target)
+		}
+		targets[rel.ID] = target
+	}
+
+	var shared struct {
+		Items []struct {
+			Text []string `xml:"t"`
+			Runs []string `xml:"r>t"`
+		} `xml:"si"`
+	}
+	// Workbooks of numbers alone have no shared strings.
+	_ = decode("xl/sharedStrings.xml", &shared)
+	strs := make([]string, len(shared.Items))
+	for i, item := range shared.Items {
+		strs[i] = strings.Join(item.Text, "") + strings.Join(item.Runs, "")
+	}
+
+	var tables []Table
+	for _, s := range workbook.Sheets {
+		var sheet xlsxSheet
+		err = decode(targets[s.ID], &sheet)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %w", s.Name, err)
+		}
+
+		var rows [][]string
+		for _, row := range sheet.Rows {
+			var values []string
+			for i, cell := range row.Cells {
+				col := i
+				if cell.Ref != "" {
+					col = xlsxColumn(cell.Ref)
+				}
+				value := cell.Value
+				switch cell.Type {
+				case "s":
+					n, err := strconv.Atoi(value)
+					if err == nil && n >= 0 && n < len(strs) {
+						value = strs[n]
+					}
+				case "inlineStr":
+					value = strings.Join(cell.Inline.Text, "") + strings.Join(cell.Inline.Runs, "")
+				case "b":
+					value = strconv.FormatBool(value == "1")
+				}
+				for len(values) <= col {
+					values = append(values, "")
+				}
+				values[col] = value
+			}
+			rows = append(rows, values)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		tables = append(tables, Table{Name: s.Name, Header: rows[0], Rows: rows[1:]})
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("the workbook has no rows")
+	}
+
+	return tables, nil
+}
+
+// xlsxColumn returns the index of the column of a cell reference such as AB12.
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+
+	return col - 1
+}
+
+// ColumnStats describes the values of a column of a table.
+type ColumnStats struct {
+	Name     string
+	Type     string
+	Filled   int
+	Distinct int
+	Min, Max string
+	Top      []string
+}
+
+func (c ColumnStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- %s (%s): %d values", c.Name, c.Type, c.Filled)
+	if c.Distinct >= tableDistinctLimit {
+		fmt.Fprintf(&b, ", over %d distinct", tableDistinctLimit)
+	} else {
+		fmt.Fprintf(&b, ", %d distinct", c.Distinct)
+	}
+	if c.Min != "" {
+		fmt.Fprintf(&b, ", from %s to %s", c.Min, c.Max)
+	}
+	if len(c.Top) > 0 {
+		fmt.Fprintf(&b, ", such as %s", strings.Join(c.Top, ", "))
+	}
+
+	return b.String()
+}
+
+// columnStats infers the type of each column from its non-empty values, and describes them.
+func columnStats(t Table) []ColumnStats {
+	stats := make([]ColumnStats, len(t.Header))
+	for j, name := range t.Header {
+		if name == "" {
+			name = fmt.Sprintf("column %d", j+1)
+		}
+
+		counts := map[string]int{}
+		var values []string
+		for _, row := range t.Rows {
+			if j >= len(row) || strings.TrimSpace(row[j]) == "" {
+				continue
+			}
+			value := strings.TrimSpace(row[j])
+			values = append(values, value)
+			if len(counts) < tableDistinctLimit || counts[value] > 0 {
+				counts[value]++
+			}
+		}
+
+		s := ColumnStats{Name: name, Type: columnType(values), Filled: len(values), Distinct: len(counts)}
+		switch s.Type {
+		case "integer", "number":
+			lo, hi := 0.0, 0.0
+			for i, value := range values {
+				f, _ := strconv.ParseFloat(value, 64)
+				if i == 0 || f < lo {
+					lo = f
+				}
+				if i == 0 || f > hi {
+					hi = f
+				}
+			}
+			if len(values) > 0 {
+				s.Min, s.Max = strconv.FormatFloat(lo, 'g', -1, 64), strconv.FormatFloat(hi, 'g', -1, 64)
+			}
+		case "date":
+			var lo, hi time.Time
+			for _, value := range values {
+				for _, layout := range tableDateLayouts {
+					d, err := time.Parse(layout, value)
+					if err != nil {
+						continue
+					}
+					if s.Min == "" || d.Before(lo) {
+						lo, s.Min = d, value
+					}
+					if s.Max == "" || d.After(hi) {
+						hi, s.Max = d, value
+					}
+					break
+				}
+			}
+		case "text", "boolean":
+			top := make([]string, 0, len(counts))
+			for value := range counts {
+				top = append(top, value)
+			}
+			sort.Slice(top, func(a, b int) bool {
+				if counts[top[a]] != counts[top[b]] {
+					return counts[top[a]] > counts[top[b]]
+				}
+				return top[a] < top[b]
+			})
+			for _, value := range top[:min(3, len(top))] {
+				if len(value) > 40 {
+					value = value[:40] + "…"
+				}
+				s.Top = append(s.Top, strconv.Quote(value))
+			}
+		}
+
+		stats[j] = s
+	}
+
+	return stats
+}
+
+// columnType returns integer, number, boolean, date or text: the narrowest type of all the values.
+func columnType(values []string) string {
+	if len(values) == 0 {
+		return "empty"
+	}
+
+	is := func(ok func(string) bool) bool {
+		for _, value := range values {
+			if !ok(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case is(func(v string) bool { _, err := strconv.ParseInt(v, 10, 64); return err == nil }):
+		return "integer"
+	case is(func(v string) bool { _, err := strconv.ParseFloat(v, 64); return err == nil }):
+		return "number"
+	case is(func(v string) bool { _, err := strconv.ParseBool(strings.ToLower(v)); return err == nil }):
+		return "boolean"
+	}
+	for _, layout := range tableDateLayouts {
+		if is(func(v string) bool { _, err := time.Parse(layout, v); return err == nil }) {
+			return "date"
+		}
+	}
+
+	return "text"
+}
+
+// sampleRows returns n rows spread evenly over the table, in order, or all of them when there are
+// fewer.
+func sampleRows(rows [][]string, n int) [][]string {
+	if n <= 0 || len(rows) <= n {
+		return rows
+	}
+
+	sample := make([][]string, n)
+	for i := range sample {
+		sample[i] = rows[i*len(rows)/n]
+	}
+
+	return sample
+}
+
+// markdownTable returns the rows as a Markdown table under header.
+func markdownTable(header []string, rows [][]string) string {
+	cell := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+	}
+
+	var b strings.Builder
+	line := func(row []string) {
+		b.WriteString("|")
+		for j := range header {
+			value := ""
+			if j < len(row) {
+				value = row[j]
+			}
+			b.WriteString(" " + cell(value) + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	line(header)
+	b.WriteString(strings.Repeat("| --- ", len(header)) + "|\n")
+	for _, row := range rows {
+		line(row)
+	}
+
+	return b.String()
+}
+
+// tableDocs returns a document describing the schema of the table, then documents of -sample-rows
+// of its rows, so that a model sees both the shape of the whole dataset and what its rows look like.
+func tableDocs(t Table, l LoaderFlags) []schema.Document {
+	stats := columnStats(t)
+
+	title := "Dataset"
+	if t.Name != "" {
+		title = "Sheet " + t.Name
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s with %d rows and %d columns.\n\nColumns:\n", title, len(t.Rows), len(t.Header))
+	for _, s := range stats {
+		b.WriteString(s.String() + "\n")
+	}
+
+	header := make([]string, len(stats))
+	for j, s := range stats {
+		header[j] = s.Name
+	}
+
+	docs := []schema.Document{{
+		PageContent: b.String(),
+		Metadata:    map[string]any{"table": t.Name, "kind": "schema", "rows": len(t.Rows), "columns": strings.Join(header, ", ")},
+	}}
+
+	sample := sampleRows(t.Rows, l.SampleRows)
+	for i := 0; i < len(sample); i += tableRowsPerDoc {
+		batch := sample[i:min(i+tableRowsPerDoc, len(sample))]
+		text := fmt.Sprintf("%s, sampled rows %d to %d of %d:\n\n%s", title, i+1, i+len(batch), len(sample), markdownTable(header, batch))
+		docs = append(docs, schema.Document{
+			PageContent: text,
+			Metadata:    map[string]any{"table": t.Name, "kind": "rows", "rows": len(batch)},
+		})
+	}
+
+	return docs
+}
+
+// loadTables loads a CSV file or Excel workbook as the documents of tableDocs for each of its tables.
+func loadTables(r io.Reader, format string, l LoaderFlags) ([]schema.Document, error) {
+	var tables []Table
+	if format == "xlsx" {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		tables, err = readXLSX(data)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		t, err := readCSV(r)
+		if err != nil {
+			return nil, err
+		}
+		tables = []Table{t}
+	}
+
+	var docs []schema.Document
+	for _, t := range tables {
+		docs = append(docs, tableDocs(t, l)...)
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// threadAttempts is how many times the model is asked for a thread of the right number of posts.
+const threadAttempts = 2
+
+const threadPromptFormat = `Rewrite this summary as a thread of exactly %d social media posts, each of at most %d characters. The first post must make people want to read on, each post must make sense on its own, and the posts must not be numbered or have hashtags. Separate the posts with a line containing only ---. Answer with the posts only.
+
+%s`
+
+var threadSeparator = regexp.MustCompile(`(?m)^\s*---+\s*$`)
+
+// makeThread rewrites summary as a thread of posts of at most limit characters, numbered as 1/3,
+// 2/3 and 3/3, with the hashtags of the summary on the last post.
+func makeThread(ctx context.Context, llm llms.LLM, summary string, posts, limit int) ([]string, error) {
+	body, tags := splitHashtags(summary)
+	tags = normalizeHashtags(tags)
+
+	var suffix string
+	if len(tags) > 0 {
+		suffix = "\n\n" + strings.Join(tags, " ")
+	}
+	numbering := len(fmt.Sprintf("%d/%d ", posts, posts))
+	// Every post is asked for short enough that the last one has room for the hashtags.
+	room := limit - numbering - utf8.RuneCountInString(suffix)
+	if room < 40 {
+		return nil, fmt.Errorf("-char-limit %d leaves no room for a thread post with its number and hashtags", limit)
+	}
+
+	var thread []string
+	for attempt := 0; attempt < threadAttempts && len(thread) != posts; attempt++ {
+		answer, err := llm.Call(ctx, fmt.Sprintf(threadPromptFormat, posts, room, body), llms.WithMaxTokens(posts*room))
+		if err != nil {
+			return nil, err
+		}
+
+		thread = nil
+		for _, post := range threadSeparator.Split(answer, -1) {
+			post, _ = splitHashtags(post)
+			if post != "" {
+				thread = append(thread, post)
+			}
+		}
+	}
+	if len(thread) == 0 {
+		return nil, fmt.Errorf("the model wrote no thread")
+	}
+
+	for i, post := range thread {
+		number := fmt.Sprintf("%d/%d ", i+1, len(thread))
+		if i == len(thread)-1 {
+			post += suffix
+		}
+		if utf8.RuneCountInString(number+post) > limit {
+			post = cutToLimit(post, limit-utf8.RuneCountInString(number))
+		}
+		thread[i] = number + post
+	}
+
+	return thread, nil
+}
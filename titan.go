@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+type TitanRequest struct {
+	InputText            string                    `json:"inputText"`
+	TextGenerationConfig TitanTextGenerationConfig `json:"textGenerationConfig"`
+}
+
+type TitanTextGenerationConfig struct {
+	MaxTokenCount int      `json:"maxTokenCount,omitempty"`
+	Temperature   float64  `json:"temperature,omitempty"`
+	TopP          float64  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type TitanResult struct {
+	OutputText       string `json:"outputText"`
+	CompletionReason string `json:"completionReason"`
+}
+
+type TitanResponse struct {
+	Results []TitanResult `json:"results"`
+}
+
+// TitanCodec speaks the Amazon Titan Text payload.
+type TitanCodec struct{}
+
+func (TitanCodec) EncodeRequest(system, prompt string, opts *llms.CallOptions) ([]byte, error) {
+	return json.Marshal(TitanRequest{
+		InputText: withSystem(system, prompt),
+		TextGenerationConfig: TitanTextGenerationConfig{
+			MaxTokenCount: opts.MaxTokens,
+			Temperature:   opts.Temperature,
+			TopP:          opts.TopP,
+			StopSequences: opts.StopWords,
+		},
+	})
+}
+
+func (TitanCodec) DecodeResponse(body []byte) (Response, error) {
+	var resp TitanResponse
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(resp.Results) == 0 {
+		return Response{}, nil
+	}
+
+	if resp.Results[0].CompletionReason == "CONTENT_FILTERED" {
+		return Response{}, ErrContentFiltered
+	}
+
+	return Response{Completion: resp.Results[0].OutputText, StopReason: resp.Results[0].CompletionReason}, nil
+}
+
+func (TitanCodec) DecodeChunk(body []byte) (string, error) {
+	var chunk TitanResult
+
+	err := json.Unmarshal(body, &chunk)
+	if err != nil {
+		return "", err
+	}
+
+	return chunk.OutputText, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// promptOverhead reserves room for the chain's prompt template around the documents.
+const promptOverhead = 500
+
+type PromptTooLongError struct {
+	ModelID string
+	Tokens  int
+	Allowed int
+}
+
+func (e *PromptTooLongError) Error() string {
+	return fmt.Sprintf("prompt for %s is %d tokens, only %d are allowed", e.ModelID, e.Tokens, e.Allowed)
+}
+
+func (e *PromptTooLongError) Is(target error) bool {
+	return target == ErrContextTooLong
+}
+
+func (m *Model) checkPromptSize(prompt string, opts *llms.CallOptions) error {
+	allowed := contextWindow(m.baseModel) - opts.MaxTokens
+	tokens := m.GetNumTokens(prompt) + m.GetNumTokens(m.system)
+	if tokens > allowed {
+		return &PromptTooLongError{ModelID: m.modelID, Tokens: tokens, Allowed: allowed}
+	}
+
+	return nil
+}
+
+// DocumentBudget is the number of tokens left for documents once the completion and the prompt template are accounted for.
+func (m *Model) DocumentBudget(maxTokens int) int {
+	return contextWindow(m.baseModel) - maxTokens - promptOverhead
+}
+
+// fitDocuments keeps documents in order until the budget is spent, cutting the last one short if needed.
+func fitDocuments(llm llms.LanguageModel, docs []schema.Document, budget int) []schema.Document {
+	fitted := make([]schema.Document, 0, len(docs))
+
+	for _, doc := range docs {
+		tokens := llm.GetNumTokens(doc.PageContent)
+		if tokens <= budget {
+			fitted = append(fitted, doc)
+			budget -= tokens
+			continue
+		}
+
+		if budget > 0 {
+			runes := []rune(doc.PageContent)
+			doc.PageContent = string(runes[:len(runes)*budget/tokens])
+			fitted = append(fitted, doc)
+		}
+
+		fmt.Fprintf(os.Stderr, "truncated content to fit %d of %d documents in the context window\n", len(fitted), len(docs))
+		break
+	}
+
+	return fitted
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// MessagesTool is a tool the model may call, from a langchaingo function definition.
+type MessagesTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+// ToolChoice tells the model whether it must call a tool: auto lets it choose, any makes it call
+// one, and tool makes it call the one named.
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// messagesTools returns the tools and tool choice of the Messages API for the functions of opts.
+// The function call behavior is auto, none to send no tools, any, or {"name": "my_function"}.
+func messagesTools(opts *llms.CallOptions) ([]MessagesTool, *ToolChoice, error) {
+	if len(opts.Functions) == 0 || opts.FunctionCallBehavior == llms.FunctionCallBehaviorNone {
+		return nil, nil, nil
+	}
+
+	tools := make([]MessagesTool, len(opts.Functions))
+	for i, function := range opts.Functions {
+		tools[i] = MessagesTool{Name: function.Name, Description: function.Description, InputSchema: function.Parameters}
+		if tools[i].InputSchema == nil {
+			tools[i].InputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+	}
+
+	switch behavior := strings.TrimSpace(string(opts.FunctionCallBehavior)); behavior {
+	case "", string(llms.FunctionCallBehaviorAuto):
+		return tools, nil, nil
+	case "any":
+		return tools, &ToolChoice{Type: "any"}, nil
+	default:
+		var named struct {
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal([]byte(behavior), &named)
+		if err != nil || named.Name == "" {
+			return nil, nil, fmt.Errorf("unknown function call behavior %q", behavior)
+		}
+		return tools, &ToolChoice{Type: "tool", Name: named.Name}, nil
+	}
+}
+
+// toolCall returns the first tool the model called in content, as the function call langchaingo
+// reads from the message of a generation.
+func toolCall(content []Content) *schema.FunctionCall {
+	for _, c := range content {
+		if c.Type == "tool_use" {
+			return &schema.FunctionCall{Name: c.Name, Arguments: string(c.Input)}
+		}
+	}
+
+	return nil
+}
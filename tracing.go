@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracingFlushInterval = 5 * time.Second
+	spanKindInternal     = trace.SpanKindInternal
+	spanKindServer       = trace.SpanKindServer
+	spanKindClient       = trace.SpanKindClient
+)
+
+// Span is a timed operation exported as an OpenTelemetry span. A nil Span, returned while tracing
+// is disabled, ignores every call.
+type Span struct {
+	span trace.Span
+}
+
+// tracerProvider batches the ended spans and sends them to the OTLP/HTTP collector, nil while
+// tracing is disabled.
+var tracerProvider *sdktrace.TracerProvider
+
+// initTracing turns tracing on when an OTLP endpoint is configured with the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT variables, and returns
+// the function that flushes the remaining spans before exit.
+func initTracing() func() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func() {}
+	}
+
+	// The exporter reads the endpoint and OTEL_EXPORTER_OTLP_HEADERS itself.
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		log.Println("tracing:", err)
+		return func() {}
+	}
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "bedrock-langchain"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		log.Println("tracing:", err)
+		return func() {}
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(tracingFlushInterval)),
+		sdktrace.WithResource(res),
+	)
+
+	return func() {
+		err := tracerProvider.Shutdown(context.Background())
+		if err != nil {
+			log.Println("tracing:", err)
+		}
+	}
+}
+
+// flushTracing sends the ended spans now rather than at the next interval.
+func flushTracing() {
+	if tracerProvider != nil {
+		err := tracerProvider.ForceFlush(context.Background())
+		if err != nil {
+			log.Println("tracing:", err)
+		}
+	}
+}
+
+// startSpan starts a span that is a child of the span in ctx, if any, with attributes given as key, value pairs.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...any) (context.Context, *Span) {
+	if tracerProvider == nil {
+		return ctx, nil
+	}
+
+	ctx, span := tracerProvider.Tracer("langchain1").Start(ctx, name, trace.WithSpanKind(kind))
+	s := &Span{span: span}
+	s.SetAttributes(attrs...)
+
+	return ctx, s
+}
+
+// contextWithRemoteParent makes the spans started with ctx children of a W3C traceparent header.
+func contextWithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	if tracerProvider == nil {
+		return ctx
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
+
+// SetAttributes sets attributes given as key, value pairs.
+func (s *Span) SetAttributes(attrs ...any) {
+	if s == nil {
+		return
+	}
+
+	kvs := make([]attribute.KeyValue, 0, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		kvs = append(kvs, spanAttribute(fmt.Sprint(attrs[i]), attrs[i+1]))
+	}
+
+	s.span.SetAttributes(kvs...)
+}
+
+// End records the span, marking it as failed when err is not nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// endInvoke ends the span of a Bedrock call with the token usage of its response.
+func (s *Span) endInvoke(resp Response, err error) {
+	if resp.Usage != (Usage{}) {
+		s.SetAttributes("gen_ai.usage.input_tokens", resp.Usage.InputTokens, "gen_ai.usage.output_tokens", resp.Usage.OutputTokens)
+	}
+	s.End(err)
+}
+
+func spanAttribute(key string, value any) attribute.KeyValue {
+	switch value := value.(type) {
+	case string:
+		return attribute.String(key, value)
+	case int:
+		return attribute.Int(key, value)
+	case float64:
+		return attribute.Float64(key, value)
+	case bool:
+		return attribute.Bool(key, value)
+	}
+
+	return attribute.String(key, fmt.Sprint(value))
+}
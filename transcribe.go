@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/transcribe"
+	"github.com/aws/aws-sdk-go-v2/service/transcribe/types"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// transcribePollInterval is how often the status of a transcription job is checked.
+const transcribePollInterval = 10 * time.Second
+
+// transcribeS3 runs a transcription job on the audio or video object at uri and waits for its
+// transcript, in -transcribe-lang or, for auto, the language Transcribe identifies.
+func transcribeS3(ctx context.Context, cfg aws.Config, uri string, l LoaderFlags) (schema.Document, error) {
+	sum := sha256.Sum256([]byte(uri))
+	name := fmt.Sprintf("langchain1-%s-%d", hex.EncodeToString(sum[:6]), time.Now().Unix())
+
+	client := transcribe.NewFromConfig(cfg)
+
+	in := &transcribe.StartTranscriptionJobInput{
+		TranscriptionJobName: aws.String(name),
+		Media:                &types.Media{MediaFileUri: aws.String(uri)},
+	}
+	if l.TranscribeLang == "" || l.TranscribeLang == "auto" {
+		in.IdentifyLanguage = aws.Bool(true)
+	} else {
+		in.LanguageCode = types.LanguageCode(l.TranscribeLang)
+	}
+
+	out, err := client.StartTranscriptionJob(ctx, in)
+	if err != nil {
+		return schema.Document{}, err
+	}
+
+	fmt.Fprintln(os.Stderr, "waiting for transcription job", name)
+
+	job := out.TranscriptionJob
+	for job.TranscriptionJobStatus != types.TranscriptionJobStatusCompleted {
+		if job.TranscriptionJobStatus == types.TranscriptionJobStatusFailed {
+			return schema.Document{}, fmt.Errorf("transcription of %s failed: %s", uri, aws.ToString(job.FailureReason))
+		}
+
+		select {
+		case <-ctx.Done():
+			return schema.Document{}, ctx.Err()
+		case <-time.After(transcribePollInterval):
+		}
+
+		got, err := client.GetTranscriptionJob(ctx, &transcribe.GetTranscriptionJobInput{TranscriptionJobName: aws.String(name)})
+		if err != nil {
+			return schema.Document{}, err
+		}
+		job = got.TranscriptionJob
+	}
+
+	// The transcript is in a bucket of the service, behind a presigned link.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, aws.ToString(job.Transcript.TranscriptFileUri), nil)
+	if err != nil {
+		return schema.Document{}, err
+	}
+	resp, err := cfg.HTTPClient.Do(req)
+	if err != nil {
+		return schema.Document{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return schema.Document{}, fmt.Errorf("transcript of %s: %s", uri, resp.Status)
+	}
+
+	var transcript struct {
+		Results struct {
+			Transcripts []struct {
+				Transcript string `json:"transcript"`
+			} `json:"transcripts"`
+		} `json:"results"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&transcript)
+	if err != nil {
+		return schema.Document{}, err
+	}
+
+	var parts []string
+	for _, t := range transcript.Results.Transcripts {
+		parts = append(parts, t.Transcript)
+	}
+	text := strings.TrimSpace(strings.Join(parts, "\n\n"))
+	if text == "" {
+		return schema.Document{}, fmt.Errorf("the transcript of %s is empty", uri)
+	}
+
+	return schema.Document{
+		PageContent: text,
+		Metadata:    map[string]any{"transcription_job": name, "language": string(job.LanguageCode)},
+	}, nil
+}
+
+// transcribeAudio uploads the audio or video of r to the -transcribe-bucket, transcribes it with
+// transcribeS3 and deletes the upload.
+func transcribeAudio(ctx context.Context, r io.Reader, l LoaderFlags) ([]schema.Document, error) {
+	if l.TranscribeBucket == "" {
+		return nil, errors.New("transcribing audio needs the s3://bucket/prefix it is uploaded to in -transcribe-bucket")
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := loadAWSConfig()
+
+	uri, remove, err := uploadS3(ctx, cfg, l.TranscribeBucket, data)
+	if err != nil {
+		return nil, err
+	}
+	defer remove()
+
+	doc, err := transcribeS3(ctx, cfg, uri, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return []schema.Document{doc}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const glossaryTemplate = `List up to 30 names, technical terms and recurring expressions of the text below that a translator into %s must translate the same way throughout, one per line as "term => translation". Keep names that are not translated as they are. Reply only with the list.
+
+Text:
+
+%s`
+
+const translateTemplate = `Translate the text below into %s. Keep its meaning, tone, paragraphs and Markdown formatting, and reply only with the translation.
+
+Translate these terms as the glossary says:
+%s
+
+It continues this passage, already translated:
+%s
+
+Text:
+
+%s`
+
+// translationContext is how much of the end of the previous translated chunk each chunk is sent
+// with, so the translation reads on across chunks.
+const translationContext = 600
+
+// translationChunks splits text into chunks whose translation fits in maxTokens, between
+// paragraphs where it can, or else between words.
+func translationChunks(llm llms.LanguageModel, text string, maxTokens int) []string {
+	// A translation is often longer than its text.
+	limit := maxTokens * 2 / 3
+
+	var chunks []string
+	chunk := ""
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		if chunk != "" && llm.GetNumTokens(chunk+"\n\n"+paragraph) > limit {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += "\n\n" + paragraph
+			continue
+		}
+
+		for tokens := llm.GetNumTokens(paragraph); tokens > limit; tokens = llm.GetNumTokens(paragraph) {
+			words := strings.Fields(paragraph)
+			cut := max(len(words)*limit/tokens, 1)
+			chunks = append(chunks, strings.Join(words[:cut], " "))
+			paragraph = strings.Join(words[cut:], " ")
+		}
+		chunk = paragraph
+	}
+	if chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// translate translates the documents into target chunk by chunk, with a glossary made from the
+// start of the documents so terms are translated the same way in every chunk.
+func translate(ctx context.Context, large *Model, docs []schema.Document, target string, maxTokens int, temperature float64) (string, error) {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+	}
+	text := strings.Join(texts, "\n\n")
+
+	options := []llms.CallOption{llms.WithMaxTokens(maxTokens), llms.WithTemperature(temperature)}
+
+	start := fitDocuments(large, []schema.Document{{PageContent: text}}, large.DocumentBudget(maxTokens))
+	glossary := ""
+	if len(start) > 0 {
+		var err error
+		glossary, err = large.Call(ctx, fmt.Sprintf(glossaryTemplate, target, start[0].PageContent), options...)
+		if err != nil {
+			return "", fmt.Errorf("glossary: %w", err)
+		}
+	}
+
+	chunks := translationChunks(large, text, maxTokens)
+	translated := make([]string, len(chunks))
+	previous := "(none, this is the start)"
+	for i, chunk := range chunks {
+		fmt.Fprintf(os.Stderr, "translating chunk %d of %d\n", i+1, len(chunks))
+
+		var err error
+		translated[i], err = large.Call(ctx, fmt.Sprintf(translateTemplate, target, strings.TrimSpace(glossary), previous, chunk), options...)
+		if err != nil {
+			return "", fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+		translated[i] = strings.TrimSpace(translated[i])
+
+		previous = translated[i]
+		if runes := []rune(previous); len(runes) > translationContext {
+			previous = "..." + string(runes[len(runes)-translationContext:])
+		}
+	}
+
+	return strings.Join(translated, "\n\n"), nil
+}
+
+// runTranslate translates the document into -target, to stdout or the -output file. The document
+// is loaded whole, as it is chunked to fit the translation of each chunk in -max-tokens.
+func runTranslate(ctx context.Context, large *Model, f Flags) {
+	if f.Target == "" {
+		log.Fatal("-mode translate needs a -target language")
+	}
+	if f.URL == "" {
+		log.Fatal("-mode translate needs a document to translate")
+	}
+
+	s := f.SplitterFlags
+	s.Splitter = "none"
+	docs := loadData(ctx, f.URL, f.LoaderFlags, s)
+
+	translation, err := translate(ctx, large, docs, languageName(f.Target), f.MaxTokens, f.Temperature)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if f.Output != "" {
+		err = os.WriteFile(f.Output, []byte(translation+"\n"), 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Println(translation)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+type TransportFlags struct {
+	Proxy        string
+	ProxyBedrock bool
+	CABundle     string
+}
+
+var transportFlags TransportFlags
+
+func (f *TransportFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Proxy, "proxy", "", "proxy links are loaded through, instead of the one of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables")
+	fs.BoolVar(&f.ProxyBedrock, "proxy-bedrock", false, "also call Bedrock and the other AWS APIs through -proxy")
+	fs.StringVar(&f.CABundle, "ca-bundle", os.Getenv("AWS_CA_BUNDLE"), "PEM file of certificate authorities trusted besides the system ones, e.g. of an internal CA or an intercepting proxy, when loading links and calling AWS")
+}
+
+func (f TransportFlags) proxyURL() (*url.URL, error) {
+	u, err := url.Parse(f.Proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("-proxy %q is not a proxy URL such as http://proxy.example.com:3128", f.Proxy)
+	}
+
+	return u, nil
+}
+
+// rootCAs are the system certificate authorities and those of the -ca-bundle.
+func (f TransportFlags) rootCAs() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(f.CABundle)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", f.CABundle)
+	}
+
+	return pool, nil
+}
+
+// configure makes t trust the -ca-bundle and, when proxy is set, go through the -proxy.
+func (f TransportFlags) configure(t *http.Transport, proxy bool) error {
+	if proxy && f.Proxy != "" {
+		u, err := f.proxyURL()
+		if err != nil {
+			return err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if f.CABundle != "" {
+		pool, err := f.rootCAs()
+		if err != nil {
+			return err
+		}
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	return nil
+}
+
+// fetchTransport is the transport links are loaded with, made once from the transport flags.
+var fetchTransport = sync.OnceValues(func() (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	return t, transportFlags.configure(t, true)
+})
+
+// awsHTTPClient is the client of the AWS SDK with the transport flags, or nil when they leave its
+// default alone. The SDK already uses the proxy of the environment.
+func (f TransportFlags) awsHTTPClient() (*awshttp.BuildableClient, error) {
+	proxy := f.ProxyBedrock && f.Proxy != ""
+	if !proxy && f.CABundle == "" {
+		return nil, nil
+	}
+
+	// The options of a BuildableClient can't fail, so the flags are checked before.
+	err := f.configure(&http.Transport{}, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return awshttp.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+		_ = f.configure(t, proxy)
+	}), nil
+}
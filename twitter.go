@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const tweetsURL = "https://api.twitter.com/2/tweets"
+
+// XPublisher posts to X with the API v2. It signs requests with OAuth 1.0a when X_API_KEY, X_API_SECRET,
+// X_ACCESS_TOKEN and X_ACCESS_TOKEN_SECRET are set, and otherwise sends X_BEARER_TOKEN, an OAuth 2.0
+// user access token with the tweet.write scope.
+type XPublisher struct {
+	APIKey            string
+	APISecret         string
+	AccessToken       string
+	AccessTokenSecret string
+	BearerToken       string
+}
+
+func newXPublisher() *XPublisher {
+	return &XPublisher{
+		APIKey:            os.Getenv("X_API_KEY"),
+		APISecret:         os.Getenv("X_API_SECRET"),
+		AccessToken:       os.Getenv("X_ACCESS_TOKEN"),
+		AccessTokenSecret: os.Getenv("X_ACCESS_TOKEN_SECRET"),
+		BearerToken:       os.Getenv("X_BEARER_TOKEN"),
+	}
+}
+
+type tweetResponse struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// Publish posts the short version of post, which must fit in a post, or its thread as a post and
+// the replies to it, and prints the link to the first post.
+func (p *XPublisher) Publish(ctx context.Context, post Post) error {
+	texts, err := xPosts(post)
+	if err != nil {
+		return err
+	}
+
+	var first, previous string
+	for _, text := range texts {
+		id, err := p.tweet(ctx, text, previous)
+		if err != nil {
+			return err
+		}
+		if first == "" {
+			first = id
+		}
+		previous = id
+	}
+
+	fmt.Fprintln(os.Stderr, "posted to X: https://x.com/i/web/status/"+first)
+
+	return nil
+}
+
+// xPosts are the posts post is published as on X: its thread, or else its short version.
+func xPosts(post Post) ([]string, error) {
+	texts := post.Thread
+	if len(texts) == 0 {
+		texts = []string{post.short()}
+	}
+	for _, text := range texts {
+		if n := utf8.RuneCountInString(text); n > xCharLimit {
+			return nil, fmt.Errorf("post is %d characters, X allows %d, use -char-limit %d", n, xCharLimit, xCharLimit)
+		}
+	}
+
+	return texts, nil
+}
+
+// tweet posts text, as a reply to the post replyTo when it is set, and returns the ID of the post.
+func (p *XPublisher) tweet(ctx context.Context, text, replyTo string) (string, error) {
+	payload := map[string]any{"text": text}
+	if replyTo != "" {
+		payload["reply"] = map[string]string{"in_reply_to_tweet_id": replyTo}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tweetsURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	switch {
+	case p.APIKey != "" && p.AccessToken != "":
+		req.Header.Set("Authorization", p.oauth1Header(req.Method, tweetsURL))
+	case p.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	default:
+		return "", errors.New("no X credentials, set X_API_KEY, X_API_SECRET, X_ACCESS_TOKEN and X_ACCESS_TOKEN_SECRET, or X_BEARER_TOKEN")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("posting to X: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var tweet tweetResponse
+
+	err = json.Unmarshal(data, &tweet)
+	if err != nil {
+		return "", err
+	}
+
+	return tweet.Data.ID, nil
+}
+
+// oauth1Header signs a request without query or form parameters with HMAC-SHA1, as OAuth 1.0a requires.
+func (p *XPublisher) oauth1Header(method, endpoint string) string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+
+	params := map[string]string{
+		"oauth_consumer_key":     p.APIKey,
+		"oauth_nonce":            hex.EncodeToString(nonce),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(time.Now().Unix(), 10),
+		"oauth_token":            p.AccessToken,
+		"oauth_version":          "1.0",
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, oauthEscape(key)+"="+oauthEscape(params[key]))
+	}
+
+	base := method + "&" + oauthEscape(endpoint) + "&" + oauthEscape(strings.Join(pairs, "&"))
+	mac := hmac.New(sha1.New, []byte(oauthEscape(p.APISecret)+"&"+oauthEscape(p.AccessTokenSecret)))
+	mac.Write([]byte(base))
+	params["oauth_signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	header := make([]string, 0, len(params))
+	for _, key := range append(keys, "oauth_signature") {
+		header = append(header, fmt.Sprintf(`%s="%s"`, oauthEscape(key), oauthEscape(params[key])))
+	}
+
+	return "OAuth " + strings.Join(header, ", ")
+}
+
+// oauthEscape percent-encodes s as RFC 3986 requires, which differs from url.QueryEscape for spaces.
+func oauthEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
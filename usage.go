@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Price is the on-demand price, in USD per 1000 tokens, of a model.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// prices is keyed by model ID prefix, the longest matching prefix wins.
+var prices = map[string]Price{
+	"anthropic.claude-v2":         {Input: 0.008, Output: 0.024},
+	"anthropic.claude-instant":    {Input: 0.0008, Output: 0.0024},
+	"anthropic.claude-3-haiku":    {Input: 0.00025, Output: 0.00125},
+	"anthropic.claude-3-sonnet":   {Input: 0.003, Output: 0.015},
+	"anthropic.claude-3-5-sonnet": {Input: 0.003, Output: 0.015},
+	"anthropic.claude-3-opus":     {Input: 0.015, Output: 0.075},
+	"anthropic.claude-3-5-haiku":  {Input: 0.0008, Output: 0.004},
+	"amazon.nova-micro":           {Input: 0.000035, Output: 0.00014},
+	"amazon.nova-lite":            {Input: 0.00006, Output: 0.00024},
+	"amazon.nova-pro":             {Input: 0.0008, Output: 0.0032},
+	"amazon.titan-text-lite":      {Input: 0.00015, Output: 0.0002},
+	"amazon.titan-text-express":   {Input: 0.0002, Output: 0.0006},
+	"amazon.titan-text-premier":   {Input: 0.0005, Output: 0.0015},
+	"meta.llama3-8b":              {Input: 0.0003, Output: 0.0006},
+	"meta.llama3-70b":             {Input: 0.00265, Output: 0.0035},
+	"cohere.command-text":         {Input: 0.0015, Output: 0.002},
+	"cohere.command-light":        {Input: 0.0003, Output: 0.0006},
+	"mistral.mistral-7b":          {Input: 0.00015, Output: 0.0002},
+	"mistral.mixtral-8x7b":        {Input: 0.00045, Output: 0.0007},
+	"mistral.mistral-large":       {Input: 0.004, Output: 0.012},
+}
+
+// loadPrices merges a JSON file of model ID prefix to Price into the built-in table.
+func loadPrices(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var custom map[string]Price
+
+	err = json.Unmarshal(data, &custom)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for prefix, price := range custom {
+		prices[prefix] = price
+	}
+
+	return nil
+}
+
+func priceFor(modelID string) (Price, bool) {
+	var best string
+	for prefix := range prices {
+		if strings.HasPrefix(baseModelID(modelID), prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+
+	return prices[best], true
+}
+
+// UsageReport is the token usage accumulated by a Model.
+type UsageReport struct {
+	ModelID      string  `json:"model_id"`
+	Invocations  int     `json:"invocations"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+type usageTracker struct {
+	mu     sync.Mutex
+	report UsageReport
+}
+
+func (t *usageTracker) add(u Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.report.Invocations++
+	t.report.InputTokens += u.InputTokens
+	t.report.OutputTokens += u.OutputTokens
+}
+
+// Usage returns the tokens used, and their estimated cost, since the Model was created.
+func (m *Model) Usage() UsageReport {
+	m.usage.mu.Lock()
+	report := m.usage.report
+	m.usage.mu.Unlock()
+
+	report.ModelID = m.modelID
+	// Provisioned throughput is paid by the hour, whatever the tokens.
+	if price, ok := priceFor(m.baseModel); ok && !isProvisioned(m.modelID) {
+		report.Cost = float64(report.InputTokens)/1000*price.Input + float64(report.OutputTokens)/1000*price.Output
+	}
+
+	return report
+}
+
+func printUsage(w io.Writer, reports ...UsageReport) {
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s: %d invocations, %d input tokens, %d output tokens, estimated cost $%.4f\n",
+			report.ModelID, report.Invocations, report.InputTokens, report.OutputTokens, report.Cost)
+	}
+}
+
+// usageFromHeaders reads the token counts Bedrock returns as response headers.
+func usageFromHeaders(metadata middleware.Metadata) (Usage, bool) {
+	resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response)
+	if !ok {
+		return Usage{}, false
+	}
+
+	input, err := strconv.Atoi(resp.Header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	if err != nil {
+		return Usage{}, false
+	}
+	output, err := strconv.Atoi(resp.Header.Get("X-Amzn-Bedrock-Output-Token-Count"))
+	if err != nil {
+		return Usage{}, false
+	}
+
+	return Usage{InputTokens: input, OutputTokens: output}, true
+}
+
+type invocationMetrics struct {
+	Metrics *struct {
+		InputTokenCount   int `json:"inputTokenCount"`
+		OutputTokenCount  int `json:"outputTokenCount"`
+		InvocationLatency int `json:"invocationLatency"`
+		FirstByteLatency  int `json:"firstByteLatency"`
+	} `json:"amazon-bedrock-invocationMetrics"`
+	Metadata *struct {
+		Usage   ConverseUsage   `json:"usage"`
+		Metrics ConverseMetrics `json:"metrics"`
+	} `json:"metadata"`
+}
+
+// usageFromChunk reads the token counts Bedrock appends to the last chunk of a stream,
+// or sends as the metadata event of a ConverseStream.
+func usageFromChunk(body []byte) (Usage, bool) {
+	var chunk invocationMetrics
+
+	err := json.Unmarshal(body, &chunk)
+	if err != nil {
+		return Usage{}, false
+	}
+	if chunk.Metadata != nil {
+		return Usage{InputTokens: chunk.Metadata.Usage.InputTokens, OutputTokens: chunk.Metadata.Usage.OutputTokens}, true
+	}
+	if chunk.Metrics == nil {
+		return Usage{}, false
+	}
+
+	return Usage{InputTokens: chunk.Metrics.InputTokenCount, OutputTokens: chunk.Metrics.OutputTokenCount}, true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/tools"
+	"github.com/tmc/langchaingo/tools/duckduckgo"
+	"github.com/tmc/langchaingo/tools/serpapi"
+	"github.com/tmc/langchaingo/tools/wikipedia"
+)
+
+type WebSearchFlags struct {
+	WebSearch        string
+	WebSearchResults int
+}
+
+func (f *WebSearchFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.WebSearch, "web-search", "", "search provider -mode qa looks the question up with when the document doesn't answer it: "+strings.Join(searchProviderNames(), ", ")+", empty for none")
+	fs.IntVar(&f.WebSearchResults, "web-search-results", 5, "number of -web-search results the answer is looked for in")
+}
+
+// searchProviders make the web search tool of each -web-search provider. Another provider only
+// needs to be added here.
+var searchProviders = map[string]func(results int) (tools.Tool, error){
+	"duckduckgo": func(results int) (tools.Tool, error) {
+		return duckduckgo.New(results, crawlerAgent)
+	},
+	// serpapi searches Google with the key of the SERPAPI_API_KEY environment variable.
+	"serpapi": func(results int) (tools.Tool, error) {
+		return serpapi.New()
+	},
+	"wikipedia": func(results int) (tools.Tool, error) {
+		tool := wikipedia.New(crawlerAgent)
+		tool.TopK = results
+		return tool, nil
+	},
+}
+
+func searchProviderNames() []string {
+	names := make([]string, 0, len(searchProviders))
+	for name := range searchProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func newSearchTool(provider string, results int) (tools.Tool, error) {
+	newTool, ok := searchProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown web search provider %q, expected one of %s", provider, strings.Join(searchProviderNames(), ", "))
+	}
+
+	return newTool(results)
+}
+
+// agentModel calls the Model with the maximum tokens and temperature of the run, which the
+// agents of langchaingo don't pass to the model.
+type agentModel struct {
+	*Model
+	maxTokens   int
+	temperature float64
+}
+
+func (a agentModel) GeneratePrompt(ctx context.Context, prompts []schema.PromptValue, options ...llms.CallOption) (llms.LLMResult, error) {
+	return a.Model.GeneratePrompt(ctx, prompts, append(options, llms.WithMaxTokens(a.maxTokens), llms.WithTemperature(a.temperature))...)
+}
+
+// searchWeb answers question with an agent looking it up with the search tool.
+func searchWeb(ctx context.Context, large *Model, search tools.Tool, question string, maxTokens int, temperature float64) (_ string, err error) {
+	ctx, span := startSpan(ctx, "agent web_search", spanKindInternal, "tool", search.Name())
+	defer func() { span.End(err) }()
+
+	llm := agentModel{Model: large, maxTokens: maxTokens, temperature: temperature}
+	executor := agents.NewExecutor(
+		agents.NewOneShotAgent(llm, []tools.Tool{search}, agents.WithCallbacksHandler(large.CallbacksHandler)),
+		[]tools.Tool{search},
+		agents.WithMaxIterations(5),
+		agents.WithCallbacksHandler(large.CallbacksHandler),
+	)
+
+	result, err := executor.Call(ctx, map[string]any{"input": question})
+	if err != nil {
+		return "", err
+	}
+
+	answer, _ := result["output"].(string)
+	return strings.TrimSpace(answer), nil
+}
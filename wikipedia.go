@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+// wikipediaHeading matches the section headings of a plain text extract, such as "== History ==".
+var wikipediaHeading = regexp.MustCompile(`(?m)^(={2,6})\s*(.+?)\s*={2,6}\s*$`)
+
+var wikipediaLanguage = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// wikipediaSkipped are the sections of lists of links rather than text, left out to save tokens.
+var wikipediaSkipped = map[string]bool{
+	"See also":        true,
+	"References":      true,
+	"Notes":           true,
+	"Citations":       true,
+	"Sources":         true,
+	"Bibliography":    true,
+	"Further reading": true,
+	"External links":  true,
+}
+
+type wikipediaResponse struct {
+	Query struct {
+		Pages []struct {
+			Title   string `json:"title"`
+			Extract string `json:"extract"`
+			Missing bool   `json:"missing"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+func isWikipediaURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasSuffix(u.Hostname(), ".wikipedia.org") && strings.HasPrefix(u.Path, "/wiki/")
+}
+
+// wikipediaArticle returns the language and title of a Wikipedia link, or of a source such as
+// wikipedia:Go (programming language) or wikipedia:fr:Go, in English unless a language is given.
+func wikipediaArticle(source string) (lang, title string, err error) {
+	if rest, ok := strings.CutPrefix(source, "wikipedia:"); ok {
+		lang, title = "en", rest
+		if prefix, after, ok := strings.Cut(rest, ":"); ok && wikipediaLanguage.MatchString(prefix) {
+			lang, title = prefix, after
+		}
+		return lang, strings.TrimSpace(title), nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", "", err
+	}
+	lang, _, _ = strings.Cut(u.Hostname(), ".")
+	title, err = url.PathUnescape(strings.TrimPrefix(u.EscapedPath(), "/wiki/"))
+	if err != nil {
+		return "", "", err
+	}
+
+	return lang, strings.ReplaceAll(title, "_", " "), nil
+}
+
+// getDocsFromWikipedia loads the plain text of a Wikipedia article through the MediaWiki API, one
+// document per section with the path of its headings in the "section" metadata.
+func getDocsFromWikipedia(ctx context.Context, source string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading Wikipedia article", source)
+
+	lang, title, err := wikipediaArticle(source)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		return nil, fmt.Errorf("no Wikipedia article in %s", source)
+	}
+
+	query := url.Values{
+		"action":          {"query"},
+		"prop":            {"extracts"},
+		"explaintext":     {"1"},
+		"exsectionformat": {"wiki"},
+		"redirects":       {"1"},
+		"format":          {"json"},
+		"formatversion":   {"2"},
+		"titles":          {title},
+	}
+	body, err := fetchBytes(ctx, fmt.Sprintf("https://%s.wikipedia.org/w/api.php?%s", lang, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp wikipediaResponse
+
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Query.Pages) == 0 || resp.Query.Pages[0].Missing {
+		return nil, fmt.Errorf("no Wikipedia article titled %q", title)
+	}
+	page := resp.Query.Pages[0]
+	link := fmt.Sprintf("https://%s.wikipedia.org/wiki/%s", lang, url.PathEscape(strings.ReplaceAll(page.Title, " ", "_")))
+
+	docs := wikipediaSections(page.Extract, page.Title)
+	for i := range docs {
+		docs[i].Metadata["source"] = link
+		docs[i].Metadata["title"] = page.Title
+		docs[i].Metadata["language"] = lang
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded", len(docs), "sections of", page.Title)
+
+	return docs, nil
+}
+
+// wikipediaSections splits the extract of an article at its headings, which are turned into
+// Markdown so the chunks of each section are found under it.
+func wikipediaSections(extract, title string) []schema.Document {
+	var docs []schema.Document
+
+	// path holds the headings of the section being read, by level, the title being level 1.
+	path := []string{title}
+	add := func(text string) {
+		text = strings.TrimSpace(text)
+		// A skipped section skips its subsections too.
+		if text == "" || slices.ContainsFunc(path, func(h string) bool { return wikipediaSkipped[h] }) {
+			return
+		}
+		heading := strings.Repeat("#", len(path)) + " " + path[len(path)-1]
+		docs = append(docs, schema.Document{
+			PageContent: heading + "\n\n" + text,
+			Metadata:    map[string]any{"section": strings.Join(path[1:], " > ")},
+		})
+	}
+
+	last := 0
+	for _, m := range wikipediaHeading.FindAllStringSubmatchIndex(extract, -1) {
+		add(extract[last:m[0]])
+		last = m[1]
+
+		level := m[3] - m[2]
+		path = append(path[:min(len(path), level-1)], extract[m[4]:m[5]])
+	}
+	add(extract[last:])
+
+	return docs
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/schema"
+)
+
+var captionTracksPattern = regexp.MustCompile(`"captionTracks":(\[.*?\])`)
+
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+}
+
+type transcript struct {
+	Texts []struct {
+		Start string `xml:"start,attr"`
+		Text  string `xml:",chardata"`
+	} `xml:"text"`
+}
+
+func isYouTubeURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	return host == "youtube.com" || host == "m.youtube.com" || host == "youtu.be"
+}
+
+func youTubeVideoID(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasSuffix(u.Hostname(), "youtu.be") {
+		return strings.TrimPrefix(u.Path, "/"), nil
+	}
+	if id := u.Query().Get("v"); id != "" {
+		return id, nil
+	}
+	if strings.HasPrefix(u.Path, "/shorts/") {
+		return strings.TrimPrefix(u.Path, "/shorts/"), nil
+	}
+
+	return "", fmt.Errorf("no video ID in %s", link)
+}
+
+func getDocsFromYouTube(ctx context.Context, link string, l LoaderFlags) ([]schema.Document, error) {
+	fmt.Fprintln(os.Stderr, "loading transcript from", link)
+
+	id, err := youTubeVideoID(link)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := fetchBytes(ctx, "https://www.youtube.com/watch?v="+url.QueryEscape(id))
+	if err != nil {
+		return nil, err
+	}
+
+	match := captionTracksPattern.FindSubmatch(page)
+	if match == nil {
+		return nil, errors.New("video has no captions")
+	}
+
+	var tracks []captionTrack
+
+	err = json.Unmarshal(match[1], &tracks)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("video has no captions")
+	}
+
+	track := tracks[0]
+	for _, t := range tracks {
+		if t.LanguageCode == l.Language {
+			track = t
+			break
+		}
+	}
+
+	body, err := fetchBytes(ctx, track.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var t transcript
+
+	err = xml.Unmarshal(body, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(t.Texts))
+	for _, text := range t.Texts {
+		lines = append(lines, html.UnescapeString(text.Text))
+	}
+
+	fmt.Fprintln(os.Stderr, "successfully loaded transcript from", link)
+
+	return []schema.Document{{
+		PageContent: strings.Join(lines, " "),
+		Metadata: map[string]any{
+			"source":   link,
+			"language": track.LanguageCode,
+		},
+	}}, nil
+}